@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// compositionPart is one "N Name" or "N-M Name" entry of a unit composition line
+type compositionPart struct {
+	Min  int
+	Max  int
+	Name string
+}
+
+// compositionOption is one legal way to build a unit; lines separated by "OR"
+// (or listed under "One of the following:") are alternative options.
+type compositionOption []compositionPart
+
+var compositionPartRe = regexp.MustCompile(`^(\d+)(?:\s*-\s*(\d+))?\s+(.+)$`)
+
+// parseCompositionPart parses "4-9 Corsair Voidscarred" or "1 Warboss – EPIC HERO"
+func parseCompositionPart(s string) (compositionPart, bool) {
+	s = strings.TrimSpace(s)
+	// drop keyword suffixes such as " – EPIC HERO"
+	if i := strings.Index(s, " – "); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	m := compositionPartRe.FindStringSubmatch(s)
+	if m == nil {
+		return compositionPart{}, false
+	}
+	name := strings.TrimSpace(m[3])
+	if strings.Contains(strings.ToLower(name), "models maximum") {
+		return compositionPart{}, false
+	}
+	min, _ := strconv.Atoi(m[1])
+	max := min
+	if m[2] != "" {
+		max, _ = strconv.Atoi(m[2])
+	}
+	return compositionPart{Min: min, Max: max, Name: name}, true
+}
+
+// parseComposition turns a datasheet's composition lines into its build options
+func parseComposition(lines []CompositionLine) []compositionOption {
+	var opts []compositionOption
+	var cur compositionOption
+	oneOf := false
+	flush := func() {
+		if len(cur) > 0 {
+			opts = append(opts, cur)
+		}
+		cur = nil
+	}
+	for _, l := range lines {
+		desc := strings.TrimSpace(l.Description)
+		low := strings.ToLower(strings.TrimSuffix(desc, ":"))
+		switch {
+		case low == "or":
+			flush()
+			continue
+		case strings.HasPrefix(low, "one of the following"):
+			flush()
+			oneOf = true
+			continue
+		}
+		// "1 Grenadier Sergeant, 7 Grenadiers and 1 Heavy Weapons Team"
+		var parts []compositionPart
+		for _, chunk := range strings.Split(desc, ",") {
+			for _, p := range strings.Split(chunk, " and ") {
+				if cp, ok := parseCompositionPart(p); ok {
+					parts = append(parts, cp)
+				}
+			}
+		}
+		if len(parts) == 0 {
+			continue // notes such as "This unit can contain a maximum of 10 models."
+		}
+		cur = append(cur, parts...)
+		if oneOf {
+			flush()
+		}
+	}
+	flush()
+	return opts
+}
+
+// matchModelProfile finds the Datasheets_models.csv profile for a composition entry name
+func matchModelProfile(models []Model, name string) (Model, bool) {
+	if len(models) == 0 {
+		return Model{}, false
+	}
+	norm := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(s))
+		s = strings.TrimSuffix(s, "es")
+		return strings.TrimSuffix(s, "s")
+	}
+	want := norm(name)
+	for _, m := range models {
+		if norm(m.Name) == want {
+			return m, true
+		}
+	}
+	for _, m := range models {
+		mn := norm(m.Name)
+		if strings.Contains(want, mn) || strings.Contains(mn, want) {
+			return m, true
+		}
+	}
+	// Single-profile datasheets name their models loosely (e.g. "Voidscarred Felarch")
+	return models[0], true
+}
+
+// modelWounds parses a model's W characteristic, defaulting to 1
+func modelWounds(m Model) int {
+	if n, ok := parseFirstInt(m.W); ok && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// UnitSize is one size a unit can be fielded at, priced from its Datasheets_models_cost.csv row
+type UnitSize struct {
+	Models      int    `json:"models"`
+	Cost        int    `json:"cost"`
+	Description string `json:"description"`
+}
+
+var costCountRe = regexp.MustCompile(`\d+`)
+
+// unitSizes lists a unit's legal sizes, smallest first: the points brackets whose model count
+// fits one of its composition options. Units without cost rows get their composition minimums.
+func unitSizes(store *Store, unitID string) []UnitSize {
+	opts := parseComposition(store.CompositionByDS[unitID])
+	fits := func(n int) bool {
+		if len(opts) == 0 {
+			return true
+		}
+		for _, o := range opts {
+			min, max := o.size()
+			if n >= min && n <= max {
+				return true
+			}
+		}
+		return false
+	}
+	var out []UnitSize
+	seen := map[int]bool{}
+	// Plain brackets ("10 models") first; context-specific rows such as "(Assigned Agent)" only
+	// price a size no plain row covers
+	for _, plain := range []bool{true, false} {
+		for _, c := range store.CostsByDS[unitID] {
+			desc := htmlToText(c.Description)
+			if strings.Contains(desc, "(") == plain {
+				continue
+			}
+			cost, err := strconv.Atoi(strings.TrimSpace(c.Cost))
+			if err != nil || cost <= 0 {
+				continue
+			}
+			// "10 models", or "1 Sword Brother, 4 Initiates and 5 Neophytes"
+			head := desc
+			if i := strings.Index(head, "("); i >= 0 {
+				head = head[:i]
+			}
+			n := 0
+			for _, m := range costCountRe.FindAllString(head, -1) {
+				k, _ := strconv.Atoi(m)
+				n += k
+			}
+			if n == 0 {
+				n = 1
+			}
+			if seen[n] || !fits(n) {
+				continue
+			}
+			seen[n] = true
+			out = append(out, UnitSize{Models: n, Cost: cost, Description: desc})
+		}
+	}
+	if len(out) == 0 {
+		for _, o := range opts {
+			if min, _ := o.size(); !seen[min] {
+				seen[min] = true
+				out = append(out, UnitSize{Models: min, Description: fmt.Sprintf("%d models", min)})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Models < out[j].Models })
+	return out
+}
+
+// unitSize resolves a requested model count to one of the unit's sizes; 0 picks the smallest
+func unitSize(store *Store, unitID string, models int) (UnitSize, error) {
+	sizes := unitSizes(store, unitID)
+	if len(sizes) == 0 {
+		if models > 0 {
+			return UnitSize{}, fmt.Errorf("unit %s has no size options", unitID)
+		}
+		return UnitSize{}, nil
+	}
+	if models <= 0 {
+		return sizes[0], nil
+	}
+	counts := make([]string, 0, len(sizes))
+	for _, s := range sizes {
+		if s.Models == models {
+			return s, nil
+		}
+		counts = append(counts, strconv.Itoa(s.Models))
+	}
+	return UnitSize{}, fmt.Errorf("unit size %d is not available for %s (choose from %s)", models, unitID, strings.Join(counts, ", "))
+}
+
+// size returns the fewest and most models a composition option allows
+func (o compositionOption) size() (min, max int) {
+	for _, p := range o {
+		min += p.Min
+		max += p.Max
+	}
+	return min, max
+}
+
+// buildUnitModels builds the model list for a unit of the given size (0 for the minimum) from the
+// first composition option that allows it, filling optional models in composition order.
+// Units without composition data fall back to a single model from the first profile.
+func buildUnitModels(store *Store, unitID string, models int) []game.ModelState {
+	profiles := store.ModelsByDS[unitID]
+	opts := parseComposition(store.CompositionByDS[unitID])
+	var out []game.ModelState
+	if len(opts) > 0 {
+		opt := opts[0]
+		for _, o := range opts {
+			if min, max := o.size(); models >= min && models <= max {
+				opt = o
+				break
+			}
+		}
+		extra, _ := opt.size()
+		extra = models - extra
+		for _, part := range opt {
+			prof, ok := matchModelProfile(profiles, part.Name)
+			if !ok {
+				continue
+			}
+			n := part.Min
+			if extra > 0 {
+				add := part.Max - part.Min
+				if add > extra {
+					add = extra
+				}
+				n += add
+				extra -= add
+			}
+			w := modelWounds(prof)
+			for i := 0; i < n; i++ {
+				out = append(out, game.ModelState{Name: prof.Name, W: w, Wounds: w})
+			}
+		}
+	}
+	if len(out) == 0 {
+		w := 10
+		name := unitID
+		if len(profiles) > 0 {
+			w = modelWounds(profiles[0])
+			name = profiles[0].Name
+		}
+		out = []game.ModelState{{Name: name, W: w, Wounds: w}}
+	}
+	return out
+}
+
+// unitLeadership returns a unit's Leadership (the best across its model profiles, as
+// Battle-shock tests use) and the OC characteristic of its first profile; 0 if unknown
+func unitLeadership(store *Store, unitID string) (ld, oc int) {
+	for i, prof := range store.ModelsByDS[unitID] {
+		if n, ok := parseFirstInt(prof.Ld); ok && (ld == 0 || n < ld) {
+			ld = n
+		}
+		if i == 0 {
+			oc, _ = parseFirstInt(prof.OC)
+		}
+	}
+	return ld, oc
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseComposition(t *testing.T) {
+	lines := []CompositionLine{
+		{Line: 1, Description: "1 Grenadier Sergeant, 4-9 Grenadiers and 1 Heavy Weapons Team"},
+		{Line: 2, Description: "OR"},
+		{Line: 3, Description: "1 Warboss – EPIC HERO"},
+		{Line: 4, Description: "This unit can contain 10 models maximum."},
+	}
+	want := []compositionOption{
+		{{Min: 1, Max: 1, Name: "Grenadier Sergeant"}, {Min: 4, Max: 9, Name: "Grenadiers"}, {Min: 1, Max: 1, Name: "Heavy Weapons Team"}},
+		{{Min: 1, Max: 1, Name: "Warboss"}},
+	}
+	if got := parseComposition(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseComposition = %+v, want %+v", got, want)
+	}
+}
+
+func sizedStore() *Store {
+	return &Store{
+		ModelsByDS: map[string][]Model{"squad": {
+			{Name: "Sergeant", W: "2"},
+			{Name: "Intercessor", W: "2"},
+		}},
+		CompositionByDS: map[string][]CompositionLine{"squad": {
+			{Line: 1, Description: "1 Sergeant and 4-9 Intercessors"},
+		}},
+		CostsByDS: map[string][]ModelCost{"squad": {
+			{Line: 1, Description: "10 models", Cost: "160"},
+			{Line: 2, Description: "5 models", Cost: "80"},
+			{Line: 3, Description: "5 models (Assigned Agent)", Cost: "70"},
+			{Line: 4, Description: "20 models", Cost: "300"},
+		}},
+	}
+}
+
+func TestUnitSizes(t *testing.T) {
+	want := []UnitSize{
+		{Models: 5, Cost: 80, Description: "5 models"},
+		{Models: 10, Cost: 160, Description: "10 models"},
+	}
+	if got := unitSizes(sizedStore(), "squad"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unitSizes = %+v, want %+v", got, want)
+	}
+	if s, err := unitSize(sizedStore(), "squad", 0); err != nil || s.Models != 5 {
+		t.Errorf("unitSize(0) = %+v, %v; want the smallest size", s, err)
+	}
+	if _, err := unitSize(sizedStore(), "squad", 7); err == nil {
+		t.Error("unitSize(7) should be rejected")
+	}
+}
+
+func TestBuildUnitModelsAtSize(t *testing.T) {
+	for _, c := range []struct{ size, sergeants, troops int }{{0, 1, 4}, {5, 1, 4}, {10, 1, 9}} {
+		ms := buildUnitModels(sizedStore(), "squad", c.size)
+		n := map[string]int{}
+		for _, m := range ms {
+			n[m.Name]++
+			if m.W != 2 || m.Wounds != 2 {
+				t.Errorf("size %d: %s has %d/%d wounds, want 2/2", c.size, m.Name, m.Wounds, m.W)
+			}
+		}
+		if n["Sergeant"] != c.sergeants || n["Intercessor"] != c.troops {
+			t.Errorf("size %d: got %v", c.size, n)
+		}
+	}
+}
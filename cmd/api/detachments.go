@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// DetachmentAbility from Detachment_abilities.csv
+type DetachmentAbility struct {
+	ID          string `json:"id"`
+	FactionID   string `json:"faction_id"`
+	Name        string `json:"name"`
+	Legend      string `json:"legend,omitempty"`
+	Description string `json:"description"`
+	Detachment  string `json:"detachment"`
+	// Supported is set when the engine applies the ability to attacks
+	Supported bool `json:"supported"`
+}
+
+// Detachment groups a faction's detachment rules and stratagems under its name
+type Detachment struct {
+	Name       string              `json:"name"`
+	FactionID  string              `json:"faction_id"`
+	Abilities  []DetachmentAbility `json:"abilities"`
+	Stratagems []Stratagem         `json:"stratagems"`
+}
+
+// loadDetachments builds each faction's detachments from their abilities and stratagems,
+// and indexes detachment abilities by the datasheets they apply to
+func loadDetachments(root string, stratsByDet map[string][]Stratagem) (map[string][]Detachment, map[string][]DetachmentAbility, error) {
+	rows, err := readPipeCSV(filepath.Join(root, "src", "Detachment_abilities.csv"))
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[string]DetachmentAbility{}
+	dets := map[string]*Detachment{} // key: faction_id|name
+	get := func(fac, name string) *Detachment {
+		k := fac + "|" + name
+		if d, ok := dets[k]; ok {
+			return d
+		}
+		d := &Detachment{Name: name, FactionID: fac, Abilities: []DetachmentAbility{}, Stratagems: []Stratagem{}}
+		dets[k] = d
+		return d
+	}
+	for i, r := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(r) < 6 {
+			continue
+		}
+		ab := DetachmentAbility{
+			ID:          strings.TrimSpace(r[0]),
+			FactionID:   strings.TrimSpace(r[1]),
+			Name:        strings.TrimSpace(r[2]),
+			Legend:      htmlToText(r[3]),
+			Description: htmlToText(r[4]),
+			Detachment:  strings.TrimSpace(r[5]),
+		}
+		_, ab.Supported = game.DetachmentRuleFor(ab.Name)
+		byID[ab.ID] = ab
+		if ab.Detachment != "" {
+			d := get(ab.FactionID, ab.Detachment)
+			d.Abilities = append(d.Abilities, ab)
+		}
+	}
+	for det, list := range stratsByDet {
+		for _, st := range list {
+			if st.FactionID != "" {
+				d := get(st.FactionID, det)
+				d.Stratagems = append(d.Stratagems, st)
+			}
+		}
+	}
+	byFac := map[string][]Detachment{}
+	for _, d := range dets {
+		byFac[d.FactionID] = append(byFac[d.FactionID], *d)
+	}
+	for fac, list := range byFac {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		byFac[fac] = list
+	}
+
+	links, err := readPipeCSV(filepath.Join(root, "src", "Datasheets_detachment_abilities.csv"))
+	if err != nil {
+		return nil, nil, err
+	}
+	byDS := map[string][]DetachmentAbility{}
+	for i, r := range links {
+		if i == 0 || len(r) < 2 {
+			continue
+		}
+		if ab, ok := byID[strings.TrimSpace(r[1])]; ok {
+			byDS[r[0]] = append(byDS[r[0]], ab)
+		}
+	}
+	return byFac, byDS, nil
+}
+
+// findDetachment looks up one of a faction's detachments by name (case-insensitive)
+func findDetachment(store *Store, factionID, name string) (Detachment, bool) {
+	for _, d := range store.DetachmentsByFac[factionID] {
+		if strings.EqualFold(d.Name, strings.TrimSpace(name)) {
+			return d, true
+		}
+	}
+	return Detachment{}, false
+}
+
+// applyDetachment records the chosen detachment on a player's unit along with the rules
+// the engine applies to it: supported abilities of the detachment that list the datasheet
+func applyDetachment(store *Store, d *PvPPlayerData, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return nil
+	}
+	fac := d.FactionID
+	if f, ok := store.FactionsBySlug[strings.ToLower(fac)]; ok {
+		fac = f.ID
+	}
+	det, ok := findDetachment(store, fac, name)
+	if !ok {
+		return fmt.Errorf("unknown detachment for faction %s: %s", d.FactionID, name)
+	}
+	d.Detachment = det.Name
+	d.DetachmentRules = nil
+	for _, ab := range det.Abilities {
+		if ab.Supported && detachmentCovers(store, d.UnitID, ab.ID) {
+			d.DetachmentRules = append(d.DetachmentRules, ab.Name)
+		}
+	}
+	return nil
+}
+
+// detachmentCovers reports whether a detachment ability lists the datasheet
+func detachmentCovers(store *Store, unitID, abilityID string) bool {
+	for _, ab := range store.DetachmentAbilitiesByDS[unitID] {
+		if ab.ID == abilityID {
+			return true
+		}
+	}
+	return false
+}
+
+// pvpDetachmentRules returns the engine rules for a player's detachment
+func pvpDetachmentRules(d *PvPPlayerData) []game.DetachmentRule {
+	var out []game.DetachmentRule
+	for _, name := range d.DetachmentRules {
+		if r, ok := game.DetachmentRuleFor(name); ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// Enhancement from Enhancements.csv
+type Enhancement struct {
+	ID          string `json:"id"`
+	FactionID   string `json:"faction_id"`
+	Name        string `json:"name"`
+	Cost        int    `json:"cost"` // points
+	Detachment  string `json:"detachment"`
+	Legend      string `json:"legend,omitempty"`
+	Description string `json:"description"`
+	// What the engine applies; Supported is false when none of the rules text is expressible
+	Effect    game.EnhancementEffect `json:"effect"`
+	Supported bool                   `json:"supported"`
+}
+
+// loadEnhancements indexes enhancements by faction and by the datasheets that can take them
+func loadEnhancements(root string) (map[string][]Enhancement, map[string][]Enhancement, error) {
+	rows, err := readPipeCSV(filepath.Join(root, "src", "Enhancements.csv"))
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[string]Enhancement{}
+	byFac := map[string][]Enhancement{}
+	for i, r := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(r) < 7 {
+			continue
+		}
+		e := Enhancement{
+			ID:          strings.TrimSpace(r[0]),
+			FactionID:   strings.TrimSpace(r[1]),
+			Name:        strings.TrimSpace(r[2]),
+			Detachment:  strings.TrimSpace(r[4]),
+			Legend:      htmlToText(r[5]),
+			Description: htmlToText(r[6]),
+		}
+		e.Cost, _ = parseFirstInt(r[3])
+		e.Effect = game.ParseEnhancement(e.Description)
+		e.Supported = e.Effect.Supported()
+		byID[e.ID] = e
+		byFac[e.FactionID] = append(byFac[e.FactionID], e)
+	}
+	for fac, list := range byFac {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].Detachment != list[j].Detachment {
+				return list[i].Detachment < list[j].Detachment
+			}
+			return list[i].Name < list[j].Name
+		})
+		byFac[fac] = list
+	}
+
+	links, err := readPipeCSV(filepath.Join(root, "src", "Datasheets_enhancements.csv"))
+	if err != nil {
+		return nil, nil, err
+	}
+	byDS := map[string][]Enhancement{}
+	for i, r := range links {
+		if i == 0 || len(r) < 2 {
+			continue
+		}
+		if e, ok := byID[strings.TrimSpace(r[1])]; ok {
+			byDS[r[0]] = append(byDS[r[0]], e)
+		}
+	}
+	return byFac, byDS, nil
+}
+
+// unitPoints returns the points cost of a datasheet's smallest size, or 0 when it has none
+func unitPoints(store *Store, unitID string) int {
+	s, _ := unitSize(store, unitID, 0)
+	return s.Cost
+}
+
+// hasKeyword reports whether a datasheet has a keyword (case-insensitive)
+func hasKeyword(store *Store, unitID, keyword string) bool {
+	for _, kw := range store.KeywordsByDS[unitID] {
+		if strings.EqualFold(strings.TrimSpace(kw.Keyword), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnhancement gives the unit's character (its leader when one is attached) an
+// enhancement from the player's detachment: its points are added to the unit's cost and
+// its expressible effects are applied to the bearer's weapons and the unit's abilities
+func applyEnhancement(store *Store, d *PvPPlayerData, ref string) error {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+	bearer := d.UnitID
+	if d.LeaderID != "" {
+		bearer = d.LeaderID
+	}
+	if !hasKeyword(store, bearer, "Character") || hasKeyword(store, bearer, "Epic Hero") {
+		return fmt.Errorf("only a Character that isn't an Epic Hero can take an enhancement")
+	}
+	var enh Enhancement
+	found := false
+	for _, e := range store.EnhancementsByDS[bearer] {
+		if e.ID == ref || strings.EqualFold(e.Name, ref) {
+			enh, found = e, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown enhancement for this character: %s", ref)
+	}
+	if !strings.EqualFold(enh.Detachment, d.Detachment) {
+		return fmt.Errorf("%s is an enhancement of the %s detachment", enh.Name, enh.Detachment)
+	}
+	d.Enhancement = enh.Name
+	d.Points += enh.Cost
+
+	// The bearer's weapons: all of them for a lone character, otherwise the leader's
+	bearerWeapon := func(name string) bool {
+		if bearer == d.UnitID {
+			return true
+		}
+		for _, w := range store.WeaponsByDS[bearer] {
+			if strings.EqualFold(strings.TrimSpace(w.Name), strings.TrimSpace(name)) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, w := range d.Weapons {
+		if !bearerWeapon(w.Name) {
+			continue
+		}
+		ws := enh.Effect.ApplyWeapon(w.snapshot())
+		d.Weapons[i].Attacks, d.Weapons[i].Strength, d.Weapons[i].AP, d.Weapons[i].Damage, d.Weapons[i].Abilities = ws.Attacks, ws.Strength, ws.AP, ws.Damage, ws.Abilities
+	}
+	d.Abilities = append(d.Abilities, enh.Effect.Abilities...)
+	// Abilities of the bearer alone can only be applied when it is the whole unit
+	if bearer == d.UnitID {
+		d.Abilities = append(d.Abilities, enh.Effect.BearerAbilities...)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// loadLeaders reads Datasheets_leader.csv into leader -> bodyguards and bodyguard -> leaders
+func loadLeaders(root string) (map[string][]string, map[string][]string, error) {
+	rows, err := readPipeCSV(filepath.Join(root, "src", "Datasheets_leader.csv"))
+	if err != nil {
+		return nil, nil, err
+	}
+	leads := map[string][]string{}
+	ledBy := map[string][]string{}
+	for i, r := range rows {
+		if i == 0 || len(r) < 2 {
+			continue
+		}
+		leader, bodyguard := strings.TrimSpace(r[0]), strings.TrimSpace(r[1])
+		if leader == "" || bodyguard == "" {
+			continue
+		}
+		leads[leader] = append(leads[leader], bodyguard)
+		ledBy[bodyguard] = append(ledBy[bodyguard], leader)
+	}
+	return leads, ledBy, nil
+}
+
+// canLead reports whether Datasheets_leader.csv lets leaderID lead bodyguardID
+func canLead(store *Store, leaderID, bodyguardID string) bool {
+	for _, id := range store.LeadsByDS[leaderID] {
+		if id == bodyguardID {
+			return true
+		}
+	}
+	return false
+}
+
+// leaderAttachments lists the valid attachments for a unit: the bodyguard units it
+// can lead and the leaders that can lead it, restricted to the faction
+type leaderAttachments struct {
+	Leads []Unit `json:"leads"`
+	LedBy []Unit `json:"led_by"`
+}
+
+func unitLeaderAttachments(store *Store, factionID, unitID string) leaderAttachments {
+	units := func(ids []string) []Unit {
+		out := []Unit{}
+		for _, id := range ids {
+			if u, ok := store.UnitsByID[id]; ok && strings.EqualFold(u.FactionID, factionID) {
+				out = append(out, u)
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+		return out
+	}
+	return leaderAttachments{Leads: units(store.LeadsByDS[unitID]), LedBy: units(store.LedByDS[unitID])}
+}
+
+// unitSnapshot builds a unit's combat profile from its first model's characteristics,
+// its damaged bracket, its non-faction keywords, its abilities and its models at the given
+// size (0 for the minimum)
+func unitSnapshot(store *Store, unitID string, models int) game.UnitSnapshot {
+	u := game.UnitSnapshot{ID: unitID, Name: unitID, Sv: 7}
+	if unit, ok := store.UnitsByID[unitID]; ok {
+		u.Name = unit.Name
+		if p, ok := game.ParseDamagedProfile(unit.DamagedW, unit.DamagedDescription); ok {
+			u.Damaged = &p
+		}
+	}
+	if profiles := store.ModelsByDS[unitID]; len(profiles) > 0 {
+		p := profiles[0]
+		u.T, _ = parseFirstInt(p.T)
+		if n, ok := parseFirstInt(p.Sv); ok {
+			u.Sv = n
+		}
+		u.InvSv, u.InvSaves = unitInvulnSaves(profiles)
+	}
+	u.Ld, u.OC = unitLeadership(store, unitID)
+	for _, kw := range store.KeywordsByDS[unitID] {
+		if !kw.IsFaction {
+			u.Keywords = append(u.Keywords, strings.TrimSpace(kw.Keyword))
+		}
+	}
+	for _, ab := range store.AbilitiesByDS[unitID] {
+		name := strings.TrimSpace(ab.Name)
+		if name == "" {
+			continue
+		}
+		if p := strings.TrimSpace(ab.Parameter); p != "" {
+			name += " " + p
+		}
+		u.Abilities = append(u.Abilities, name)
+	}
+	u.Models = buildUnitModels(store, unitID, models)
+	u.W = game.ModelsRemaining(u.Models)
+	return u
+}
+
+// unitInvulnSaves reads the invulnerable saves of a datasheet's model profiles. When the
+// profiles disagree, each profile's saves only cover the models of that profile.
+func unitInvulnSaves(profiles []Model) (int, []game.InvulnSave) {
+	same := true
+	for _, p := range profiles[1:] {
+		if strings.TrimSpace(p.InvSv) != strings.TrimSpace(profiles[0].InvSv) || strings.TrimSpace(p.InvSvDescr) != strings.TrimSpace(profiles[0].InvSvDescr) {
+			same = false
+		}
+	}
+	if same {
+		n, _ := parseFirstInt(profiles[0].InvSv)
+		return game.ParseInvulnSaves(n, profiles[0].InvSvDescr)
+	}
+	var out []game.InvulnSave
+	for _, p := range profiles {
+		n, _ := parseFirstInt(p.InvSv)
+		inv, saves := game.ParseInvulnSaves(n, p.InvSvDescr)
+		if inv > 0 {
+			saves = append(saves, game.InvulnSave{TN: inv, Source: p.Name})
+		}
+		for _, s := range saves {
+			if len(s.Models) == 0 {
+				s.Models = []string{p.Name}
+			}
+			out = append(out, s)
+		}
+	}
+	return 0, out
+}
+
+// fieldedUnit returns the unit a player fields at the given size: the datasheet on its own, or
+// led by leaderID when given, after checking the leader belongs to the faction and can lead it
+func fieldedUnit(store *Store, factionID, unitID, leaderID string, models int) (game.UnitSnapshot, error) {
+	u := unitSnapshot(store, unitID, models)
+	if strings.TrimSpace(leaderID) == "" {
+		return u, nil
+	}
+	l, ok := store.UnitsByID[leaderID]
+	if !ok {
+		return u, fmt.Errorf("unknown leader: %s", leaderID)
+	}
+	if !strings.EqualFold(strings.TrimSpace(l.FactionID), strings.TrimSpace(factionID)) {
+		return u, fmt.Errorf("leader %s does not belong to faction %s", leaderID, factionID)
+	}
+	if !canLead(store, leaderID, unitID) {
+		return u, fmt.Errorf("%s can't lead %s", l.Name, u.Name)
+	}
+	return game.AttachLeader(u, unitSnapshot(store, leaderID, 0)), nil
+}
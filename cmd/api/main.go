@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -17,6 +18,7 @@ import (
 	"time"
 
 	game "github.com/pefman/w40k-duel/internal/engine"
+	"github.com/pefman/w40k-duel/internal/sim"
 )
 
 // Build metadata injected via -ldflags
@@ -47,6 +49,11 @@ type Unit struct {
 	T      string `json:"T,omitempty"`
 	W      string `json:"W,omitempty"`
 	Points string `json:"points,omitempty"`
+	// Legal unit sizes and their points brackets
+	Sizes []UnitSize `json:"sizes,omitempty"`
+	// Damaged bracket (e.g. "1-4") and its rules text, for vehicles and monsters
+	DamagedW           string `json:"damaged_w,omitempty"`
+	DamagedDescription string `json:"damaged_description,omitempty"`
 }
 
 type Weapon struct {
@@ -59,22 +66,37 @@ type Weapon struct {
 	Strength    string `json:"strength"`
 	AP          string `json:"ap"`
 	Damage      string `json:"damage"`
+	// Abilities parsed from Description; unknown tokens are listed under abilities.unknown
+	Abilities game.WeaponAbilities `json:"abilities"`
 	// internal order from CSV line column for stable ordering in responses
 	Order int `json:"-"`
 }
 
 type Store struct {
-	FactionsByID   map[string]Faction
-	FactionsBySlug map[string]Faction
-	FactionsList   []Faction
-	UnitsByID      map[string]Unit
-	UnitsByFac     map[string][]Unit
-	WeaponsByDS    map[string][]Weapon    // datasheet_id -> weapons
-	ModelsByDS     map[string][]Model     // datasheet_id -> models
-	KeywordsByDS   map[string][]Keyword   // datasheet_id -> keywords
-	AbilitiesByDS  map[string][]Ability   // datasheet_id -> abilities
-	OptionsByDS    map[string][]Option    // datasheet_id -> options
-	CostsByDS      map[string][]ModelCost // datasheet_id -> model costs
+	FactionsByID      map[string]Faction
+	FactionsBySlug    map[string]Faction
+	FactionsList      []Faction
+	UnitsByID         map[string]Unit
+	UnitsByFac        map[string][]Unit
+	WeaponsByDS       map[string][]Weapon          // datasheet_id -> weapons
+	ModelsByDS        map[string][]Model           // datasheet_id -> models
+	KeywordsByDS      map[string][]Keyword         // datasheet_id -> keywords
+	AbilitiesByDS     map[string][]Ability         // datasheet_id -> abilities
+	OptionsByDS       map[string][]Option          // datasheet_id -> options
+	LoadoutsByDS      map[string][]string          // datasheet_id -> default wargear (normalized names)
+	CostsByDS         map[string][]ModelCost       // datasheet_id -> model costs
+	CompositionByDS   map[string][]CompositionLine // datasheet_id -> unit composition lines
+	StratagemsByID    map[string]Stratagem
+	StratagemsByFac   map[string][]Stratagem   // faction_id -> stratagems ("" for core)
+	StratagemsByDet   map[string][]Stratagem   // detachment -> stratagems
+	StratagemsByDS    map[string][]Stratagem   // datasheet_id -> stratagems
+	LeadsByDS         map[string][]string      // leader datasheet_id -> bodyguard datasheet_ids it can lead
+	LedByDS           map[string][]string      // bodyguard datasheet_id -> leader datasheet_ids
+	EnhancementsByFac map[string][]Enhancement // faction_id -> enhancements
+	EnhancementsByDS  map[string][]Enhancement // datasheet_id -> enhancements it can take
+	// faction_id -> detachments, and datasheet_id -> detachment abilities that apply to it
+	DetachmentsByFac        map[string][]Detachment
+	DetachmentAbilitiesByDS map[string][]DetachmentAbility
 }
 
 func mustOpen(path string) *os.File {
@@ -141,6 +163,10 @@ func loadUnits(root string) (map[string]Unit, map[string][]Unit, error) {
 		if len(r) > 13 {
 			u.Link = r[13]
 		}
+		if len(r) > 12 {
+			u.DamagedW = strings.TrimSpace(r[11])
+			u.DamagedDescription = htmlToText(r[12])
+		}
 		byID[u.ID] = u
 		byFac[u.FactionID] = append(byFac[u.FactionID], u)
 	}
@@ -185,6 +211,7 @@ func loadWeapons(root string) (map[string][]Weapon, error) {
 			Damage:      r[12],
 			Order:       order,
 		}
+		w.Abilities = game.ParseWeaponAbilities(w.Description)
 		byDS[dsid] = append(byDS[dsid], w)
 	}
 	// sort weapons by CSV line order for stable outputs
@@ -290,6 +317,40 @@ func loadModelCosts(root string) (map[string][]ModelCost, error) {
 	return byDS, nil
 }
 
+// CompositionLine from Datasheets_unit_composition.csv
+type CompositionLine struct {
+	Line        int    `json:"line"`
+	Description string `json:"description"`
+}
+
+func loadComposition(root string) (map[string][]CompositionLine, error) {
+	rows, err := readPipeCSV(filepath.Join(root, "src", "Datasheets_unit_composition.csv"))
+	if err != nil {
+		return nil, err
+	}
+	byDS := map[string][]CompositionLine{}
+	for i, r := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(r) < 3 {
+			continue
+		}
+		dsid := r[0]
+		line := 0
+		if n, err := strconv.Atoi(strings.TrimSpace(r[1])); err == nil {
+			line = n
+		}
+		byDS[dsid] = append(byDS[dsid], CompositionLine{Line: line, Description: htmlToText(r[2])})
+	}
+	for dsid := range byDS {
+		list := byDS[dsid]
+		sort.Slice(list, func(i, j int) bool { return list[i].Line < list[j].Line })
+		byDS[dsid] = list
+	}
+	return byDS, nil
+}
+
 func htmlToText(s string) string {
 	// very simple scrub: strip tags
 	out := []rune{}
@@ -354,6 +415,15 @@ func loadAbilities(root string) (map[string][]Ability, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Core and faction abilities are referenced by id only; take their names from Abilities.csv
+	names := map[string]string{}
+	if shared, err := readPipeCSV(filepath.Join(root, "src", "Abilities.csv")); err == nil {
+		for i, r := range shared {
+			if i > 0 && len(r) > 1 {
+				names[strings.TrimSpace(r[0])] = strings.TrimSpace(r[1])
+			}
+		}
+	}
 	byDS := map[string][]Ability{}
 	for i, r := range rows {
 		if i == 0 {
@@ -376,6 +446,9 @@ func loadAbilities(root string) (map[string][]Ability, error) {
 			Type:        r[6],
 			Parameter:   r[7],
 		}
+		if ab.Name == "" {
+			ab.Name = names[strings.TrimSpace(ab.AbilityID)]
+		}
 		byDS[dsid] = append(byDS[dsid], ab)
 	}
 	for dsid := range byDS {
@@ -391,6 +464,8 @@ type Option struct {
 	Line        int    `json:"line"`
 	Bullet      string `json:"bullet,omitempty"`
 	Description string `json:"description"`
+	// Parsed swap rule; nil when the line isn't a weapon swap or addition
+	Rule *WargearRule `json:"rule,omitempty"`
 }
 
 func loadOptions(root string) (map[string][]Option, error) {
@@ -417,6 +492,7 @@ func loadOptions(root string) (map[string][]Option, error) {
 		}
 		if len(r) > 3 {
 			opt.Description = htmlToText(r[3])
+			opt.Rule = parseWargearRule(r[3])
 		}
 		byDS[dsid] = append(byDS[dsid], opt)
 	}
@@ -461,6 +537,30 @@ func newStore(root string) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	compByDS, err := loadComposition(root)
+	if err != nil {
+		return nil, err
+	}
+	strats, err := loadStratagems(root)
+	if err != nil {
+		return nil, err
+	}
+	detsByFac, detAbsByDS, err := loadDetachments(root, strats.ByDetachment)
+	if err != nil {
+		return nil, err
+	}
+	leads, ledBy, err := loadLeaders(root)
+	if err != nil {
+		return nil, err
+	}
+	enhByFac, enhByDS, err := loadEnhancements(root)
+	if err != nil {
+		return nil, err
+	}
+	loadouts, err := loadLoadouts(root)
+	if err != nil {
+		return nil, err
+	}
 	// build faction slug map (lowercased hyphenated name)
 	bySlug := map[string]Faction{}
 	for _, f := range fList {
@@ -470,17 +570,30 @@ func newStore(root string) (*Store, error) {
 		bySlug[f.ID] = f                  // and raw id
 	}
 	return &Store{
-		FactionsByID:   fMap,
-		FactionsBySlug: bySlug,
-		FactionsList:   fList,
-		UnitsByID:      uByID,
-		UnitsByFac:     uByFac,
-		WeaponsByDS:    wByDS,
-		ModelsByDS:     mByDS,
-		KeywordsByDS:   kByDS,
-		AbilitiesByDS:  aByDS,
-		OptionsByDS:    oByDS,
-		CostsByDS:      cByDS,
+		FactionsByID:    fMap,
+		FactionsBySlug:  bySlug,
+		FactionsList:    fList,
+		UnitsByID:       uByID,
+		UnitsByFac:      uByFac,
+		WeaponsByDS:     wByDS,
+		ModelsByDS:      mByDS,
+		KeywordsByDS:    kByDS,
+		AbilitiesByDS:   aByDS,
+		OptionsByDS:     oByDS,
+		LoadoutsByDS:    loadouts,
+		CostsByDS:       cByDS,
+		CompositionByDS: compByDS,
+		StratagemsByID:  strats.ByID,
+		StratagemsByFac: strats.ByFac,
+		StratagemsByDet: strats.ByDetachment,
+		StratagemsByDS:  strats.ByDS,
+
+		DetachmentsByFac:        detsByFac,
+		DetachmentAbilitiesByDS: detAbsByDS,
+		LeadsByDS:               leads,
+		LedByDS:                 ledBy,
+		EnhancementsByFac:       enhByFac,
+		EnhancementsByDS:        enhByDS,
 	}, nil
 }
 
@@ -501,6 +614,25 @@ func writeError(w http.ResponseWriter, code int, msg string) {
 	})
 }
 
+// maxSimRequestBytes caps the body of a simulation request; real ones are a few KB
+const maxSimRequestBytes = 64 << 10
+
+// decodeSimRequest decodes a size-limited JSON body into v. It writes the error response
+// and returns false when the body is too large or isn't valid JSON.
+func decodeSimRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSimRequestBytes)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body over %d bytes", maxSimRequestBytes))
+		} else {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+		}
+		return false
+	}
+	return true
+}
+
 func toSlug(s string) string {
 	s = strings.ToLower(s)
 	s = strings.ReplaceAll(s, "’", "")
@@ -552,17 +684,17 @@ func parseFirstInt(s string) (int, bool) {
 	return n, true
 }
 
+// rollerFor returns a seeded dice roller, reusing the caller's seed when one was supplied
+func rollerFor(seed *int64) game.Roller {
+	if seed != nil {
+		return game.NewSeededRoller(*seed)
+	}
+	return game.NewSeededRoller(game.NewSeed())
+}
+
 // Given a faction and unit, validate membership and build canonical player data from server store.
-func canonicalizePlayerData(store *Store, factionID, unitID string, requested []struct {
-	Name      string   `json:"name"`
-	Type      string   `json:"type"`
-	Attacks   string   `json:"attacks"`
-	Skill     int      `json:"skill"`
-	Strength  int      `json:"strength"`
-	AP        int      `json:"ap"`
-	Damage    string   `json:"damage"`
-	Abilities []string `json:"abilities,omitempty"`
-}, preferCategory string) (PvPPlayerData, error) {
+// When leaderID is set the leader is attached to the unit and its weapons can be picked too.
+func canonicalizePlayerData(store *Store, factionID, unitID, leaderID string, models int, requested []PvPWeapon, preferCategory string) (PvPPlayerData, error) {
 	// Validate unit exists and belongs to faction
 	u, ok := store.UnitsByID[unitID]
 	if !ok {
@@ -572,16 +704,23 @@ func canonicalizePlayerData(store *Store, factionID, unitID string, requested []
 		return PvPPlayerData{}, fmt.Errorf("unit %s does not belong to faction %s", unitID, factionID)
 	}
 
-	// Determine unit W from first model (fallback to 10 if not available)
-	hp := 10
-	if models, ok := store.ModelsByDS[unitID]; ok && len(models) > 0 {
-		if n, err := strconv.Atoi(strings.TrimSpace(models[0].W)); err == nil && n > 0 {
-			hp = n
-		}
+	// Build the unit (with its leader) and its models from its composition at the chosen size,
+	// priced from the matching points bracket; HP is the sum of their wounds
+	size, err := unitSize(store, unitID, models)
+	if err != nil {
+		return PvPPlayerData{}, err
 	}
+	unit, err := fieldedUnit(store, factionID, unitID, leaderID, size.Models)
+	if err != nil {
+		return PvPPlayerData{}, err
+	}
+	hp := game.ModelsRemaining(unit.Models)
 
 	// Map unit weapons by name and type string for lookup
 	unitWeapons := store.WeaponsByDS[unitID]
+	if leaderID != "" {
+		unitWeapons = append(append([]Weapon(nil), unitWeapons...), store.WeaponsByDS[leaderID]...)
+	}
 	if len(unitWeapons) == 0 {
 		// Some datasheets may not have weapons; still allow empty but return error if requested > 0
 		if len(requested) > 0 {
@@ -616,16 +755,7 @@ func canonicalizePlayerData(store *Store, factionID, unitID string, requested []
 	}
 
 	// Build canonical weapons and enforce single category
-	canonicalWeapons := make([]struct {
-		Name      string   `json:"name"`
-		Type      string   `json:"type"`
-		Attacks   string   `json:"attacks"`
-		Skill     int      `json:"skill"`
-		Strength  int      `json:"strength"`
-		AP        int      `json:"ap"`
-		Damage    string   `json:"damage"`
-		Abilities []string `json:"abilities,omitempty"`
-	}, 0, len(requested))
+	canonicalWeapons := make([]PvPWeapon, 0, len(requested))
 
 	var category string // "melee" or "ranged"
 	for _, rw := range requested {
@@ -662,34 +792,66 @@ func canonicalizePlayerData(store *Store, factionID, unitID string, requested []
 		if n, err := strconv.Atoi(strings.TrimSpace(cw.AP)); err == nil {
 			ap = n
 		}
-		canonicalWeapons = append(canonicalWeapons, struct {
-			Name      string   `json:"name"`
-			Type      string   `json:"type"`
-			Attacks   string   `json:"attacks"`
-			Skill     int      `json:"skill"`
-			Strength  int      `json:"strength"`
-			AP        int      `json:"ap"`
-			Damage    string   `json:"damage"`
-			Abilities []string `json:"abilities,omitempty"`
-		}{
+		rangeIn := 0
+		if !isM {
+			if n, ok := parseFirstInt(cw.Range); ok {
+				rangeIn = n
+			}
+		}
+		pw := PvPWeapon{
 			Name:      cw.Name,
 			Type:      cw.Type,
+			Range:     Inches(rangeIn),
 			Attacks:   cw.Attacks,
 			Skill:     skill,
 			Strength:  str,
 			AP:        ap,
 			Damage:    cw.Damage,
-			Abilities: rw.Abilities, // abilities may be derived elsewhere; keep client-provided for now
-		})
+			Abilities: cw.Abilities.Tokens(), // canonical abilities from the wargear description, not the client
+		}
+		// A bad Attacks or Damage profile fails here rather than rolling 0 mid-combat
+		if err := pw.snapshot().Validate(); err != nil {
+			return PvPPlayerData{}, err
+		}
+		canonicalWeapons = append(canonicalWeapons, pw)
+	}
+
+	// The picked weapons must be a loadout the datasheets' wargear options allow; a leader's
+	// weapons are checked against the leader's own datasheet
+	var unitPicks, leaderPicks []string
+	for _, cw := range canonicalWeapons {
+		if leaderID != "" && !hasWeapon(store.WeaponsByDS[unitID], cw.Name) {
+			leaderPicks = append(leaderPicks, cw.Name)
+		} else {
+			unitPicks = append(unitPicks, cw.Name)
+		}
+	}
+	if err := checkWargear(store, unitID, unitPicks); err != nil {
+		return PvPPlayerData{}, err
+	}
+	if err := checkWargear(store, leaderID, leaderPicks); err != nil {
+		return PvPPlayerData{}, err
 	}
 
 	// Compose PvPPlayerData
 	out := PvPPlayerData{
 		FactionID: factionID,
 		UnitID:    unitID,
+		LeaderID:  leaderID,
+		Points:    size.Cost + unitPoints(store, leaderID),
 		Weapons:   canonicalWeapons,
+		Models:    unit.Models,
 		HP:        hp,
 		MaxHP:     hp,
+		T:         unit.T,
+		Sv:        unit.Sv,
+		InvSv:     unit.InvSv,
+		InvSaves:  unit.InvSaves,
+		Ld:        unit.Ld,
+		OC:        unit.OC,
+		Keywords:  unit.Keywords,
+		Abilities: unit.Abilities,
+		Damaged:   unit.Damaged,
 		Ready:     true,
 	}
 	return out, nil
@@ -802,33 +964,113 @@ func (l *Lobby) list() []LobbyEntry {
 
 // ================= PvP Match System =================
 type PvPMatch struct {
-	ID          string        `json:"id"`
-	Player1     string        `json:"player1"`
-	Player2     string        `json:"player2"`
-	Status      string        `json:"status"` // "waiting", "active", "finished"
-	Turn        string        `json:"turn"`   // which player's turn
-	Player1Data PvPPlayerData `json:"player1_data,omitempty"`
-	Player2Data PvPPlayerData `json:"player2_data,omitempty"`
-	Created     int64         `json:"created"`
-	Updated     int64         `json:"updated"`
+	ID      string `json:"id"`
+	Player1 string `json:"player1"`
+	Player2 string `json:"player2"`
+	Status  string `json:"status"` // "waiting", "active", "finished"
+	Turn    string `json:"turn"`   // which player's turn
+	// Rules edition or house rules the match is played under (see /api/rulesets)
+	Ruleset string `json:"ruleset,omitempty"`
+	// Battle round, phase and what the active unit has done; set when the match starts
+	State       *game.TurnState `json:"state,omitempty"`
+	Player1Data PvPPlayerData   `json:"player1_data,omitempty"`
+	Player2Data PvPPlayerData   `json:"player2_data,omitempty"`
+	Created     int64           `json:"created"`
+	Updated     int64           `json:"updated"`
+}
+
+// PvPWeapon is a weapon profile as submitted by clients and stored on a player's loadout
+type PvPWeapon struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Range     Inches   `json:"range,omitempty"` // 0 for melee
+	Attacks   string   `json:"attacks"`
+	Skill     int      `json:"skill"`
+	Strength  int      `json:"strength"`
+	AP        int      `json:"ap"`
+	Damage    string   `json:"damage"`
+	Abilities []string `json:"abilities,omitempty"`
+}
+
+// Inches is a distance in inches. It decodes from a JSON number or from the
+// datasheet's string form ("24", "24\"", "Melee"), since the UI echoes the latter.
+type Inches int
+
+func (in *Inches) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*in = Inches(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return fmt.Errorf("range must be a number or string: %s", string(b))
+	}
+	v, _ := parseFirstInt(str) // "Melee" and "" have no range
+	*in = Inches(v)
+	return nil
+}
+
+func (w PvPWeapon) snapshot() game.WeaponSnapshot {
+	return game.WeaponSnapshot{Name: w.Name, Type: w.Type, Range: int(w.Range), Attacks: w.Attacks, Skill: w.Skill, Strength: w.Strength, AP: w.AP, Damage: w.Damage, Abilities: w.Abilities}
+}
+
+func weaponSnapshots(ws []PvPWeapon) []game.WeaponSnapshot {
+	out := make([]game.WeaponSnapshot, 0, len(ws))
+	for _, w := range ws {
+		out = append(out, w.snapshot())
+	}
+	return out
+}
+
+// mainMeleeWeapon returns the index of the first melee weapon that isn't an Extra
+// Attacks weapon, or -1 if there is none
+func mainMeleeWeapon(ws []PvPWeapon) int {
+	for i, w := range ws {
+		if w.snapshot().IsMelee() && !game.ParseWeaponAbilities(w.Abilities...).ExtraAttacks {
+			return i
+		}
+	}
+	return -1
 }
 
 type PvPPlayerData struct {
-	FactionID string `json:"faction_id"`
-	UnitID    string `json:"unit_id"`
-	Weapons   []struct {
-		Name      string   `json:"name"`
-		Type      string   `json:"type"`
-		Attacks   string   `json:"attacks"`
-		Skill     int      `json:"skill"`
-		Strength  int      `json:"strength"`
-		AP        int      `json:"ap"`
-		Damage    string   `json:"damage"`
-		Abilities []string `json:"abilities,omitempty"`
-	} `json:"weapons"`
-	HP    int  `json:"hp"`
-	MaxHP int  `json:"max_hp"`
-	Ready bool `json:"ready"`
+	FactionID string      `json:"faction_id"`
+	UnitID    string      `json:"unit_id"`
+	Weapons   []PvPWeapon `json:"weapons"`
+	// Models in the unit with their remaining wounds; HP is their sum
+	Models []game.ModelState `json:"models,omitempty"`
+	HP     int               `json:"hp"`
+	MaxHP  int               `json:"max_hp"`
+	Ready  bool              `json:"ready"`
+	// Ruleset the player queued for; players are only matched with the same one
+	Ruleset string `json:"ruleset,omitempty"`
+	// Characteristics of the unit (the bodyguard's when led); 0 falls back to T4 Sv3+
+	T     int `json:"T,omitempty"`
+	Sv    int `json:"Sv,omitempty"`
+	InvSv int `json:"inv_sv,omitempty"`
+	Ld    int `json:"ld,omitempty"` // Leadership for Battle-shock tests
+	// Invulnerable saves that only apply against some attacks or to some models
+	InvSaves []game.InvulnSave `json:"inv_saves,omitempty"`
+	// Unit keywords (not faction keywords), e.g. Infantry, Character
+	Keywords []string `json:"keywords,omitempty"`
+	// Unit abilities, including the leader's when one is attached (see leader_id)
+	Abilities []string `json:"abilities,omitempty"`
+	// Leader attached to the unit; its models are part of Models
+	LeaderID string `json:"leader_id,omitempty"`
+	// Enhancement taken by the unit's character (the leader when attached)
+	Enhancement string `json:"enhancement,omitempty"`
+	// Points cost of the unit, its leader and enhancement
+	Points int `json:"points,omitempty"`
+	// Damaged bracket of a vehicle or monster, and whether it has dropped into it
+	Damaged  *game.DamagedProfile `json:"damaged_profile,omitempty"`
+	Degraded bool                 `json:"damaged,omitempty"`
+	OC       int                  `json:"oc,omitempty"` // Objective Control characteristic
+	// Detachment picked when queueing, and its abilities the engine applies to this unit
+	Detachment      string   `json:"detachment,omitempty"`
+	DetachmentRules []string `json:"detachment_rules,omitempty"`
+	// Readied to Fire Overwatch at the next charge against this unit
+	Overwatch bool `json:"overwatch,omitempty"`
 }
 
 type PvPMatchmaker struct {
@@ -906,11 +1148,11 @@ func (p *PvPMatchmaker) removeFromQueue(playerName string) {
 	delete(p.queue, playerName)
 }
 
-func (p *PvPMatchmaker) findWaitingPlayer(excludePlayer string) *PvPQueueEntry {
+func (p *PvPMatchmaker) findWaitingPlayer(excludePlayer, ruleset string) *PvPQueueEntry {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	for name, data := range p.queue {
-		if name != excludePlayer {
+		if name != excludePlayer && data.Ruleset == ruleset {
 			return &PvPQueueEntry{name: name, data: data}
 		}
 	}
@@ -937,7 +1179,9 @@ type MatchEntry struct {
 	Attacker game.UnitSnapshot   `json:"attacker"`
 	Defender game.UnitSnapshot   `json:"defender"`
 	Weapon   game.WeaponSnapshot `json:"weapon"`
-	Result   game.ShootingResult `json:"result"`
+	Result   game.ShootingResult `json:"result"` // its Events are the structured record of the action
+	// Set for a Command phase Battle-shock test instead of an attack
+	BattleShock *game.BattleShockTest `json:"battle_shock,omitempty"`
 }
 
 type MatchRecord struct {
@@ -1165,26 +1409,38 @@ func main() {
 				InvSv     int      `json:"InvSv"`
 				Keywords  []string `json:"keywords,omitempty"`
 				Abilities []string `json:"abilities,omitempty"`
+				// Optional conditional invulnerable saves, e.g. [{"tn": 5, "against": "ranged"}]
+				InvSaves []game.InvulnSave `json:"inv_saves,omitempty"`
+				// Optional per-model wounds; without it the defender is one model with W wounds
+				Models []game.ModelState `json:"models,omitempty"`
 			} `json:"defender"`
-			Weapon struct {
-				Name      string   `json:"name"`
-				Type      string   `json:"type"`
-				Attacks   string   `json:"attacks"`
-				Skill     int      `json:"skill"`
-				Strength  int      `json:"strength"`
-				AP        int      `json:"ap"`
-				Damage    string   `json:"damage"`
-				Abilities []string `json:"abilities,omitempty"`
-			} `json:"weapon"`
-			MatchID string `json:"match_id,omitempty"`
+			Weapon  PvPWeapon `json:"weapon"`
+			MatchID string    `json:"match_id,omitempty"`
+			// Optional dice seed; reuse the seed echoed in a previous result to replay it
+			Seed *int64 `json:"seed,omitempty"`
+			// Optional distance to the target in inches; enables range checks and half-range rules
+			Distance int `json:"distance,omitempty"`
+			// Optional roll modifiers (buffs/debuffs) and the situations that trigger ability modifiers
+			Modifiers    game.Modifiers `json:"modifiers,omitempty"`
+			Stationary   bool           `json:"stationary,omitempty"`
+			Charged      bool           `json:"charged,omitempty"`
+			TargetHidden bool           `json:"target_hidden,omitempty"`
+			Cover        bool           `json:"cover,omitempty"`
+			// Optional re-roll policy per stage, e.g. {"hit": "ones", "wound": "failed", "damage": "single"};
+			// "ones+single" adds a single re-roll to "ones"; attacks and damage take "ones", "single" or "ones+single"
+			Rerolls game.Rerolls `json:"rerolls,omitempty"`
+			// Optional critical hit / wound thresholds (e.g. 5 for "critical on 5+"); default 6
+			CritHit   int `json:"crit_hit,omitempty"`
+			CritWound int `json:"crit_wound,omitempty"`
+			// Optional ruleset by name (see /api/rulesets); default 10th edition
+			Ruleset string `json:"ruleset,omitempty"`
 			Meta    struct {
 				Actor string `json:"actor,omitempty"`
 				Round int    `json:"round,omitempty"`
 				Step  int    `json:"step,omitempty"`
 			} `json:"meta,omitempty"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid JSON")
+		if !decodeSimRequest(w, r, &req) {
 			return
 		}
 
@@ -1204,10 +1460,35 @@ func main() {
 				return
 			}
 		}
+		rules, err := game.RulesetByName(req.Ruleset)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		att := game.UnitSnapshot{ID: req.Attacker.ID, Name: req.Attacker.Name, T: req.Attacker.T, W: req.Attacker.W, Sv: req.Attacker.Sv, InvSv: req.Attacker.InvSv, Keywords: req.Attacker.Keywords, Abilities: req.Attacker.Abilities}
-		def := game.UnitSnapshot{ID: req.Defender.ID, Name: req.Defender.Name, T: req.Defender.T, W: req.Defender.W, Sv: req.Defender.Sv, InvSv: req.Defender.InvSv, Keywords: req.Defender.Keywords, Abilities: req.Defender.Abilities}
-		wep := game.WeaponSnapshot{Name: req.Weapon.Name, Type: req.Weapon.Type, Attacks: req.Weapon.Attacks, Skill: req.Weapon.Skill, Strength: req.Weapon.Strength, AP: req.Weapon.AP, Damage: req.Weapon.Damage, Abilities: req.Weapon.Abilities}
-		res := game.ResolveShooting(att, def, wep)
+		def := game.UnitSnapshot{ID: req.Defender.ID, Name: req.Defender.Name, T: req.Defender.T, W: req.Defender.W, Sv: req.Defender.Sv, InvSv: req.Defender.InvSv, InvSaves: req.Defender.InvSaves, Keywords: req.Defender.Keywords, Abilities: req.Defender.Abilities, Models: req.Defender.Models}
+		wep := req.Weapon.snapshot()
+		if err := wep.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		res, err := game.ResolveShootingWith(att, def, wep, game.ShootingOptions{
+			Roller:       rollerFor(req.Seed),
+			Distance:     req.Distance,
+			Stationary:   req.Stationary,
+			Charged:      req.Charged,
+			TargetHidden: req.TargetHidden,
+			Cover:        req.Cover,
+			Modifiers:    req.Modifiers,
+			Rerolls:      req.Rerolls,
+			CritHit:      req.CritHit,
+			CritWound:    req.CritWound,
+			Ruleset:      rules,
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		// Append to match log if provided
 		if strings.TrimSpace(req.MatchID) != "" {
 			entry := MatchEntry{
@@ -1237,37 +1518,32 @@ func main() {
 		}
 		var req struct {
 			A struct {
-				Name      string `json:"name"`
-				FactionID string `json:"faction_id"`
-				UnitID    string `json:"unit_id"`
-				Weapons   []struct {
-					Name      string   `json:"name"`
-					Type      string   `json:"type"`
-					Attacks   string   `json:"attacks"`
-					Skill     int      `json:"skill"`
-					Strength  int      `json:"strength"`
-					AP        int      `json:"ap"`
-					Damage    string   `json:"damage"`
-					Abilities []string `json:"abilities,omitempty"`
-				} `json:"weapons"`
+				Name      string      `json:"name"`
+				FactionID string      `json:"faction_id"`
+				UnitID    string      `json:"unit_id"`
+				Weapons   []PvPWeapon `json:"weapons"`
+				Models    int         `json:"models,omitempty"` // unit size; 0 for the smallest
 			} `json:"a"`
 			B struct {
-				Name      string `json:"name"`
-				FactionID string `json:"faction_id"`
-				UnitID    string `json:"unit_id"`
-				Weapons   []struct {
-					Name      string   `json:"name"`
-					Type      string   `json:"type"`
-					Attacks   string   `json:"attacks"`
-					Skill     int      `json:"skill"`
-					Strength  int      `json:"strength"`
-					AP        int      `json:"ap"`
-					Damage    string   `json:"damage"`
-					Abilities []string `json:"abilities,omitempty"`
-				} `json:"weapons"`
+				Name      string      `json:"name"`
+				FactionID string      `json:"faction_id"`
+				UnitID    string      `json:"unit_id"`
+				Weapons   []PvPWeapon `json:"weapons"`
+				Models    int         `json:"models,omitempty"` // unit size; 0 for the smallest
 			} `json:"b"`
-			Trials int  `json:"trials"`
-			Rotate bool `json:"rotate"`
+			Trials   int  `json:"trials"`
+			Rotate   bool `json:"rotate"`
+			Distance int  `json:"distance,omitempty"` // inches between the units; 0 ignores range
+			// Melee matchups: declared charge distance (default 7") and whether the
+			// defender fires Overwatch with its first ranged weapon
+			ChargeDistance int  `json:"charge_distance,omitempty"`
+			Overwatch      bool `json:"overwatch,omitempty"`
+			// Optional early stop once both win rates' 95% intervals are within ±precision
+			Precision float64 `json:"precision,omitempty"`
+			// Optional dice seed; with no precision the same seed replays the same result
+			Seed int64 `json:"seed,omitempty"`
+			// Optional ruleset by name (see /api/rulesets); default 10th edition
+			Ruleset string `json:"ruleset,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON")
@@ -1277,9 +1553,6 @@ func main() {
 			writeError(w, http.StatusBadRequest, "missing units")
 			return
 		}
-		if req.Trials <= 0 || req.Trials > 5000 {
-			req.Trials = 400
-		}
 
 		// Canonicalize both sides; enforce same category if either side has weapons
 		prefer := ""
@@ -1296,85 +1569,118 @@ func main() {
 				prefer = "ranged"
 			}
 		}
-		aData, err := canonicalizePlayerData(store, req.A.FactionID, req.A.UnitID, req.A.Weapons, prefer)
+		aData, err := canonicalizePlayerData(store, req.A.FactionID, req.A.UnitID, "", req.A.Models, req.A.Weapons, prefer)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, "A: "+err.Error())
 			return
 		}
-		bData, err := canonicalizePlayerData(store, req.B.FactionID, req.B.UnitID, req.B.Weapons, prefer)
+		bData, err := canonicalizePlayerData(store, req.B.FactionID, req.B.UnitID, "", req.B.Models, req.B.Weapons, prefer)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, "B: "+err.Error())
 			return
 		}
 
-		// Simulation loop
-		aWins, bWins := 0, 0
-		totalRounds := 0
-		for t := 0; t < req.Trials; t++ {
-			aHP := aData.MaxHP
-			bHP := bData.MaxHP
-			turn := 0 // 0 -> A, 1 -> B
-			round := 1
-			for step := 0; step < 1000; step++ { // safety cap
-				if turn == 0 {
-					// A attacks B
-					if len(aData.Weapons) == 0 {
-						bWins++
-						break
-					}
-					idx := 0
-					if req.Rotate && len(aData.Weapons) > 0 {
-						idx = (round - 1) % len(aData.Weapons)
-					}
-					w := aData.Weapons[idx]
-					att := game.UnitSnapshot{ID: req.A.UnitID, Name: req.A.Name, T: 4, W: aHP, Sv: 3}
-					def := game.UnitSnapshot{ID: req.B.UnitID, Name: req.B.Name, T: 4, W: bHP, Sv: 3}
-					wep := game.WeaponSnapshot{Name: w.Name, Type: w.Type, Attacks: w.Attacks, Skill: w.Skill, Strength: w.Strength, AP: w.AP, Damage: w.Damage, Abilities: w.Abilities}
-					res := game.ResolveShooting(att, def, wep)
-					bHP -= res.DamageTotal
-					if bHP <= 0 {
-						aWins++
-						totalRounds += round
-						break
-					}
-					turn = 1
-				} else {
-					// B attacks A
-					if len(bData.Weapons) == 0 {
-						aWins++
-						break
-					}
-					idx := 0
-					if req.Rotate && len(bData.Weapons) > 0 {
-						idx = (round - 1) % len(bData.Weapons)
-					}
-					w := bData.Weapons[idx]
-					att := game.UnitSnapshot{ID: req.B.UnitID, Name: req.B.Name, T: 4, W: bHP, Sv: 3}
-					def := game.UnitSnapshot{ID: req.A.UnitID, Name: req.A.Name, T: 4, W: aHP, Sv: 3}
-					wep := game.WeaponSnapshot{Name: w.Name, Type: w.Type, Attacks: w.Attacks, Skill: w.Skill, Strength: w.Strength, AP: w.AP, Damage: w.Damage, Abilities: w.Abilities}
-					res := game.ResolveShooting(att, def, wep)
-					aHP -= res.DamageTotal
-					if aHP <= 0 {
-						bWins++
-						totalRounds += round
-						break
-					}
-					turn = 0
-					round++
+		// Every weapon that may be used must reach the target
+		for _, d := range []PvPPlayerData{aData, bData} {
+			for _, wp := range d.Weapons {
+				if err := game.CheckRange(wp.snapshot(), req.Distance); err != nil {
+					writeError(w, http.StatusBadRequest, err.Error())
+					return
 				}
 			}
 		}
-		writeJSON(w, map[string]any{
-			"a_win_rate": float64(aWins) / float64(req.Trials),
-			"b_win_rate": float64(bWins) / float64(req.Trials),
-			"trials":     req.Trials,
-			"avg_rounds": func() float64 {
-				if aWins+bWins == 0 {
-					return 0
-				}
-				return float64(totalRounds) / float64(aWins+bWins)
-			}(),
+		chargeDist := req.ChargeDistance
+		if chargeDist <= 0 {
+			chargeDist = defaultChargeDistance
+		}
+		rules, err := game.RulesetByName(req.Ruleset)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// side builds a simulation side from a player's loadout: the unit as a PvP match
+		// fields it (its own characteristics and saves) at full wounds, with its weapons
+		side := func(id, name string, d PvPPlayerData) sim.Side {
+			u := pvpSnapshot(name, &d)
+			u.ID, u.W = id, d.MaxHP
+			return sim.Side{Unit: u, Weapons: weaponSnapshots(d.Weapons)}
+		}
+		res, err := sim.Run(sim.Config{
+			A:              side(req.A.UnitID, req.A.Name, aData),
+			B:              side(req.B.UnitID, req.B.Name, bData),
+			Trials:         req.Trials,
+			Rotate:         req.Rotate,
+			Distance:       req.Distance,
+			ChargeDistance: chargeDist,
+			Overwatch:      req.Overwatch,
+			Precision:      req.Precision,
+			Seed:           req.Seed,
+			Ruleset:        rules,
 		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, res)
+	})
+
+	// GET /api/rulesets - names of the rulesets matches and simulations can select
+	mux.HandleFunc("/api/rulesets", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"default": game.DefaultRuleset.Name(), "rulesets": game.RulesetNames()})
+	})
+
+	// Exact damage distribution for one weapon volley (mathhammer, no sampling noise)
+	mux.HandleFunc("/api/sim/distribution", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "POST only")
+			return
+		}
+		var req struct {
+			Attacker     game.UnitSnapshot `json:"attacker"`
+			Defender     game.UnitSnapshot `json:"defender"`
+			Weapon       PvPWeapon         `json:"weapon"`
+			Distance     int               `json:"distance,omitempty"`
+			Modifiers    game.Modifiers    `json:"modifiers,omitempty"`
+			Stationary   bool              `json:"stationary,omitempty"`
+			Charged      bool              `json:"charged,omitempty"`
+			TargetHidden bool              `json:"target_hidden,omitempty"`
+			Cover        bool              `json:"cover,omitempty"`
+			Rerolls      game.Rerolls      `json:"rerolls,omitempty"`
+			CritHit      int               `json:"crit_hit,omitempty"`
+			CritWound    int               `json:"crit_wound,omitempty"`
+			Ruleset      string            `json:"ruleset,omitempty"`
+		}
+		if !decodeSimRequest(w, r, &req) {
+			return
+		}
+		rules, err := game.RulesetByName(req.Ruleset)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		wep := req.Weapon.snapshot()
+		if err := wep.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		dist, err := game.DamageDistribution(req.Attacker, req.Defender, wep, game.ShootingOptions{
+			Distance:     req.Distance,
+			Stationary:   req.Stationary,
+			Charged:      req.Charged,
+			TargetHidden: req.TargetHidden,
+			Cover:        req.Cover,
+			Modifiers:    req.Modifiers,
+			Rerolls:      req.Rerolls,
+			CritHit:      req.CritHit,
+			CritWound:    req.CritWound,
+			Ruleset:      rules,
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, dist)
 	})
 
 	// GET /api/match/{id} -> full match log
@@ -1451,21 +1757,22 @@ func main() {
 			return
 		}
 		var req struct {
-			Name      string `json:"name"`
-			FactionID string `json:"faction_id"`
-			UnitID    string `json:"unit_id"`
-			Weapons   []struct {
-				Name      string   `json:"name"`
-				Type      string   `json:"type"`
-				Attacks   string   `json:"attacks"`
-				Skill     int      `json:"skill"`
-				Strength  int      `json:"strength"`
-				AP        int      `json:"ap"`
-				Damage    string   `json:"damage"`
-				Abilities []string `json:"abilities,omitempty"`
-			} `json:"weapons"`
-			HP    int `json:"hp"`
-			MaxHP int `json:"max_hp"`
+			Name      string      `json:"name"`
+			FactionID string      `json:"faction_id"`
+			UnitID    string      `json:"unit_id"`
+			Weapons   []PvPWeapon `json:"weapons"`
+			HP        int         `json:"hp"`
+			MaxHP     int         `json:"max_hp"`
+			// Optional detachment of the unit's faction, by name (see /api/{faction}/detachments)
+			Detachment string `json:"detachment"`
+			// Optional leader to attach to the unit (see /api/{faction}/{unit_id}/leaders)
+			LeaderID string `json:"leader_id"`
+			// Optional unit size in models (see /api/{faction}/{unit_id}/sizes); 0 for the smallest
+			Models int `json:"models"`
+			// Optional enhancement (id or name) for the unit's character, from the detachment
+			Enhancement string `json:"enhancement"`
+			// Optional ruleset by name (see /api/rulesets); default 10th edition
+			Ruleset string `json:"ruleset"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON")
@@ -1482,7 +1789,7 @@ func main() {
 		if existingMatch := pvpMatchmaker.findMatchForPlayer(playerName); existingMatch != nil {
 			// If both players are already ready but match is still waiting, activate it now
 			if existingMatch.Status == "waiting" && existingMatch.Player1Data.Ready && existingMatch.Player2Data.Ready {
-				existingMatch.Status = "active"
+				existingMatch.start()
 				pvpMatchmaker.updateMatch(existingMatch)
 				// Update lobby phases to in-game
 				lobby.setPhase(existingMatch.Player1, "in-game")
@@ -1496,18 +1803,33 @@ func main() {
 		}
 
 		// Canonicalize player's submitted data against server datastore (legality checks)
-		playerData, err := canonicalizePlayerData(store, req.FactionID, req.UnitID, req.Weapons, "")
+		playerData, err := canonicalizePlayerData(store, req.FactionID, req.UnitID, req.LeaderID, req.Models, req.Weapons, "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := applyDetachment(store, &playerData, req.Detachment); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := applyEnhancement(store, &playerData, req.Enhancement); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rules, err := game.RulesetByName(req.Ruleset)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		playerData.Ruleset = rules.Name()
 
-		// Look for another player in PvP queue
-		waitingPlayer := pvpMatchmaker.findWaitingPlayer(playerName)
+		// Look for another player in PvP queue playing the same ruleset
+		waitingPlayer := pvpMatchmaker.findWaitingPlayer(playerName, playerData.Ruleset)
 
 		if waitingPlayer == nil {
-			// No opponent found, add this player to PvP queue
+			// No opponent found, add this player to PvP queue; the lobby shows the unit's real cost
 			pvpMatchmaker.addToQueue(playerName, playerData)
+			lobby.setPhasePoints(playerName, "queue", playerData.Points)
 
 			writeJSON(w, map[string]interface{}{
 				"status":  "queued",
@@ -1518,6 +1840,7 @@ func main() {
 
 		// Create match between this player and waiting opponent
 		match := pvpMatchmaker.createMatch(playerName, waitingPlayer.name)
+		match.Ruleset = playerData.Ruleset
 
 		// Set player data for both players
 		currentPlayerData := playerData
@@ -1534,7 +1857,7 @@ func main() {
 
 		// If both players are already ready (typical queue match), activate immediately
 		if match.Player1Data.Ready && match.Player2Data.Ready {
-			match.Status = "active"
+			match.start()
 			pvpMatchmaker.updateMatch(match)
 			// Set lobby phases to in-game
 			lobby.setPhase(match.Player1, "in-game")
@@ -1568,7 +1891,7 @@ func main() {
 		}
 		// Auto-activate if both players are ready but status hasn't updated yet
 		if match.Status == "waiting" && match.Player1Data.Ready && match.Player2Data.Ready {
-			match.Status = "active"
+			match.start()
 			pvpMatchmaker.updateMatch(match)
 			lobby.setPhase(match.Player1, "in-game")
 			lobby.setPhase(match.Player2, "in-game")
@@ -1589,21 +1912,20 @@ func main() {
 		}
 
 		var req struct {
-			Name      string `json:"name"`
-			FactionID string `json:"faction_id"`
-			UnitID    string `json:"unit_id"`
-			Weapons   []struct {
-				Name      string   `json:"name"`
-				Type      string   `json:"type"`
-				Attacks   string   `json:"attacks"`
-				Skill     int      `json:"skill"`
-				Strength  int      `json:"strength"`
-				AP        int      `json:"ap"`
-				Damage    string   `json:"damage"`
-				Abilities []string `json:"abilities,omitempty"`
-			} `json:"weapons"`
-			HP    int `json:"hp"`
-			MaxHP int `json:"max_hp"`
+			Name      string      `json:"name"`
+			FactionID string      `json:"faction_id"`
+			UnitID    string      `json:"unit_id"`
+			Weapons   []PvPWeapon `json:"weapons"`
+			HP        int         `json:"hp"`
+			MaxHP     int         `json:"max_hp"`
+			// Optional detachment of the unit's faction, by name (see /api/{faction}/detachments)
+			Detachment string `json:"detachment"`
+			// Optional leader to attach to the unit (see /api/{faction}/{unit_id}/leaders)
+			LeaderID string `json:"leader_id"`
+			// Optional unit size in models (see /api/{faction}/{unit_id}/sizes); 0 for the smallest
+			Models int `json:"models"`
+			// Optional enhancement (id or name) for the unit's character, from the detachment
+			Enhancement string `json:"enhancement"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON")
@@ -1627,17 +1949,25 @@ func main() {
 					prefer = "ranged"
 				}
 			}
-			player2Data, err := canonicalizePlayerData(store, req.FactionID, req.UnitID, req.Weapons, prefer)
+			player2Data, err := canonicalizePlayerData(store, req.FactionID, req.UnitID, req.LeaderID, req.Models, req.Weapons, prefer)
 			if err != nil {
 				writeError(w, http.StatusBadRequest, err.Error())
 				return
 			}
+			if err := applyDetachment(store, &player2Data, req.Detachment); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := applyEnhancement(store, &player2Data, req.Enhancement); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
 			// Player 2 joining with canonical data
 			match.Player2Data = player2Data
 
 			// If both players are ready, start the match
 			if match.Player1Data.Ready && match.Player2Data.Ready {
-				match.Status = "active"
+				match.start()
 				lobby.setPhase(match.Player1, "in-game")
 				lobby.setPhase(match.Player2, "in-game")
 			}
@@ -1653,7 +1983,7 @@ func main() {
 		writeError(w, http.StatusBadRequest, "cannot join this match")
 	})
 
-	// POST /api/pvp/action/{id} - Submit combat action (shooting)
+	// POST /api/pvp/action/{id} - Submit an action for the current phase (see pvpActionRequest)
 	mux.HandleFunc("/api/pvp/action/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeError(w, http.StatusMethodNotAllowed, "POST only")
@@ -1665,10 +1995,7 @@ func main() {
 			return
 		}
 
-		var req struct {
-			Player   string `json:"player"`
-			WeaponID int    `json:"weapon_id"` // index into player's weapons array
-		}
+		var req pvpActionRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON")
 			return
@@ -1685,100 +2012,56 @@ func main() {
 			return
 		}
 
-		if match.Turn != req.Player {
-			writeError(w, http.StatusBadRequest, "not your turn")
-			return
+		round := 0
+		if match.State != nil {
+			round = match.State.Round
 		}
-
-		// Determine attacker and defender
-		var attackerData, defenderData *PvPPlayerData
-		var defender string
-
-		if req.Player == match.Player1 {
-			attackerData = &match.Player1Data
-			defenderData = &match.Player2Data
-			defender = match.Player2
-		} else if req.Player == match.Player2 {
-			attackerData = &match.Player2Data
-			defenderData = &match.Player1Data
-			defender = match.Player1
+		var out pvpActionResult
+		var err error
+		if req.Action == pvpActionStratagem {
+			out, err = usePvPStratagem(store, match, req)
 		} else {
-			writeError(w, http.StatusBadRequest, "invalid player")
-			return
+			out, err = applyPvPAction(match, req)
 		}
-
-		// Validate weapon selection
-		if req.WeaponID < 0 || req.WeaponID >= len(attackerData.Weapons) {
-			writeError(w, http.StatusBadRequest, "invalid weapon")
+		// The Battle-shock step has happened even if the action itself was refused
+		if rec := logPvPAction(matches, match, req, round, out); rec != nil && matchPersistDir != "" {
+			saveMatchRecord(matchPersistDir, rec)
+		}
+		if err != nil {
+			code := http.StatusBadRequest
+			if _, ok := err.(errUnsupportedStratagem); ok {
+				code = http.StatusUnprocessableEntity
+			}
+			writeError(w, code, err.Error())
 			return
 		}
+		if match.Status == "finished" {
+			lobby.setPhase(match.Player1, "idle")
+			lobby.setPhase(match.Player2, "idle")
+		}
 
-		weapon := attackerData.Weapons[req.WeaponID]
+		pvpMatchmaker.updateMatch(match)
 
-		// Build unit snapshots for combat resolution
-		attacker := game.UnitSnapshot{
-			ID:        req.Player,
-			Name:      req.Player,
-			T:         4, // These would come from unit data in a full implementation
-			W:         attackerData.HP,
-			Sv:        3,
-			InvSv:     0,
-			Keywords:  []string{},
-			Abilities: []string{},
+		resp := map[string]interface{}{
+			"match":         match,
+			"legal_actions": match.State.LegalActions(),
 		}
-
-		def := game.UnitSnapshot{
-			ID:        defender,
-			Name:      defender,
-			T:         4,
-			W:         defenderData.HP,
-			Sv:        3,
-			InvSv:     0,
-			Keywords:  []string{},
-			Abilities: []string{},
+		if out.Result != nil {
+			resp["result"] = out.Result
 		}
-
-		wep := game.WeaponSnapshot{
-			Name:      weapon.Name,
-			Type:      weapon.Type,
-			Attacks:   weapon.Attacks,
-			Skill:     weapon.Skill,
-			Strength:  weapon.Strength,
-			AP:        weapon.AP,
-			Damage:    weapon.Damage,
-			Abilities: weapon.Abilities,
+		if out.Fight != nil {
+			resp["fight"] = out.Fight
 		}
-
-		// Resolve combat
-		result := game.ResolveShooting(attacker, def, wep)
-
-		// Update defender HP
-		newHP := defenderData.HP - (result.DamageTotal)
-		if newHP < 0 {
-			newHP = 0
+		if out.Charge != nil {
+			resp["charge"] = out.Charge
 		}
-		defenderData.HP = newHP
-
-		// Check for victory
-		if defenderData.HP <= 0 {
-			match.Status = "finished"
-			lobby.setPhase(match.Player1, "idle")
-			lobby.setPhase(match.Player2, "idle")
-		} else {
-			// Switch turns
-			if match.Turn == match.Player1 {
-				match.Turn = match.Player2
-			} else {
-				match.Turn = match.Player1
-			}
+		if out.BattleShock != nil {
+			resp["battle_shock"] = out.BattleShock
 		}
-
-		pvpMatchmaker.updateMatch(match)
-
-		writeJSON(w, map[string]interface{}{
-			"result": result,
-			"match":  match,
-		})
+		if out.Stratagem != nil {
+			resp["stratagem"] = out.Stratagem
+		}
+		writeJSON(w, resp)
 	})
 
 	// GET /api/pvp/debug - Debug endpoint to check queue state
@@ -1871,6 +2154,43 @@ func main() {
 			return
 		}
 		switch parts[1] {
+		case "detachments":
+			list := store.DetachmentsByFac[faction]
+			if list == nil {
+				list = []Detachment{}
+			}
+			writeJSON(w, list)
+			return
+		case "enhancements":
+			// Faction enhancements, optionally of one detachment (?detachment=)
+			list := []Enhancement{}
+			for _, e := range store.EnhancementsByFac[faction] {
+				if d := r.URL.Query().Get("detachment"); d != "" && !strings.EqualFold(e.Detachment, d) {
+					continue
+				}
+				list = append(list, e)
+			}
+			writeJSON(w, list)
+			return
+		case "stratagems":
+			// Faction stratagems, optionally of one detachment (?detachment=), plus ?core=true for the Core ones
+			q := r.URL.Query()
+			list := []Stratagem{}
+			for _, st := range store.StratagemsByFac[faction] {
+				if d := q.Get("detachment"); d != "" && !strings.EqualFold(st.Detachment, d) {
+					continue
+				}
+				list = append(list, st)
+			}
+			if q.Get("core") == "true" {
+				for _, st := range store.StratagemsByFac[""] {
+					if st.isCore() {
+						list = append(list, st)
+					}
+				}
+			}
+			writeJSON(w, list)
+			return
 		case "units":
 			units := store.UnitsByFac[faction]
 			q := r.URL.Query()
@@ -1911,25 +2231,11 @@ func main() {
 					eu.T = strings.TrimSpace(models[0].T)
 					eu.W = strings.TrimSpace(models[0].W)
 				}
-				// add points: choose the minimum cost entry if multiple
-				if costs, ok := store.CostsByDS[u.ID]; ok && len(costs) > 0 {
-					min := -1
-					for _, c := range costs {
-						n, err := strconv.Atoi(strings.TrimSpace(c.Cost))
-						if err != nil {
-							continue
-						}
-						if n <= 0 {
-							continue
-						}
-						if min < 0 || n < min {
-							min = n
-						}
-					}
-					if min > 0 {
-						eu.Points = strconv.Itoa(min)
-					}
+				// add points: the smallest size's bracket, with every bracket listed under sizes
+				if pts := unitPoints(store, u.ID); pts > 0 {
+					eu.Points = strconv.Itoa(pts)
 				}
+				eu.Sizes = unitSizes(store, u.ID)
 				enriched[i] = eu
 			}
 			units = enriched
@@ -1965,24 +2271,10 @@ func main() {
 							eu.T = strings.TrimSpace(models[0].T)
 							eu.W = strings.TrimSpace(models[0].W)
 						}
-						if costs, ok := store.CostsByDS[u.ID]; ok && len(costs) > 0 {
-							min := -1
-							for _, c := range costs {
-								n, err := strconv.Atoi(strings.TrimSpace(c.Cost))
-								if err != nil {
-									continue
-								}
-								if n <= 0 {
-									continue
-								}
-								if min < 0 || n < min {
-									min = n
-								}
-							}
-							if min > 0 {
-								eu.Points = strconv.Itoa(min)
-							}
+						if pts := unitPoints(store, u.ID); pts > 0 {
+							eu.Points = strconv.Itoa(pts)
 						}
+						eu.Sizes = unitSizes(store, u.ID)
 						writeJSON(w, eu)
 						return
 					}
@@ -2027,6 +2319,15 @@ func main() {
 							writeJSON(w, list)
 						}
 						return
+					case "sizes":
+						{
+							list := unitSizes(store, unitID)
+							if list == nil {
+								list = []UnitSize{}
+							}
+							writeJSON(w, list)
+						}
+						return
 					case "options":
 						{
 							list := store.OptionsByDS[unitID]
@@ -2036,6 +2337,15 @@ func main() {
 							writeJSON(w, list)
 						}
 						return
+					case "composition":
+						{
+							list := store.CompositionByDS[unitID]
+							if list == nil {
+								list = []CompositionLine{}
+							}
+							writeJSON(w, list)
+						}
+						return
 					case "costs":
 						{
 							list := store.CostsByDS[unitID]
@@ -2045,6 +2355,19 @@ func main() {
 							writeJSON(w, list)
 						}
 						return
+					case "stratagems":
+						writeJSON(w, unitStratagems(store, unitID))
+						return
+					case "enhancements":
+						list := store.EnhancementsByDS[unitID]
+						if list == nil {
+							list = []Enhancement{}
+						}
+						writeJSON(w, list)
+						return
+					case "leaders":
+						writeJSON(w, unitLeaderAttachments(store, faction, unitID))
+						return
 					}
 				}
 			}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSimRequest(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		ok   bool
+		code int
+	}{
+		{"valid", `{"weapon":{"name":"Bolter","attacks":"2","damage":"1"}}`, true, http.StatusOK},
+		{"invalid JSON", `{"weapon":`, false, http.StatusBadRequest},
+		{"too large", `{"weapon":{"name":"` + strings.Repeat("x", maxSimRequestBytes) + `"}}`, false, http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		var req struct {
+			Weapon PvPWeapon `json:"weapon"`
+		}
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/sim/distribution", strings.NewReader(c.body))
+		if ok := decodeSimRequest(rec, r, &req); ok != c.ok || rec.Code != c.code {
+			t.Errorf("%s: ok %v status %d, want %v %d", c.name, ok, rec.Code, c.ok, c.code)
+		}
+	}
+}
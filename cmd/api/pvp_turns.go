@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// defaultChargeDistance is the declared charge distance when a request doesn't give one
+const defaultChargeDistance = 7
+
+// pvpActionOverwatch is a reaction, not a turn action: the player whose turn it isn't
+// readies their unit to Fire Overwatch at the next charge against it
+const pvpActionOverwatch game.ActionType = "overwatch"
+
+// pvpActionStratagem spends CP on a stratagem; either player can use one when its timing fits
+const pvpActionStratagem game.ActionType = "stratagem"
+
+// start activates a match whose players are both ready and sets up its battle rounds
+func (m *PvPMatch) start() {
+	m.Status = "active"
+	if m.State == nil {
+		m.State = game.NewTurnState(m.Player1, m.Player2, game.DefaultBattleRounds)
+	}
+	m.Turn = m.State.ActivePlayer()
+}
+
+// pvpActionRequest is a player's action in the current phase of their turn
+type pvpActionRequest struct {
+	Player string `json:"player"`
+	// One of the engine's action types (end_phase, move, advance, remain_stationary,
+	// fall_back, shoot, charge, fight). When empty the weapon is used the old way:
+	// earlier phases are ended, the unit shoots or charges and fights, and the turn ends.
+	Action   game.ActionType `json:"action,omitempty"`
+	WeaponID int             `json:"weapon_id"`          // index into player's weapons array
+	Seed     *int64          `json:"seed,omitempty"`     // optional dice seed for replays
+	Distance int             `json:"distance,omitempty"` // optional distance to the target in inches; the declared distance for a charge
+	// For the stratagem action: the stratagem's id or name, and for Command Re-roll the
+	// roll to re-roll (hit, wound, save, damage, ...; default hit)
+	Stratagem string     `json:"stratagem,omitempty"`
+	Stage     game.Stage `json:"stage,omitempty"`
+}
+
+// pvpActionResult is what an action produced; attacks carry a result, fights the full fight
+type pvpActionResult struct {
+	Result *game.ShootingResult
+	Fight  *game.FightResult
+	Charge *game.ChargeResult
+	// The active unit's Battle-shock test, taken at the start of its Command phase
+	BattleShock *game.BattleShockTest
+	Stratagem   *game.StratagemUse
+}
+
+// pvpSnapshot builds the unit snapshot of a player's unit for combat resolution
+func pvpSnapshot(name string, d *PvPPlayerData) game.UnitSnapshot {
+	u := game.UnitSnapshot{
+		ID:        name,
+		Name:      name,
+		T:         d.T,
+		W:         d.HP,
+		Sv:        d.Sv,
+		InvSv:     d.InvSv,
+		InvSaves:  d.InvSaves,
+		Ld:        d.Ld,
+		OC:        d.OC,
+		Keywords:  append([]string{}, d.Keywords...),
+		Abilities: append([]string{}, d.Abilities...),
+		Models:    d.Models,
+		Damaged:   d.Damaged,
+		Degraded:  d.Degraded,
+	}
+	// Units queued before characteristics were recorded
+	if u.T <= 0 {
+		u.T = 4
+	}
+	if u.Sv <= 0 {
+		u.Sv = 3
+	}
+	u.OC = game.DamagedOC(u)
+	return u
+}
+
+// pvpMarkDamaged records that a player's unit has entered its damaged bracket
+func pvpMarkDamaged(name string, d *PvPPlayerData) {
+	if !d.Degraded && game.IsDamaged(pvpSnapshot(name, d)) {
+		d.Degraded = true
+	}
+}
+
+// applyPvPAction validates an action against the match's turn state, resolves it and
+// updates both players' units. The caller persists the match.
+func applyPvPAction(m *PvPMatch, req pvpActionRequest) (pvpActionResult, error) {
+	var out pvpActionResult
+	if m.State == nil {
+		m.start()
+	}
+	st := m.State
+
+	var attackerData, defenderData *PvPPlayerData
+	var defender string
+	switch req.Player {
+	case m.Player1:
+		attackerData, defenderData, defender = &m.Player1Data, &m.Player2Data, m.Player2
+	case m.Player2:
+		attackerData, defenderData, defender = &m.Player2Data, &m.Player1Data, m.Player1
+	default:
+		return out, fmt.Errorf("invalid player")
+	}
+	rules, err := game.RulesetByName(m.Ruleset)
+	if err != nil {
+		return out, err
+	}
+	if req.Action == pvpActionOverwatch {
+		if st.ActivePlayer() == req.Player {
+			return out, fmt.Errorf("overwatch is a reaction to the opponent's charge")
+		}
+		if firstRangedWeapon(attackerData.Weapons) < 0 {
+			return out, fmt.Errorf("no ranged weapon to fire Overwatch with")
+		}
+		// Fire Overwatch is a 1CP stratagem, spent when the Overwatch is fired
+		if st.IsBattleShocked(req.Player) {
+			return out, fmt.Errorf("a Battle-shocked unit can't Fire Overwatch")
+		}
+		if i := pvpPlayerIndex(m, req.Player); st.CP[i] < fireOverwatchCP {
+			return out, fmt.Errorf("Fire Overwatch costs %d CP, you have %d", fireOverwatchCP, st.CP[i])
+		}
+		attackerData.Overwatch = true
+		return out, nil
+	}
+	if st.ActivePlayer() != req.Player {
+		return out, fmt.Errorf("not your turn")
+	}
+	out.BattleShock = pvpBattleShock(st, req.Player, attackerData, req.Seed)
+
+	// A unit that drops into its damaged bracket stays degraded for the rest of the match;
+	// registered before any return that follows damage, such as Overwatch on a failed charge
+	defer pvpMarkDamaged(req.Player, attackerData)
+	defer pvpMarkDamaged(defender, defenderData)
+
+	action := req.Action
+	legacy := action == ""
+	if legacy || action == game.ActionShoot || action == game.ActionFight {
+		if req.WeaponID < 0 || req.WeaponID >= len(attackerData.Weapons) {
+			return out, fmt.Errorf("invalid weapon")
+		}
+	}
+	if legacy {
+		// Single-weapon attack: play the turn up to the phase that weapon is used in. The
+		// phases are ended on a copy of the turn state, which only replaces the match's
+		// once the whole sequence has gone through, so a refused attack changes nothing.
+		st = st.Clone()
+		phase := game.PhaseShooting
+		action = game.ActionShoot
+		if attackerData.Weapons[req.WeaponID].snapshot().IsMelee() {
+			phase, action = game.PhaseFight, game.ActionFight
+			if !st.Engaged {
+				if err := st.AdvanceTo(game.PhaseCharge); err != nil {
+					return out, err
+				}
+				if err := st.Check(req.Player, game.ActionCharge); err != nil {
+					return out, err
+				}
+				ch, err := pvpCharge(st, attackerData, defenderData, req, defender, rules)
+				if err != nil {
+					return out, err
+				}
+				out.Charge = ch
+				if !ch.Success {
+					// the turn ends without a fight; keep the old single-result shape
+					pvpApplyCharge(attackerData, defenderData, ch)
+					st.EndTurn()
+					m.State = st
+					m.Turn = st.ActivePlayer()
+					if attackerData.HP <= 0 || st.Over {
+						m.Status = "finished"
+					}
+					out.Result = &game.ShootingResult{Logs: ch.Logs, Events: ch.Events, DefenderWounds: defenderData.HP, Models: defenderData.Models}
+					return out, nil
+				}
+			}
+		}
+		if err := st.AdvanceTo(phase); err != nil {
+			return out, err
+		}
+	}
+	if err := st.Check(req.Player, action); err != nil {
+		return out, err
+	}
+
+	// A legacy charge isn't committed to the units until the fight has gone through, but
+	// the charger fights with what it has left after Overwatch
+	attacker := pvpSnapshot(req.Player, pvpCharged(attackerData, out.Charge))
+	def := pvpSnapshot(defender, defenderData)
+	switch action {
+	case game.ActionCharge:
+		ch, err := pvpCharge(st, attackerData, defenderData, req, defender, rules)
+		if err != nil {
+			return out, err
+		}
+		pvpApplyCharge(attackerData, defenderData, ch)
+		out.Charge = ch
+		m.Turn = st.ActivePlayer()
+		if attackerData.HP <= 0 {
+			m.Status = "finished"
+		}
+		return out, nil
+	case game.ActionShoot:
+		wep := attackerData.Weapons[req.WeaponID].snapshot()
+		if err := st.CheckShot(wep, req.WeaponID); err != nil {
+			return out, err
+		}
+		rerolls, spendRerolls := pvpCommandRerolls(st, req.Player, defender)
+		opts := game.ShootingOptions{
+			Roller:     rollerFor(req.Seed),
+			Distance:   req.Distance,
+			Stationary: st.Turn.Stationary,
+			Charged:    st.Turn.Charged,
+			Rerolls:    rerolls,
+			Ruleset:    rules,
+		}
+		if st.StratagemActive(defender, game.EffectGoToGround) {
+			def, opts = game.GoToGround(def, opts)
+		}
+		ms, rs := game.DetachmentEffects(pvpDetachmentRules(attackerData), attacker, def, wep)
+		opts.Modifiers, opts.Rerolls = ms, game.MergeRerolls(opts.Rerolls, rs)
+		res, err := game.ResolveShootingWith(attacker, def, wep, opts)
+		if err != nil {
+			return out, err
+		}
+		spendRerolls(res.SingleRerolls)
+		defenderData.Models = res.Models
+		defenderData.HP = res.DefenderWounds
+		out.Result = &res
+	case game.ActionFight:
+		// Both units fight: whoever charged fights first, otherwise the player
+		// whose turn it isn't goes first
+		a := game.Fighter{Unit: attacker, Weapons: game.FightLoadout(weaponSnapshots(attackerData.Weapons), req.WeaponID), Charged: st.Turn.Charged}
+		b := game.Fighter{Unit: def, Weapons: game.FightLoadout(weaponSnapshots(defenderData.Weapons), mainMeleeWeapon(defenderData.Weapons))}
+		var spendA, spendB func([]game.Stage)
+		a.Rerolls, spendA = pvpCommandRerolls(st, req.Player, defender)
+		b.Rerolls, spendB = pvpCommandRerolls(st, defender, req.Player)
+		pvpFighterDetachment(&a, attackerData, def)
+		pvpFighterDetachment(&b, defenderData, attacker)
+		if st.StratagemActive(req.Player, game.EffectEpicChallenge) {
+			a.Weapons = game.EpicChallenge(a.Weapons)
+		}
+		if st.StratagemActive(defender, game.EffectEpicChallenge) {
+			b.Weapons = game.EpicChallenge(b.Weapons)
+		}
+		fr, err := game.ResolveFight(a, b, game.FightOptions{Roller: rollerFor(req.Seed), Active: 0, Ruleset: rules})
+		if err != nil {
+			return out, err
+		}
+		res := fr.Summary(0)
+		spendA(res.SingleRerolls)
+		spendB(fr.Summary(1).SingleRerolls)
+		if out.Charge != nil {
+			pvpApplyCharge(attackerData, defenderData, out.Charge)
+			res.Logs = append(append([]string(nil), out.Charge.Logs...), res.Logs...)
+			res.Events = append(append([]game.Event(nil), out.Charge.Events...), res.Events...)
+		}
+		attackerData.Models, attackerData.HP = fr.Sides[0].Models, fr.Sides[0].Wounds
+		defenderData.Models, defenderData.HP = fr.Sides[1].Models, fr.Sides[1].Wounds
+		out.Result, out.Fight = &res, &fr
+	}
+	st.Record(action, req.WeaponID)
+	if legacy {
+		st.EndTurn()
+		m.State = st
+	}
+
+	// The game ends when a unit is destroyed or the last battle round is over
+	if attackerData.HP <= 0 || defenderData.HP <= 0 || st.Over {
+		m.Status = "finished"
+	}
+	m.Turn = st.ActivePlayer()
+	return out, nil
+}
+
+// pvpBattleShock runs the Battle-shock step of the active player's Command phase, once
+// per turn before their first action: a Below Half-strength unit tests against its
+// Leadership. It returns nil when no test was needed. With a seed the test replays too;
+// its dice come from a seed derived from the action's, so they don't repeat the action's
+// first rolls.
+func pvpBattleShock(st *game.TurnState, player string, d *PvPPlayerData, seed *int64) *game.BattleShockTest {
+	if st.Over || st.Phase != game.PhaseCommand || st.Turn.ShockTested {
+		return nil
+	}
+	if !game.BelowHalfStrength(d.Models) {
+		st.RecordBattleShock(false, false)
+		return nil
+	}
+	if seed != nil {
+		s := *seed ^ battleShockSeedSalt
+		seed = &s
+	}
+	t := game.ResolveBattleShock(pvpSnapshot(player, d), rollerFor(seed))
+	st.RecordBattleShock(true, t.Passed)
+	return &t
+}
+
+// battleShockSeedSalt derives the Battle-shock test's seed from an action's; it stays
+// within 2^53 like the seeds themselves
+const battleShockSeedSalt = 0x5eed_b5
+
+// Fire Overwatch's cost and timing, from the Core stratagem
+const fireOverwatchCP = 1
+
+var fireOverwatchTiming = game.ParseStratagemTiming("Opponent’s turn", "Movement or Charge phase")
+
+// pvpPlayerIndex returns a player's index into the match's turn state players
+func pvpPlayerIndex(m *PvPMatch, player string) int {
+	if player == m.Player2 {
+		return 1
+	}
+	return 0
+}
+
+// pvpCommandRerolls collects the Command Re-rolls that apply to an attack: the attacker's
+// for its own rolls and the defender's for its saves. Nothing is spent until the returned
+// func is called with the stages whose single re-roll the attack used, which the caller
+// does once the attack has been resolved; a re-roll that wasn't needed stays unspent.
+func pvpCommandRerolls(st *game.TurnState, attacker, defender string) (game.Rerolls, func([]game.Stage)) {
+	rs := game.Rerolls{}
+	users := map[game.Stage]string{}
+	for _, p := range []string{attacker, defender} {
+		for _, u := range st.Stratagems {
+			if u.Player != p || u.Effect != game.EffectCommandReroll || u.Spent {
+				continue
+			}
+			defensive := u.Stage == game.StageSave || u.Stage == game.StageFNP
+			if defensive == (p == defender) {
+				users[u.Stage] = p
+				rs[u.Stage] = game.RerollSingle
+			}
+		}
+	}
+	return rs, func(used []game.Stage) {
+		for _, stage := range used {
+			if p, ok := users[stage]; ok {
+				st.ConsumeStratagem(p, game.EffectCommandReroll)
+			}
+		}
+	}
+}
+
+// pvpFighterDetachment adds the modifiers and re-rolls a side's detachment rules grant
+// its melee attacks against foe
+func pvpFighterDetachment(f *game.Fighter, d *PvPPlayerData, foe game.UnitSnapshot) {
+	if len(f.Weapons) == 0 {
+		return
+	}
+	ms, rs := game.DetachmentEffects(pvpDetachmentRules(d), f.Unit, foe, f.Weapons[0])
+	f.Modifiers, f.Rerolls = append(f.Modifiers, ms...), game.MergeRerolls(f.Rerolls, rs)
+}
+
+// firstRangedWeapon returns the index of a loadout's first ranged weapon, or -1
+func firstRangedWeapon(ws []PvPWeapon) int {
+	for i, w := range ws {
+		if !w.snapshot().IsMelee() {
+			return i
+		}
+	}
+	return -1
+}
+
+// pvpCharge rolls the active unit's charge, with Overwatch from the target if it was
+// readied, and records the outcome on the turn state. The units are left as they were:
+// the charger's models after Overwatch are in the result, and pvpApplyCharge commits
+// them once the rest of the action has gone through.
+func pvpCharge(st *game.TurnState, attackerData, defenderData *PvPPlayerData, req pvpActionRequest, defender string, rules game.Ruleset) (*game.ChargeResult, error) {
+	dist := req.Distance
+	if dist <= 0 {
+		dist = defaultChargeDistance
+	}
+	opts := game.ChargeOptions{Roller: rollerFor(req.Seed), Distance: dist, Ruleset: rules}
+	use := game.StratagemUse{Name: "Fire Overwatch", Effect: game.EffectFireOverwatch, CP: fireOverwatchCP}
+	if defenderData.Overwatch {
+		i := firstRangedWeapon(defenderData.Weapons)
+		if i >= 0 && st.CanUseStratagem(defender, use, fireOverwatchTiming) == nil {
+			opts.Overwatch = &game.OverwatchFire{Unit: pvpSnapshot(defender, defenderData), Weapon: defenderData.Weapons[i].snapshot()}
+		}
+	}
+	ch, err := game.ResolveCharge(pvpSnapshot(req.Player, attackerData), opts)
+	if err != nil {
+		return nil, err
+	}
+	// The CP is only spent once the Overwatch has actually been fired
+	if ch.Overwatch != nil {
+		if err := st.UseStratagem(defender, use, fireOverwatchTiming); err != nil {
+			return nil, err
+		}
+	}
+	st.RecordCharge(ch.Success)
+	return &ch, nil
+}
+
+// pvpApplyCharge commits a charge to the units: the charger's losses to Overwatch, and
+// the target's readied Overwatch, which is used up either way
+func pvpApplyCharge(attackerData, defenderData *PvPPlayerData, ch *game.ChargeResult) {
+	attackerData.Models, attackerData.HP = ch.Models, ch.Wounds
+	defenderData.Overwatch = false
+}
+
+// pvpCharged returns the charger's data with its losses to a charge not yet committed
+func pvpCharged(attackerData *PvPPlayerData, ch *game.ChargeResult) *PvPPlayerData {
+	if ch == nil {
+		return attackerData
+	}
+	d := *attackerData
+	d.Models, d.HP = ch.Models, ch.Wounds
+	return &d
+}
+
+// logPvPAction appends an action's Battle-shock test and attack to the match log under
+// the match ID. It returns the updated record, or nil if there was nothing to log.
+func logPvPAction(log *MatchLog, m *PvPMatch, req pvpActionRequest, round int, out pvpActionResult) *MatchRecord {
+	attackerData, defenderData, defender := &m.Player1Data, &m.Player2Data, m.Player2
+	if req.Player == m.Player2 {
+		attackerData, defenderData, defender = &m.Player2Data, &m.Player1Data, m.Player1
+	}
+	var rec *MatchRecord
+	now := time.Now().Unix()
+	if out.BattleShock != nil {
+		unit := pvpSnapshot(req.Player, attackerData)
+		unit.OC = game.ObjectiveControl(unit.OC, !out.BattleShock.Passed)
+		rec = log.append(m.ID, MatchEntry{Time: now, Actor: req.Player, Round: round, Attacker: unit, BattleShock: out.BattleShock})
+	}
+	if out.Result != nil {
+		var wep game.WeaponSnapshot
+		if req.WeaponID >= 0 && req.WeaponID < len(attackerData.Weapons) {
+			wep = attackerData.Weapons[req.WeaponID].snapshot()
+		}
+		rec = log.append(m.ID, MatchEntry{
+			Time:     now,
+			Actor:    req.Player,
+			Round:    round,
+			Attacker: pvpSnapshot(req.Player, attackerData),
+			Defender: pvpSnapshot(defender, defenderData),
+			Weapon:   wep,
+			Result:   *out.Result,
+		})
+	}
+	return rec
+}
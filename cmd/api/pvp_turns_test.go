@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+func TestPvPBattleShockReplaysFromSeed(t *testing.T) {
+	d := &PvPPlayerData{Ld: 7, Models: []game.ModelState{{Name: "Boy", W: 1, Wounds: 1}, {Name: "Boy", W: 1}, {Name: "Boy", W: 1}}}
+	d.HP = game.ModelsRemaining(d.Models)
+	seed := int64(12345)
+	var tests []*game.BattleShockTest
+	for i := 0; i < 2; i++ {
+		st := game.NewTurnState("alice", "bob", 0)
+		bt := pvpBattleShock(st, "alice", d, &seed)
+		if bt == nil || !st.Turn.ShockTested {
+			t.Fatal("a Below Half-strength unit wasn't tested")
+		}
+		if st.BattleShocked[0] == bt.Passed {
+			t.Errorf("passed %v but Battle-shocked %v", bt.Passed, st.BattleShocked[0])
+		}
+		tests = append(tests, bt)
+	}
+	if !reflect.DeepEqual(tests[0], tests[1]) {
+		t.Errorf("the same seed rolled %+v and %+v", tests[0], tests[1])
+	}
+
+	// A unit at full strength doesn't test, but the step is still done for the turn
+	d.Models[1].Wounds, d.Models[2].Wounds = 1, 1
+	st := game.NewTurnState("alice", "bob", 0)
+	if bt := pvpBattleShock(st, "alice", d, &seed); bt != nil || !st.Turn.ShockTested {
+		t.Errorf("full strength: test %+v, step done %v", bt, st.Turn.ShockTested)
+	}
+}
+
+func TestPvPCommandRerollsSpendOnlyUsed(t *testing.T) {
+	st := game.NewTurnState("alice", "bob", 0)
+	st.Stratagems = []game.StratagemUse{
+		{Player: "alice", Effect: game.EffectCommandReroll, Stage: game.StageHit},
+		{Player: "bob", Effect: game.EffectCommandReroll, Stage: game.StageSave},
+	}
+	rs, spend := pvpCommandRerolls(st, "alice", "bob")
+	if want := (game.Rerolls{game.StageHit: game.RerollSingle, game.StageSave: game.RerollSingle}); !reflect.DeepEqual(rs, want) {
+		t.Errorf("re-rolls %v, want %v", rs, want)
+	}
+	// only the attacker's hit re-roll was needed
+	spend([]game.Stage{game.StageHit})
+	if st.StratagemActive("alice", game.EffectCommandReroll) {
+		t.Error("the used hit re-roll wasn't spent")
+	}
+	if !st.StratagemActive("bob", game.EffectCommandReroll) {
+		t.Error("the unused save re-roll was spent")
+	}
+}
+
+func TestPvPChargeLeavesUnitsUntilApplied(t *testing.T) {
+	seed := int64(1)
+	st := game.NewTurnState("alice", "bob", 0)
+	if err := st.AdvanceTo(game.PhaseCharge); err != nil {
+		t.Fatal(err)
+	}
+	models := []game.ModelState{{Name: "Boy", W: 1, Wounds: 1}, {Name: "Boy", W: 1, Wounds: 1}, {Name: "Boy", W: 1, Wounds: 1}}
+	att := &PvPPlayerData{Models: append([]game.ModelState(nil), models...), HP: 3, T: 3, Sv: 7}
+	def := &PvPPlayerData{
+		Weapons:   []PvPWeapon{{Name: "Storm bolter", Type: "ranged", Range: 24, Attacks: "12", Skill: 3, Strength: 4, Damage: "1"}},
+		Models:    []game.ModelState{{Name: "Marine", W: 2, Wounds: 2}},
+		HP:        2,
+		Overwatch: true,
+	}
+	ch, err := pvpCharge(st, att, def, pvpActionRequest{Player: "alice", Seed: &seed, Distance: 7}, "bob", game.DefaultRuleset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Overwatch == nil || ch.Wounds == 3 {
+		t.Fatalf("Overwatch fired %v, charger left with %d wounds; want some lost", ch.Overwatch != nil, ch.Wounds)
+	}
+	if att.HP != 3 || !reflect.DeepEqual(att.Models, models) || !def.Overwatch {
+		t.Errorf("pvpCharge changed the units: charger %d wounds %+v, Overwatch readied %v", att.HP, att.Models, def.Overwatch)
+	}
+	pvpApplyCharge(att, def, ch)
+	if att.HP != ch.Wounds || !reflect.DeepEqual(att.Models, ch.Models) || def.Overwatch {
+		t.Errorf("applied: charger %d wounds %+v, Overwatch readied %v; want %d %+v false", att.HP, att.Models, def.Overwatch, ch.Wounds, ch.Models)
+	}
+}
+
+func TestPvPFailedChargeMarksDamaged(t *testing.T) {
+	seed := int64(3)
+	m := &PvPMatch{
+		Player1: "alice",
+		Player2: "bob",
+		Player1Data: PvPPlayerData{
+			Weapons: []PvPWeapon{{Name: "Armoured tracks", Type: "melee", Attacks: "3", Skill: 4, Strength: 6, Damage: "1"}},
+			Models:  []game.ModelState{{Name: "Tank", W: 10, Wounds: 10}},
+			HP:      10,
+			T:       3,
+			Sv:      7,
+			Damaged: &game.DamagedProfile{MinW: 1, MaxW: 9, HitMod: -1},
+		},
+		Player2Data: PvPPlayerData{
+			Weapons:   []PvPWeapon{{Name: "Storm bolter", Type: "ranged", Range: 24, Attacks: "12", Skill: 3, Strength: 4, Damage: "1"}},
+			Models:    []game.ModelState{{Name: "Marine", W: 2, Wounds: 2}},
+			HP:        2,
+			Overwatch: true,
+		},
+	}
+	out, err := applyPvPAction(m, pvpActionRequest{Player: "alice", WeaponID: 0, Seed: &seed, Distance: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Charge == nil || out.Charge.Success || m.Player1Data.HP == 10 {
+		t.Fatalf("charge %+v left %d wounds; want a failed charge after Overwatch damage", out.Charge, m.Player1Data.HP)
+	}
+	if !m.Player1Data.Degraded {
+		t.Error("the charger dropped into its damaged bracket but wasn't marked")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// Stratagem from Stratagems.csv
+type Stratagem struct {
+	ID          string               `json:"id"`
+	FactionID   string               `json:"faction_id,omitempty"` // empty for core and mission-pack stratagems
+	Name        string               `json:"name"`
+	Type        string               `json:"type"`
+	CPCost      int                  `json:"cp_cost"`
+	Legend      string               `json:"legend,omitempty"`
+	Turn        string               `json:"turn"`
+	Phase       string               `json:"phase"`
+	Detachment  string               `json:"detachment,omitempty"`
+	Description string               `json:"description"`
+	Timing      game.StratagemTiming `json:"timing"`
+	// Effect is set when the engine can resolve the stratagem; otherwise it is unsupported
+	Effect    game.StratagemEffect `json:"effect,omitempty"`
+	Supported bool                 `json:"supported"`
+}
+
+// isCore reports whether a stratagem is one of the Core stratagems every army can use
+func (s Stratagem) isCore() bool {
+	return s.FactionID == "" && strings.HasPrefix(strings.TrimSpace(s.Type), "Core")
+}
+
+// stratagemIndex holds stratagems by id, faction, detachment and datasheet
+type stratagemIndex struct {
+	ByID         map[string]Stratagem
+	ByFac        map[string][]Stratagem // faction_id -> stratagems ("" for core)
+	ByDetachment map[string][]Stratagem // detachment name -> stratagems
+	ByDS         map[string][]Stratagem // datasheet_id -> stratagems it can be targeted by
+}
+
+func loadStratagems(root string) (stratagemIndex, error) {
+	idx := stratagemIndex{
+		ByID:         map[string]Stratagem{},
+		ByFac:        map[string][]Stratagem{},
+		ByDetachment: map[string][]Stratagem{},
+		ByDS:         map[string][]Stratagem{},
+	}
+	rows, err := readPipeCSV(filepath.Join(root, "src", "Stratagems.csv"))
+	if err != nil {
+		return idx, err
+	}
+	for i, r := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(r) < 10 {
+			continue
+		}
+		st := Stratagem{
+			FactionID:   strings.TrimSpace(r[0]),
+			ID:          strings.TrimSpace(r[1]),
+			Name:        strings.TrimSpace(r[2]),
+			Type:        strings.TrimSpace(r[3]),
+			Legend:      htmlToText(r[5]),
+			Turn:        strings.TrimSpace(r[6]),
+			Phase:       strings.TrimSpace(r[7]),
+			Detachment:  strings.TrimSpace(r[8]),
+			Description: htmlToText(r[9]),
+		}
+		st.CPCost, _ = strconv.Atoi(strings.TrimSpace(r[4]))
+		st.Timing = game.ParseStratagemTiming(st.Turn, st.Phase)
+		// Only the generic stratagems are wired to engine effects; faction ones that share
+		// a name with them (e.g. mission-pack copies) are not
+		if st.FactionID == "" {
+			st.Effect, st.Supported = game.StratagemEffectFor(st.Name)
+		}
+		idx.ByID[st.ID] = st
+		idx.ByFac[st.FactionID] = append(idx.ByFac[st.FactionID], st)
+		if st.Detachment != "" {
+			idx.ByDetachment[st.Detachment] = append(idx.ByDetachment[st.Detachment], st)
+		}
+	}
+	links, err := readPipeCSV(filepath.Join(root, "src", "Datasheets_stratagems.csv"))
+	if err != nil {
+		return idx, err
+	}
+	for i, r := range links {
+		if i == 0 || len(r) < 2 {
+			continue
+		}
+		if st, ok := idx.ByID[strings.TrimSpace(r[1])]; ok {
+			idx.ByDS[r[0]] = append(idx.ByDS[r[0]], st)
+		}
+	}
+	for _, m := range []map[string][]Stratagem{idx.ByFac, idx.ByDetachment, idx.ByDS} {
+		for k, list := range m {
+			sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+			m[k] = list
+		}
+	}
+	return idx, nil
+}
+
+// unitStratagems lists the stratagems a unit can use: the Core stratagems plus its
+// faction's stratagems that list the datasheet
+func unitStratagems(store *Store, unitID string) []Stratagem {
+	out := []Stratagem{}
+	seen := map[string]bool{}
+	for _, st := range store.StratagemsByFac[""] {
+		if st.isCore() && !seen[st.ID] {
+			seen[st.ID] = true
+			out = append(out, st)
+		}
+	}
+	for _, st := range store.StratagemsByDS[unitID] {
+		if !seen[st.ID] {
+			seen[st.ID] = true
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// findUnitStratagem looks a stratagem up by id or name among those a unit can use
+func findUnitStratagem(store *Store, unitID, ref string) (Stratagem, bool) {
+	ref = strings.TrimSpace(ref)
+	for _, st := range unitStratagems(store, unitID) {
+		if st.ID == ref || strings.EqualFold(st.Name, ref) {
+			return st, true
+		}
+	}
+	return Stratagem{}, false
+}
+
+// errUnsupportedStratagem is returned for stratagems whose effect the engine can't resolve yet
+type errUnsupportedStratagem struct{ Name string }
+
+func (e errUnsupportedStratagem) Error() string {
+	return fmt.Sprintf("unsupported effect: %s can't be resolved by the engine yet", e.Name)
+}
+
+// usePvPStratagem spends the player's CP on a stratagem for their unit. Its effect is
+// applied by the player's next matching roll or attack in this phase.
+func usePvPStratagem(store *Store, m *PvPMatch, req pvpActionRequest) (pvpActionResult, error) {
+	var out pvpActionResult
+	if m.State == nil {
+		m.start()
+	}
+	st := m.State
+	var data *PvPPlayerData
+	switch req.Player {
+	case m.Player1:
+		data = &m.Player1Data
+	case m.Player2:
+		data = &m.Player2Data
+	default:
+		return out, fmt.Errorf("invalid player")
+	}
+	if st.ActivePlayer() == req.Player {
+		out.BattleShock = pvpBattleShock(st, req.Player, data, req.Seed)
+	}
+	strat, ok := findUnitStratagem(store, data.UnitID, req.Stratagem)
+	if !ok {
+		return out, fmt.Errorf("unknown stratagem for this unit: %s", req.Stratagem)
+	}
+	if !strat.Supported {
+		return out, errUnsupportedStratagem{Name: strat.Name}
+	}
+	if strat.Effect == game.EffectFireOverwatch {
+		return out, fmt.Errorf("use the overwatch action to ready Fire Overwatch")
+	}
+	if err := game.CheckStratagemTarget(strat.Effect, pvpSnapshot(req.Player, data)); err != nil {
+		return out, err
+	}
+	use := game.StratagemUse{Name: strat.Name, Effect: strat.Effect, CP: strat.CPCost}
+	if strat.Effect == game.EffectCommandReroll {
+		use.Stage = req.Stage
+		if use.Stage == "" {
+			use.Stage = game.StageHit
+		}
+		if err := (game.Rerolls{use.Stage: game.RerollSingle}).Validate(); err != nil {
+			return out, err
+		}
+	}
+	if err := st.UseStratagem(req.Player, use, strat.Timing); err != nil {
+		return out, err
+	}
+	out.Stratagem = &st.Stratagems[len(st.Stratagems)-1]
+	return out, nil
+}
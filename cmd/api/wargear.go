@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WargearRule is the structured form of one Datasheets_options.csv line: the weapons
+// it takes away and the alternatives that can replace them (or be added)
+type WargearRule struct {
+	Replaces []string   `json:"replaces,omitempty"`
+	Choices  [][]string `json:"choices"`
+	Pick     int        `json:"pick"` // how many choices may be taken at once
+	// Exclusive swaps change every copy of the replaced weapons in the unit ("This model's ..."),
+	// so the old and new wargear can't be fielded together. Per-model swaps ("Any number of
+	// models can each ...") leave the rest of the unit on the default loadout.
+	Exclusive bool `json:"exclusive"`
+}
+
+var (
+	reOptionItem  = regexp.MustCompile(`(?i)<li>(.*?)</li>`)
+	reWeaponCount = regexp.MustCompile(`^(up to )?(\d+|one|two|three|four)\s+`)
+	reHaveTheir   = regexp.MustCompile(`(?i)\b(?:have (?:their|its) (.+?) replaced|replace (?:their|its) (.+?)) with\b`)
+	reParenthesis = regexp.MustCompile(`\s*\([^)]*\)`)
+)
+
+// parseWargearRule reads an option line's raw HTML. It returns nil for lines that don't
+// describe a weapon swap or addition ("None", footnotes, unit-wide upgrades we can't name).
+func parseWargearRule(raw string) *WargearRule {
+	items := []string{}
+	for _, m := range reOptionItem.FindAllStringSubmatch(raw, -1) {
+		items = append(items, htmlToText(m[1]))
+	}
+	if i := strings.Index(strings.ToLower(raw), "<ul"); i >= 0 {
+		raw = raw[:i]
+	}
+	text := strings.TrimSpace(htmlToText(raw))
+	low := strings.ToLower(strings.ReplaceAll(text, "’", "'"))
+
+	rule := &WargearRule{Pick: 1}
+	var with string
+	switch {
+	case reHaveTheir.MatchString(low):
+		m := reHaveTheir.FindStringSubmatchIndex(low)
+		if m[2] >= 0 {
+			rule.Replaces = splitWeaponList(low[m[2]:m[3]])
+		} else {
+			rule.Replaces = splitWeaponList(low[m[4]:m[5]])
+		}
+		with = low[m[1]:]
+	case strings.Contains(low, " replaced with "):
+		i := strings.Index(low, " replaced with ")
+		subject := strings.TrimSuffix(strings.TrimSuffix(low[:i], " be"), " each")
+		subject = strings.TrimSuffix(subject, " can")
+		if j := strings.LastIndex(subject, "'s "); j >= 0 {
+			subject = subject[j+3:]
+		} else if j := strings.LastIndex(subject, "s' "); j >= 0 {
+			subject = subject[j+3:]
+		} else if j := strings.LastIndex(subject, " its "); j >= 0 {
+			subject = subject[j+5:]
+		}
+		rule.Replaces = splitWeaponList(subject)
+		with = low[i+len(" replaced with "):]
+	case strings.Contains(low, " be equipped with "):
+		i := strings.Index(low, " be equipped with ")
+		with = low[i+len(" be equipped with "):]
+	default:
+		return nil
+	}
+	rule.Exclusive = strings.HasPrefix(low, "this model") || strings.HasPrefix(low, "all models") || strings.HasPrefix(low, "all of the models") || strings.HasPrefix(low, "every model")
+
+	with = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(with), "."))
+	if i := strings.Index(with, "the following"); i >= 0 {
+		lead := with[:i]
+		if strings.Contains(lead, "two") {
+			rule.Pick = 2
+		}
+		// "1 twin lightning claws, or two different weapons from the following list"
+		if j := strings.Index(lead, ", or "); j >= 0 {
+			if c := splitWeaponList(lead[:j]); len(c) > 0 {
+				rule.Choices = append(rule.Choices, c)
+			}
+		}
+		for _, it := range items {
+			it = strings.ToLower(strings.ReplaceAll(it, "’", "'"))
+			// "Replace its bolt pistol and Astartes chainsword with 1 twin lightning claws."
+			if j := strings.Index(it, " with "); j >= 0 {
+				it = it[j+len(" with "):]
+			}
+			if c := splitWeaponList(it); len(c) > 0 {
+				rule.Choices = append(rule.Choices, c)
+			}
+		}
+	} else if c := splitWeaponList(with); len(c) > 0 {
+		rule.Choices = append(rule.Choices, c)
+	}
+	if len(rule.Choices) == 0 {
+		return nil
+	}
+	return rule
+}
+
+// splitWeaponList turns "1 kombi-weapon and 1 close combat weapon" into normalized weapon names
+func splitWeaponList(s string) []string {
+	s = reParenthesis.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, ";", ",")
+	s = strings.ReplaceAll(s, " and ", ",")
+	s = strings.ReplaceAll(s, " or ", ",")
+	out := []string{}
+	for _, part := range strings.Split(s, ",") {
+		if n := wargearName(part); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// wargearName normalizes a weapon name for comparison between loadout text, option lines and
+// Datasheets_wargear.csv rows: lower case, no counts, no "– profile" suffix, no plural "s"
+func wargearName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(s, "’", "'")))
+	s = strings.TrimRight(s, ".*")
+	if i := strings.Index(s, " – "); i >= 0 {
+		s = s[:i]
+	} else if i := strings.Index(s, " - "); i >= 0 {
+		s = s[:i]
+	}
+	s = reWeaponCount.ReplaceAllString(s, "")
+	s = strings.TrimPrefix(s, "additional ")
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "ies") {
+		s = strings.TrimSuffix(s, "ies") + "y"
+	} else if strings.HasSuffix(s, "s") && !strings.HasSuffix(s, "ss") {
+		s = strings.TrimSuffix(s, "s")
+	}
+	return s
+}
+
+// loadLoadouts reads each datasheet's default wargear from the loadout column of Datasheets.csv
+func loadLoadouts(root string) (map[string][]string, error) {
+	rows, err := readPipeCSV(filepath.Join(root, "src", "Datasheets.csv"))
+	if err != nil {
+		return nil, err
+	}
+	byDS := map[string][]string{}
+	for i, r := range rows {
+		if i == 0 || len(r) < 7 {
+			continue
+		}
+		seen := map[string]bool{}
+		// "<b>This model is equipped with:</b> kombi-weapon; twin slugga." or one sentence per model type
+		for _, sentence := range strings.Split(htmlToText(r[6]), ".") {
+			j := strings.Index(sentence, ":")
+			if j < 0 {
+				continue
+			}
+			for _, part := range strings.FieldsFunc(sentence[j+1:], func(r rune) bool { return r == ';' || r == ',' }) {
+				if n := wargearName(part); n != "" && !seen[n] {
+					seen[n] = true
+					byDS[r[0]] = append(byDS[r[0]], n)
+				}
+			}
+		}
+	}
+	return byDS, nil
+}
+
+// checkWargear validates the weapons picked from one datasheet against its default loadout and
+// option lines. A loadout is legal when some combination of exclusive swaps covers every picked
+// weapon, each weapon swapped out at most once; the error names the option line (or the two
+// lines competing for one weapon) that rules it out.
+func checkWargear(store *Store, unitID string, picked []string) error {
+	defaults := store.LoadoutsByDS[unitID]
+	if len(defaults) == 0 || len(picked) == 0 {
+		// Without a default loadout there is nothing to validate against
+		return nil
+	}
+	options := store.OptionsByDS[unitID]
+	want := map[string]bool{}
+	for _, p := range picked {
+		want[wargearName(p)] = true
+	}
+
+	free := map[string]bool{} // always available: per-model swaps and additions
+	exclusive := []Option{}   // exclusive rules that touch the pick
+	for _, o := range options {
+		if o.Rule == nil {
+			continue
+		}
+		if !o.Rule.Exclusive {
+			for _, c := range o.Rule.Choices {
+				for _, n := range c {
+					free[n] = true
+				}
+			}
+			continue
+		}
+		touches := false
+		for _, n := range o.Rule.Replaces {
+			touches = touches || want[n]
+		}
+		for _, c := range o.Rule.Choices {
+			for _, n := range c {
+				touches = touches || want[n]
+			}
+		}
+		if touches {
+			exclusive = append(exclusive, o)
+		}
+	}
+
+	// A weapon an option replaces is carried by default even when the loadout text spells it differently
+	for _, o := range exclusive {
+		for _, x := range o.Rule.Replaces {
+			found := false
+			for _, d := range defaults {
+				found = found || d == x
+			}
+			if !found {
+				defaults = append(defaults[:len(defaults):len(defaults)], x)
+			}
+		}
+	}
+
+	// Weapons that neither the loadout nor any option mentions are drift in the export (typos,
+	// renamed profiles); they stay unconstrained rather than rejecting a real datasheet weapon
+	for n := range want {
+		known := free[n]
+		for _, d := range defaults {
+			known = known || d == n
+		}
+		for _, o := range exclusive {
+			for _, c := range o.Rule.Choices {
+				for _, x := range c {
+					known = known || x == n
+				}
+			}
+			for _, x := range o.Rule.Replaces {
+				known = known || x == n
+			}
+		}
+		if !known {
+			free[n] = true
+		}
+	}
+
+	// Try every combination of exclusive swaps: each rule keeps its default or takes up to Pick choices
+	have := func(taken [][]string) bool {
+		removed := map[string]bool{}
+		added := map[string]bool{}
+		for i, t := range taken {
+			if t == nil {
+				continue
+			}
+			for _, n := range exclusive[i].Rule.Replaces {
+				// a weapon can only be swapped out once
+				if removed[n] {
+					return false
+				}
+				removed[n] = true
+			}
+			for _, n := range t {
+				added[n] = true
+			}
+		}
+		for n := range want {
+			if free[n] || added[n] {
+				continue
+			}
+			ok := false
+			for _, d := range defaults {
+				ok = ok || (d == n && !removed[n])
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	taken := make([][]string, len(exclusive))
+	var search func(i int) bool
+	search = func(i int) bool {
+		if i == len(exclusive) {
+			return have(taken)
+		}
+		taken[i] = nil
+		if search(i + 1) {
+			return true
+		}
+		r := exclusive[i].Rule
+		for a := range r.Choices {
+			taken[i] = r.Choices[a]
+			if search(i + 1) {
+				return true
+			}
+			if r.Pick < 2 {
+				continue
+			}
+			for b := a + 1; b < len(r.Choices); b++ {
+				taken[i] = append(append([]string(nil), r.Choices[a]...), r.Choices[b]...)
+				if search(i + 1) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if search(0) {
+		return nil
+	}
+
+	// Name the first option whose alternatives are picked together
+	for _, o := range exclusive {
+		groups := 0
+		hit := false
+		for _, n := range o.Rule.Replaces {
+			hit = hit || want[n]
+		}
+		if hit {
+			groups++
+		}
+		for _, c := range o.Rule.Choices {
+			hit = false
+			for _, n := range c {
+				hit = hit || want[n]
+			}
+			if hit {
+				groups++
+			}
+		}
+		if groups > o.Rule.Pick {
+			return fmt.Errorf("loadout violates option %d: %q", o.Line, o.Description)
+		}
+	}
+	// Or two options that would both have to replace the same weapon
+	picks := func(o Option) bool {
+		for _, c := range o.Rule.Choices {
+			for _, n := range c {
+				if want[n] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for i, a := range exclusive {
+		if !picks(a) {
+			continue
+		}
+		for _, b := range exclusive[i+1:] {
+			if !picks(b) {
+				continue
+			}
+			for _, n := range a.Rule.Replaces {
+				for _, m := range b.Rule.Replaces {
+					if n == m {
+						return fmt.Errorf("loadout takes options %d and %d, which both replace the %s", a.Line, b.Line, n)
+					}
+				}
+			}
+		}
+	}
+	return fmt.Errorf("loadout is not a legal wargear combination")
+}
+
+func hasWeapon(list []Weapon, name string) bool {
+	for _, w := range list {
+		if strings.EqualFold(w.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWargearRule(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want *WargearRule
+	}{
+		{
+			raw:  "This model’s bolt pistol can be replaced with 1 plasma pistol.",
+			want: &WargearRule{Replaces: []string{"bolt pistol"}, Choices: [][]string{{"plasma pistol"}}, Pick: 1, Exclusive: true},
+		},
+		{
+			raw:  "Any number of models can each have their boltgun replaced with 1 flamer.",
+			want: &WargearRule{Replaces: []string{"boltgun"}, Choices: [][]string{{"flamer"}}, Pick: 1},
+		},
+		{
+			raw:  "This model can be equipped with two different weapons from the following list:<ul><li>1 storm shield</li><li>1 power fist</li></ul>",
+			want: &WargearRule{Choices: [][]string{{"storm shield"}, {"power fist"}}, Pick: 2, Exclusive: true},
+		},
+		{raw: "None", want: nil},
+	}
+	for _, c := range cases {
+		if got := parseWargearRule(c.raw); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseWargearRule(%q) = %+v, want %+v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestCheckWargear(t *testing.T) {
+	store := &Store{
+		LoadoutsByDS: map[string][]string{"cap": {"bolt pistol", "chainsword"}},
+		OptionsByDS: map[string][]Option{"cap": {
+			{Line: 1, Description: "This model’s bolt pistol can be replaced with 1 plasma pistol.", Rule: parseWargearRule("This model’s bolt pistol can be replaced with 1 plasma pistol.")},
+			{Line: 2, Description: "This model can be equipped with 1 storm shield.", Rule: parseWargearRule("This model can be equipped with 1 storm shield.")},
+			{Line: 3, Description: "This model’s bolt pistol can be replaced with 1 grav-pistol.", Rule: parseWargearRule("This model’s bolt pistol can be replaced with 1 grav-pistol.")},
+		}},
+	}
+	cases := []struct {
+		picked []string
+		err    string
+	}{
+		{picked: []string{"Bolt pistol", "Chainsword"}},
+		{picked: []string{"Plasma pistol", "Chainsword"}},
+		{picked: []string{"Plasma pistol", "Storm shield"}},
+		{picked: []string{"Relic blade"}}, // not on the datasheet at all: left unconstrained
+		{picked: []string{"Bolt pistol", "Plasma pistol"}, err: "option 1"},
+		{picked: []string{"Plasma pistol", "Grav-pistol"}, err: "options 1 and 3"},
+	}
+	for _, c := range cases {
+		err := checkWargear(store, "cap", c.picked)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("checkWargear(%v) = %v, want nil", c.picked, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("checkWargear(%v) = %v, want error naming %q", c.picked, err, c.err)
+		}
+	}
+	if err := checkWargear(store, "unknown", []string{"anything"}); err != nil {
+		t.Errorf("datasheet without a loadout: %v", err)
+	}
+}
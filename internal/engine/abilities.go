@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AntiAbility is a parsed "Anti-KEYWORD X+" entry
+type AntiAbility struct {
+    Keyword   string `json:"keyword"`
+    Threshold int    `json:"threshold"` // X in X+ (2-6)
+}
+
+// WeaponAbilities is the canonical, typed form of a weapon's ability list.
+// Parameterised abilities keep their X as a dice expression ("1", "D3", "D6+2").
+type WeaponAbilities struct {
+    Assault           bool          `json:"assault,omitempty"`
+    Heavy             bool          `json:"heavy,omitempty"`
+    Pistol            bool          `json:"pistol,omitempty"`
+    Torrent           bool          `json:"torrent,omitempty"`
+    Blast             bool          `json:"blast,omitempty"`
+    TwinLinked        bool          `json:"twin_linked,omitempty"`
+    LethalHits        bool          `json:"lethal_hits,omitempty"`
+    DevastatingWounds bool          `json:"devastating_wounds,omitempty"`
+    IgnoresCover      bool          `json:"ignores_cover,omitempty"`
+    Precision         bool          `json:"precision,omitempty"`
+    Lance             bool          `json:"lance,omitempty"`
+    IndirectFire      bool          `json:"indirect_fire,omitempty"`
+    Psychic           bool          `json:"psychic,omitempty"`
+    Hazardous         bool          `json:"hazardous,omitempty"`
+    ExtraAttacks      bool          `json:"extra_attacks,omitempty"`
+    OneShot           bool          `json:"one_shot,omitempty"`
+    SustainedHits     string        `json:"sustained_hits,omitempty"`
+    RapidFire         string        `json:"rapid_fire,omitempty"`
+    Melta             string        `json:"melta,omitempty"`
+    Anti              []AntiAbility `json:"anti,omitempty"`
+    // Critical on X+ instead of 6 (e.g. "Critical Hits 5+"); 0 means 6
+    CritHit   int `json:"crit_hit,omitempty"`
+    CritWound int `json:"crit_wound,omitempty"`
+    // Tokens that didn't match any known ability, verbatim (trimmed)
+    Unknown []string `json:"unknown,omitempty"`
+}
+
+// flagAbilities maps the lowercase label of each parameterless ability to its field
+var flagAbilities = map[string]func(*WeaponAbilities){
+    "assault":            func(a *WeaponAbilities) { a.Assault = true },
+    "heavy":              func(a *WeaponAbilities) { a.Heavy = true },
+    "pistol":             func(a *WeaponAbilities) { a.Pistol = true },
+    "torrent":            func(a *WeaponAbilities) { a.Torrent = true },
+    "blast":              func(a *WeaponAbilities) { a.Blast = true },
+    "twin-linked":        func(a *WeaponAbilities) { a.TwinLinked = true },
+    "twin linked":        func(a *WeaponAbilities) { a.TwinLinked = true },
+    "lethal hits":        func(a *WeaponAbilities) { a.LethalHits = true },
+    "devastating wounds": func(a *WeaponAbilities) { a.DevastatingWounds = true },
+    "ignores cover":      func(a *WeaponAbilities) { a.IgnoresCover = true },
+    "precision":          func(a *WeaponAbilities) { a.Precision = true },
+    "lance":              func(a *WeaponAbilities) { a.Lance = true },
+    "indirect fire":      func(a *WeaponAbilities) { a.IndirectFire = true },
+    "psychic":            func(a *WeaponAbilities) { a.Psychic = true },
+    "hazardous":          func(a *WeaponAbilities) { a.Hazardous = true },
+    "extra attacks":      func(a *WeaponAbilities) { a.ExtraAttacks = true },
+    "one shot":           func(a *WeaponAbilities) { a.OneShot = true },
+}
+
+var abilityCache = memo[WeaponAbilities]{limit: 4096}
+
+// ParseWeaponAbilities turns ability strings into a WeaponAbilities value.
+// Each input may hold a single ability ("Sustained Hits 1") or a comma separated
+// wargear description ("rapid fire 2, pistol"); matching is case-insensitive.
+// Results are cached, so callers must not modify the returned slices.
+func ParseWeaponAbilities(src ...string) WeaponAbilities {
+    key := memoKey(src)
+    if ab, ok := abilityCache.load(key); ok { return ab }
+    ab := parseWeaponAbilities(src)
+    abilityCache.store(key, ab)
+    return ab
+}
+
+func parseWeaponAbilities(src []string) WeaponAbilities {
+    var out WeaponAbilities
+    for _, s := range src {
+        for _, tok := range strings.Split(s, ",") {
+            tok = strings.TrimSpace(tok)
+            if tok == "" { continue }
+            if !out.apply(tok) {
+                out.Unknown = append(out.Unknown, tok)
+            }
+        }
+    }
+    return out
+}
+
+// apply records a single ability token, reporting whether it was recognized
+func (a *WeaponAbilities) apply(tok string) bool {
+    lt := strings.Join(strings.Fields(strings.ToLower(tok)), " ")
+    if set, ok := flagAbilities[lt]; ok {
+        set(a)
+        return true
+    }
+    if x, ok := abilityParam(lt, "sustained hits"); ok {
+        a.SustainedHits = x
+        return true
+    }
+    if x, ok := abilityParam(lt, "rapid fire"); ok {
+        a.RapidFire = x
+        return true
+    }
+    if x, ok := abilityParam(lt, "melta"); ok {
+        a.Melta = x
+        return true
+    }
+    for _, l := range []string{"critical hits", "critical hit"} {
+        if tn, ok := critParam(lt, l); ok {
+            a.CritHit = tn
+            return true
+        }
+    }
+    for _, l := range []string{"critical wounds", "critical wound"} {
+        if tn, ok := critParam(lt, l); ok {
+            a.CritWound = tn
+            return true
+        }
+    }
+    if strings.HasPrefix(lt, "anti-") {
+        // e.g. "anti-infantry 4+"
+        parts := strings.Fields(strings.TrimPrefix(lt, "anti-"))
+        if len(parts) != 2 || !strings.HasSuffix(parts[1], "+") { return false }
+        tn, err := strconv.Atoi(strings.TrimSuffix(parts[1], "+"))
+        if err != nil || tn < 2 || tn > 6 { return false }
+        a.Anti = append(a.Anti, AntiAbility{Keyword: parts[0], Threshold: tn})
+        return true
+    }
+    return false
+}
+
+// abilityParam extracts the X from "<label> X" where X is an int or dice expression
+func abilityParam(tok, label string) (string, bool) {
+    if !strings.HasPrefix(tok, label+" ") { return "", false }
+    x := strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(tok, label+" "), " ", ""))
+    if x == "" || !validDiceExpr(x) { return "", false }
+    return x, true
+}
+
+// validDiceExpr reports whether expr is a dice expression ParseDice accepts
+func validDiceExpr(expr string) bool {
+    _, err := ParseDice(expr)
+    return err == nil
+}
+
+// Tokens renders the abilities back into canonical display strings
+func (a WeaponAbilities) Tokens() []string {
+    var out []string
+    flag := func(on bool, label string) {
+        if on { out = append(out, label) }
+    }
+    flag(a.Assault, "Assault")
+    flag(a.Heavy, "Heavy")
+    flag(a.Pistol, "Pistol")
+    flag(a.Torrent, "Torrent")
+    flag(a.Blast, "Blast")
+    flag(a.TwinLinked, "Twin-linked")
+    flag(a.LethalHits, "Lethal Hits")
+    flag(a.DevastatingWounds, "Devastating Wounds")
+    flag(a.IgnoresCover, "Ignores Cover")
+    flag(a.Precision, "Precision")
+    flag(a.Lance, "Lance")
+    flag(a.IndirectFire, "Indirect Fire")
+    flag(a.Psychic, "Psychic")
+    flag(a.Hazardous, "Hazardous")
+    flag(a.ExtraAttacks, "Extra Attacks")
+    flag(a.OneShot, "One Shot")
+    if a.SustainedHits != "" { out = append(out, "Sustained Hits "+a.SustainedHits) }
+    if a.RapidFire != "" { out = append(out, "Rapid Fire "+a.RapidFire) }
+    if a.Melta != "" { out = append(out, "Melta "+a.Melta) }
+    if a.CritHit > 0 { out = append(out, fmt.Sprintf("Critical Hits %d+", a.CritHit)) }
+    if a.CritWound > 0 { out = append(out, fmt.Sprintf("Critical Wounds %d+", a.CritWound)) }
+    for _, an := range a.Anti {
+        kw := an.Keyword
+        if kw != "" { kw = strings.ToUpper(kw[:1]) + kw[1:] }
+        out = append(out, fmt.Sprintf("Anti-%s %d+", kw, an.Threshold))
+    }
+    return out
+}
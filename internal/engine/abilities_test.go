@@ -0,0 +1,46 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseWeaponAbilities(t *testing.T) {
+    ab := ParseWeaponAbilities("Rapid Fire 2, pistol", "SUSTAINED HITS d3", "Anti-Infantry 4+", "Twin Linked", "Lethal Hits", "Big Gun")
+    if !ab.Pistol || !ab.TwinLinked || !ab.LethalHits {
+        t.Errorf("flags not parsed: %+v", ab)
+    }
+    if ab.RapidFire != "2" || ab.SustainedHits != "D3" {
+        t.Errorf("Rapid Fire %q, Sustained Hits %q, want 2 and D3", ab.RapidFire, ab.SustainedHits)
+    }
+    if want := []AntiAbility{{Keyword: "infantry", Threshold: 4}}; !reflect.DeepEqual(ab.Anti, want) {
+        t.Errorf("Anti = %+v, want %+v", ab.Anti, want)
+    }
+    if want := []string{"Big Gun"}; !reflect.DeepEqual(ab.Unknown, want) {
+        t.Errorf("Unknown = %v, want %v", ab.Unknown, want)
+    }
+    want := []string{"Pistol", "Twin-linked", "Lethal Hits", "Sustained Hits D3", "Rapid Fire 2", "Anti-Infantry 4+"}
+    if got := ab.Tokens(); !reflect.DeepEqual(got, want) {
+        t.Errorf("Tokens() = %v, want %v", got, want)
+    }
+}
+
+func TestParseWeaponAbilitiesRejectsBadParameters(t *testing.T) {
+    ab := ParseWeaponAbilities("Sustained Hits lots", "Anti-Vehicle 7+", "Melta")
+    if ab.SustainedHits != "" || len(ab.Anti) != 0 || ab.Melta != "" || len(ab.Unknown) != 3 {
+        t.Errorf("bad parameters were accepted: %+v", ab)
+    }
+}
+
+// TestSustainedHitsOnCriticals checks a critical hit adds the Sustained Hits extra hits
+func TestSustainedHitsOnCriticals(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "2", Skill: 4, Strength: 4, Damage: "1", Abilities: []string{"Sustained Hits 2"}}
+    // hits: 6 (critical, +2), 3 (miss); wounds: 1, 1, 1
+    res, err := ResolveShootingWith(UnitSnapshot{}, UnitSnapshot{T: 4, Sv: 3, W: 5}, w, ShootingOptions{Roller: NewScriptedRoller(6, 3, 1, 1, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Hits != 3 || res.Wounds != 0 {
+        t.Errorf("hits %d wounds %d, want 3 and 0", res.Hits, res.Wounds)
+    }
+}
@@ -0,0 +1,116 @@
+package engine
+
+// ModelState is a single model in a unit and the wounds it has left
+type ModelState struct {
+    Name   string `json:"name"`
+    W      int    `json:"W"`      // wounds characteristic
+    Wounds int    `json:"wounds"` // wounds remaining; 0 means slain
+    // A leader attached to the unit: attacks are only allocated to it once no
+    // bodyguard models are left, unless they have Precision
+    Character bool `json:"character,omitempty"`
+}
+
+// Alive reports whether the model is still on the table
+func (m ModelState) Alive() bool { return m.Wounds > 0 }
+
+// CloneModels copies a model list so results never alias a caller's snapshot
+func CloneModels(ms []ModelState) []ModelState {
+    if ms == nil { return nil }
+    return append([]ModelState(nil), ms...)
+}
+
+// ModelsRemaining sums the wounds left across all models
+func ModelsRemaining(ms []ModelState) int {
+    total := 0
+    for _, m := range ms {
+        if m.Wounds > 0 { total += m.Wounds }
+    }
+    return total
+}
+
+// AliveCount returns how many models still have wounds left
+func AliveCount(ms []ModelState) int {
+    n := 0
+    for _, m := range ms {
+        if m.Alive() { n++ }
+    }
+    return n
+}
+
+// unitModels returns the defender's models, treating a unit without a model list
+// as a single model whose wounds are the unit's W (the older single-pool form)
+func unitModels(u UnitSnapshot) []ModelState {
+    if len(u.Models) > 0 { return CloneModels(u.Models) }
+    return []ModelState{{Name: u.Name, W: u.W, Wounds: u.W}}
+}
+
+// allocationTarget picks the model the next attack is allocated to: a model that
+// has already lost wounds must be chosen first, otherwise the first model alive.
+// Character models are only eligible once the bodyguard is gone, while Precision
+// attacks go to them first. Returns -1 when the unit is destroyed.
+func allocationTarget(ms []ModelState, precision bool) int {
+    chars, others := 0, 0
+    for _, m := range ms {
+        if !m.Alive() { continue }
+        if m.Character { chars++ } else { others++ }
+    }
+    wantChar := others == 0 || (precision && chars > 0)
+    first := -1
+    for i, m := range ms {
+        if !m.Alive() || m.Character != wantChar { continue }
+        if m.Wounds < m.W { return i }
+        if first < 0 { first = i }
+    }
+    return first
+}
+
+// allocateDamage applies one attack's damage to the next model. Damage beyond what
+// that model can take is lost. Returns the wounds removed and the allocation event.
+func allocateDamage(ms []ModelState, dmg int, precision bool) (int, bool, Event) {
+    idx := allocationTarget(ms, precision)
+    if idx < 0 {
+        return 0, false, Event{Kind: EventAllocation, Lost: dmg}
+    }
+    m := &ms[idx]
+    applied := dmg
+    if applied > m.Wounds { applied = m.Wounds }
+    m.Wounds -= applied
+    ev := Event{Kind: EventAllocation, Index: idx + 1, Name: m.Name, Value: applied, Left: m.Wounds, Lost: dmg - applied}
+    if m.Wounds == 0 {
+        ev.Outcome = OutcomeSlain
+        return applied, true, ev
+    }
+    return applied, false, ev
+}
+
+// allocateMortalWounds applies mortal wounds one at a time, so unlike normal damage
+// they spill over to the next model. Returns wounds removed, models slain and allocation events.
+func allocateMortalWounds(ms []ModelState, n int, precision bool) (int, int, []Event) {
+    applied, slain := 0, 0
+    var events []Event
+    for i := 0; i < n; i++ {
+        idx := allocationTarget(ms, precision)
+        if idx < 0 {
+            events = append(events, Event{Kind: EventAllocation, Lost: n - i, Mortal: true})
+            break
+        }
+        ms[idx].Wounds--
+        applied++
+        if ms[idx].Wounds == 0 {
+            slain++
+            events = append(events, Event{Kind: EventAllocation, Index: idx + 1, Name: ms[idx].Name, Outcome: OutcomeSlain, Mortal: true})
+        }
+    }
+    if idx := allocationTarget(ms, precision); idx >= 0 && ms[idx].Wounds < ms[idx].W {
+        events = append(events, Event{Kind: EventAllocation, Index: idx + 1, Name: ms[idx].Name, Left: ms[idx].Wounds, Mortal: true})
+    }
+    return applied, slain, events
+}
+
+// woundsOnDamagedModel returns the wounds left on a model that is damaged but alive, or 0
+func woundsOnDamagedModel(ms []ModelState) int {
+    for _, m := range ms {
+        if m.Alive() && m.Wounds < m.W { return m.Wounds }
+    }
+    return 0
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func squad(n, w int) []ModelState {
+    ms := make([]ModelState, n)
+    for i := range ms { ms[i] = ModelState{Name: "Trooper", W: w, Wounds: w} }
+    return ms
+}
+
+func TestAllocationTargetPrefersDamagedModel(t *testing.T) {
+    ms := squad(3, 2)
+    ms[2].Wounds = 1
+    if got := allocationTarget(ms, false); got != 2 {
+        t.Errorf("allocationTarget = %d, want the damaged model 2", got)
+    }
+    ms[2].Wounds, ms[0].Wounds = 2, 0
+    if got := allocationTarget(ms, false); got != 1 {
+        t.Errorf("allocationTarget = %d, want the first model alive, 1", got)
+    }
+}
+
+// TestShootingExcessDamageIsLost checks each attack's damage stays on one model
+func TestShootingExcessDamageIsLost(t *testing.T) {
+    w := WeaponSnapshot{Name: "Lascannon", Type: "ranged", Attacks: "2", Skill: 3, Strength: 12, AP: -3, Damage: "3"}
+    def := UnitSnapshot{Name: "Squad", T: 4, Sv: 3, Models: squad(3, 2)}
+    // hits 3, 3; wounds 2, 2; saves 1, 1
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 3, 2, 2, 1, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.DamageTotal != 6 || res.ModelsSlain != 2 || res.DefenderWounds != 2 {
+        t.Errorf("damage %d slain %d left %d, want 6 2 2", res.DamageTotal, res.ModelsSlain, res.DefenderWounds)
+    }
+    var left []int
+    for _, m := range res.Models { left = append(left, m.Wounds) }
+    if want := []int{0, 0, 2}; !reflect.DeepEqual(left, want) {
+        t.Errorf("wounds left %v, want %v", left, want)
+    }
+    if def.Models[0].Wounds != 2 {
+        t.Error("the defender's models were changed in place")
+    }
+}
+
+func TestShootingWoundsLeftOnModel(t *testing.T) {
+    w := WeaponSnapshot{Name: "Bolter", Type: "ranged", Attacks: "1", Skill: 3, Strength: 4, Damage: "1"}
+    def := UnitSnapshot{Name: "Squad", T: 4, Sv: 3, Models: squad(2, 3)}
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 4, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.WoundsLeftOnModel != 2 || res.DefenderWounds != 5 {
+        t.Errorf("wounds on model %d, left %d, want 2 and 5", res.WoundsLeftOnModel, res.DefenderWounds)
+    }
+}
@@ -0,0 +1,47 @@
+package engine
+
+// BelowHalfStrength reports whether a unit is Below Half-strength: fewer than half its
+// starting models, or for a single-model unit fewer than half its wounds
+func BelowHalfStrength(ms []ModelState) bool {
+    if len(ms) == 0 { return false }
+    if len(ms) == 1 {
+        return ms[0].Wounds*2 < ms[0].W
+    }
+    return AliveCount(ms)*2 < len(ms)
+}
+
+// BattleShockTest captures a Battle-shock test: 2D6 must equal or beat the unit's Leadership
+type BattleShockTest struct {
+    Unit   string   `json:"unit"`
+    Ld     int      `json:"ld"`
+    Rolls  [2]int   `json:"rolls"`
+    Total  int      `json:"total"`
+    Passed bool     `json:"passed"`
+    Logs   []string `json:"logs"` // Events rendered as text
+    Events []Event  `json:"events"`
+}
+
+// ResolveBattleShock rolls a Battle-shock test for a unit. A unit without a Leadership
+// characteristic (Ld 0) is treated as Ld 7+.
+func ResolveBattleShock(u UnitSnapshot, r Roller) BattleShockTest {
+    if r == nil { r = newRNG() }
+    ld := u.Ld
+    if ld <= 0 { ld = 7 }
+    t := BattleShockTest{Unit: u.Name, Ld: ld, Rolls: [2]int{r.Roll(6), r.Roll(6)}}
+    t.Total = t.Rolls[0] + t.Rolls[1]
+    t.Passed = t.Total >= ld
+    outcome := OutcomeFailed
+    if t.Passed { outcome = OutcomeSuccess }
+    t.Events = []Event{
+        {Kind: EventBattleShock, Name: u.Name},
+        {Kind: EventBattleShock, Name: u.Name, Rolls: t.Rolls[:], Value: t.Total, Target: ld, Outcome: outcome},
+    }
+    t.Logs = FormatEvents(t.Events)
+    return t
+}
+
+// ObjectiveControl returns a unit's OC, which is 0 while it is Battle-shocked
+func ObjectiveControl(oc int, battleShocked bool) int {
+    if battleShocked { return 0 }
+    return oc
+}
@@ -0,0 +1,55 @@
+package engine
+
+import "testing"
+
+func TestBelowHalfStrength(t *testing.T) {
+    ms := squad(5, 1)
+    ms[0].Wounds, ms[1].Wounds = 0, 0
+    if BelowHalfStrength(ms) {
+        t.Error("3 of 5 models left is not Below Half-strength")
+    }
+    ms[2].Wounds = 0
+    if !BelowHalfStrength(ms) {
+        t.Error("2 of 5 models left is Below Half-strength")
+    }
+    single := []ModelState{{Name: "Tank", W: 12, Wounds: 6}}
+    if BelowHalfStrength(single) {
+        t.Error("6 of 12 wounds left is not Below Half-strength")
+    }
+    single[0].Wounds = 5
+    if !BelowHalfStrength(single) {
+        t.Error("5 of 12 wounds left is Below Half-strength")
+    }
+}
+
+func TestResolveBattleShock(t *testing.T) {
+    for _, c := range []struct {
+        ld     int
+        rolls  []int
+        passed bool
+    }{{6, []int{3, 3}, true}, {6, []int{2, 3}, false}, {0, []int{4, 3}, true}, {0, []int{3, 3}, false}} {
+        bs := ResolveBattleShock(UnitSnapshot{Name: "Squad", Ld: c.ld}, NewScriptedRoller(c.rolls...))
+        if bs.Passed != c.passed || bs.Total != c.rolls[0]+c.rolls[1] {
+            t.Errorf("Ld %d rolling %v: passed %v total %d, want %v", c.ld, c.rolls, bs.Passed, bs.Total, c.passed)
+        }
+    }
+}
+
+func TestTurnStateBattleShockWearsOff(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    ts.RecordBattleShock(true, false)
+    if !ts.IsBattleShocked("alice") || ts.IsBattleShocked("bob") || !ts.Turn.ShockTested {
+        t.Fatalf("after a failed test: %+v", ts)
+    }
+    if ObjectiveControl(2, ts.IsBattleShocked("alice")) != 0 {
+        t.Error("a Battle-shocked unit kept its OC")
+    }
+    ts.EndTurn()
+    if !ts.IsBattleShocked("alice") {
+        t.Error("Battle-shock wore off before alice's next Command phase")
+    }
+    ts.EndTurn()
+    if ts.IsBattleShocked("alice") || ts.Turn.ShockTested {
+        t.Errorf("Battle-shock didn't wear off at alice's Command phase: %+v", ts)
+    }
+}
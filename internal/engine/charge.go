@@ -0,0 +1,92 @@
+package engine
+
+import "fmt"
+
+// MaxChargeDistance is the furthest a unit can declare a charge against
+const MaxChargeDistance = 12
+
+// OverwatchFire is a defender's Fire Overwatch reaction against a charging unit
+type OverwatchFire struct {
+    Unit   UnitSnapshot // the unit firing Overwatch
+    Weapon WeaponSnapshot
+}
+
+// ChargeOptions carries the per-charge inputs
+type ChargeOptions struct {
+    Roller   Roller // dice source; nil means a fresh time-seeded roller
+    Distance int    // declared distance to the target in inches (1-12)
+    // Optional Fire Overwatch by the target, resolved before the charge roll
+    Overwatch *OverwatchFire
+    Quiet     bool    // skip events and logs (see ShootingOptions.Quiet)
+    Ruleset   Ruleset // for the Overwatch volley; nil means DefaultRuleset
+}
+
+// ChargeResult captures a charge attempt
+type ChargeResult struct {
+    Logs      []string        `json:"logs"` // Events rendered as text
+    Events    []Event         `json:"events"`
+    Distance  int             `json:"distance"`
+    Rolls     [2]int          `json:"rolls"` // the 2D6 charge roll; zero if the charger never rolled
+    Total     int             `json:"total"`
+    Success   bool            `json:"success"`
+    Overwatch *ShootingResult `json:"overwatch,omitempty"` // nil unless Overwatch was fired
+    Models    []ModelState    `json:"models"` // the charging unit after Overwatch
+    Wounds    int             `json:"wounds"` // wounds the charging unit has left
+    Seed      int64           `json:"seed"`
+}
+
+// ResolveCharge resolves a charge: the target may Fire Overwatch first (hitting only on
+// 6s, and only if the charger is within the weapon's range), then the charger rolls 2D6
+// and succeeds if the total reaches the declared distance
+func ResolveCharge(charger UnitSnapshot, opts ChargeOptions) (ChargeResult, error) {
+    if opts.Distance < 1 || opts.Distance > MaxChargeDistance {
+        return ChargeResult{}, fmt.Errorf("charge distance %d\" out of range (want 1-%d\")", opts.Distance, MaxChargeDistance)
+    }
+    ev := &eventLog{quiet: opts.Quiet}
+    rng := opts.Roller
+    if rng == nil { rng = newRNG() }
+    var seed int64
+    if sd, ok := rng.(Seeder); ok {
+        seed = sd.Seed()
+        ev.add(Event{Kind: EventSeed, Seed: seed})
+    }
+    res := ChargeResult{Distance: opts.Distance, Seed: seed, Models: unitModels(charger)}
+    ev.add(Event{Kind: EventCharge, Name: charger.Name, Target: opts.Distance})
+    done := func() (ChargeResult, error) {
+        res.Events, res.Logs = ev.events, ev.logs()
+        return res, nil
+    }
+
+    ow := opts.Overwatch
+    if ow != nil {
+        // Overwatch can only target a charger within range; out of range it simply isn't fired
+        if err := CheckRange(ow.Weapon, opts.Distance); err != nil {
+            if !ev.quiet { ev.add(note(EventNote, "%s can't fire Overwatch: %v", ow.Unit.Name, err)) }
+            ow = nil
+        }
+    }
+    if ow != nil {
+        charger.Models = res.Models
+        vr, err := ResolveShootingWith(ow.Unit, charger, ow.Weapon, ShootingOptions{Roller: unseededRoller{rng}, Distance: opts.Distance, Overwatch: true, Quiet: opts.Quiet, Ruleset: opts.Ruleset})
+        if err != nil {
+            return ChargeResult{}, err
+        }
+        ev.add(ability("Fire Overwatch", "%s fires with %s", ow.Unit.Name, ow.Weapon.Name))
+        ev.add(nest(vr.Events)...)
+        res.Overwatch = &vr
+        res.Models = vr.Models
+        if AliveCount(res.Models) == 0 {
+            ev.add(note(EventNote, "%s was destroyed by Overwatch; the charge fails", charger.Name))
+            return done()
+        }
+    }
+
+    res.Rolls = [2]int{rng.Roll(6), rng.Roll(6)}
+    res.Total = res.Rolls[0] + res.Rolls[1]
+    res.Success = res.Total >= opts.Distance
+    res.Wounds = ModelsRemaining(res.Models)
+    roll := Event{Kind: EventChargeRoll, Name: charger.Name, Rolls: res.Rolls[:], Value: res.Total, Target: opts.Distance, Outcome: OutcomeFailed}
+    if res.Success { roll.Outcome = OutcomeSuccess }
+    ev.add(roll)
+    return done()
+}
@@ -0,0 +1,79 @@
+package engine
+
+import "testing"
+
+func TestResolveChargeRoll(t *testing.T) {
+    unit := UnitSnapshot{Name: "Boyz", T: 5, Sv: 5, W: 10}
+    for _, c := range []struct {
+        rolls   []int
+        success bool
+    }{{[]int{4, 3}, true}, {[]int{3, 3}, false}} {
+        res, err := ResolveCharge(unit, ChargeOptions{Roller: NewScriptedRoller(c.rolls...), Distance: 7})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Success != c.success || res.Total != c.rolls[0]+c.rolls[1] || res.Wounds != 10 {
+            t.Errorf("rolls %v: success %v total %d wounds %d, want %v", c.rolls, res.Success, res.Total, res.Wounds, c.success)
+        }
+    }
+    if _, err := ResolveCharge(unit, ChargeOptions{Distance: 13}); err == nil {
+        t.Error("a 13\" charge was accepted")
+    }
+}
+
+func TestResolveChargeOverwatch(t *testing.T) {
+    charger := UnitSnapshot{Name: "Boyz", T: 5, Sv: 7, Models: squad(2, 1)}
+    gun := WeaponSnapshot{Name: "Bolter", Type: "ranged", Range: 24, Attacks: "2", Skill: 3, Strength: 5, Damage: "1"}
+    ow := &OverwatchFire{Unit: UnitSnapshot{Name: "Marines"}, Weapon: gun}
+    // Overwatch hits only on 6s: 5 misses, 6 hits and wounds on 4; then the charge rolls 6 + 1
+    res, err := ResolveCharge(charger, ChargeOptions{Roller: NewScriptedRoller(5, 6, 4, 6, 1), Distance: 6, Overwatch: ow})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Overwatch == nil || res.Overwatch.Hits != 1 || res.Wounds != 1 || !res.Success {
+        t.Errorf("overwatch %+v, wounds %d, success %v; want 1 hit, 1 wound left and a successful charge", res.Overwatch, res.Wounds, res.Success)
+    }
+    // a charger destroyed by Overwatch never rolls
+    res, err = ResolveCharge(charger, ChargeOptions{Roller: NewScriptedRoller(6, 6, 4, 4), Distance: 6, Overwatch: ow})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Success || res.Rolls != [2]int{} || res.Wounds != 0 {
+        t.Errorf("destroyed charger: success %v rolls %v wounds %d", res.Success, res.Rolls, res.Wounds)
+    }
+}
+
+func TestOverwatchOutOfRange(t *testing.T) {
+    charger := UnitSnapshot{Name: "Boyz", T: 5, Sv: 7, Models: squad(2, 1)}
+    pistol := WeaponSnapshot{Name: "Bolt pistol", Type: "ranged", Range: 6, Attacks: "1", Skill: 3, Strength: 4, Damage: "1"}
+    ow := &OverwatchFire{Unit: UnitSnapshot{Name: "Marines"}, Weapon: pistol}
+    // the charger starts 9" away, beyond the pistol: the first dice are the charge roll
+    rng := NewScriptedRoller(5, 4)
+    res, err := ResolveCharge(charger, ChargeOptions{Roller: rng, Distance: 9, Overwatch: ow})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Overwatch != nil || !res.Success || res.Wounds != 2 || rng.Used() != 2 {
+        t.Errorf("overwatch %+v, success %v, wounds %d, dice %d; want no Overwatch and a 9\" charge", res.Overwatch, res.Success, res.Wounds, rng.Used())
+    }
+}
+
+func TestTurnStateFailedCharge(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    if err := ts.AdvanceTo(PhaseCharge); err != nil {
+        t.Fatal(err)
+    }
+    ts.RecordCharge(false)
+    if ts.Engaged || ts.Check("alice", ActionCharge) == nil {
+        t.Error("a unit could charge again after failing")
+    }
+    ts.EndTurn()
+    ts.EndTurn()
+    if err := ts.AdvanceTo(PhaseCharge); err != nil {
+        t.Fatal(err)
+    }
+    ts.RecordCharge(true)
+    if !ts.Engaged || ts.Check("alice", ActionCharge) == nil {
+        t.Error("a successful charge didn't engage the units")
+    }
+}
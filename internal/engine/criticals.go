@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// critThreshold is the unmodified roll that scores a critical, and the rule that set it:
+// its label, and the ability and parameters for events
+type critThreshold struct {
+    TN      int
+    Source  string
+    Ability string
+    Params  []string
+}
+
+// lower adopts tn when it's a valid threshold that crits more often than the current one
+func (c *critThreshold) lower(tn int, source, ability string, params ...string) {
+    if tn >= 2 && tn < c.TN {
+        c.TN = tn
+        c.Source, c.Ability, c.Params = source, ability, params
+    }
+}
+
+// isCrit reports whether an unmodified roll is a critical
+func (c critThreshold) isCrit(roll int) bool { return roll >= c.TN }
+
+// label renders the threshold for logs, e.g. "6" or "5+"
+func (c critThreshold) label() string {
+    if c.TN >= 6 { return "6" }
+    return fmt.Sprintf("%d+", c.TN)
+}
+
+// critParam extracts X from "<label> X+" or "<label> on X+" (lowercase, single-spaced)
+func critParam(tok, label string) (int, bool) {
+    if !strings.HasPrefix(tok, label+" ") { return 0, false }
+    x := strings.TrimPrefix(strings.TrimPrefix(tok, label+" "), "on ")
+    if !strings.HasSuffix(x, "+") { return 0, false }
+    tn, err := strconv.Atoi(strings.TrimSuffix(x, "+"))
+    if err != nil || tn < 2 || tn > 6 { return 0, false }
+    return tn, true
+}
+
+// unitCrit finds a "Critical Hits X+" style ability on a unit, returning the best X
+func unitCrit(abilities []string, label string) (int, string) {
+    best, src := 0, ""
+    for _, a := range abilities {
+        lt := strings.Join(strings.Fields(strings.ToLower(a)), " ")
+        for _, l := range []string{label + "s", label} {
+            if tn, ok := critParam(lt, l); ok && (best == 0 || tn < best) {
+                best, src = tn, strings.TrimSpace(a)
+            }
+        }
+    }
+    return best, src
+}
+
+// unitRules is what a unit's own abilities mean for a volley it's part of
+type unitRules struct {
+    critHit, critWound, fnp          int
+    critHitSrc, critWoundSrc, fnpSrc string
+}
+
+var unitRulesCache = memo[unitRules]{limit: 4096}
+
+// unitRulesOf parses a unit's abilities for critical thresholds and Feel No Pain, once
+// per distinct ability list
+func unitRulesOf(abilities []string) unitRules {
+    key := memoKey(abilities)
+    if r, ok := unitRulesCache.load(key); ok { return r }
+    var r unitRules
+    r.critHit, r.critHitSrc = unitCrit(abilities, "critical hit")
+    r.critWound, r.critWoundSrc = unitCrit(abilities, "critical wound")
+    r.fnp, r.fnpSrc = feelNoPain(abilities)
+    unitRulesCache.store(key, r)
+    return r
+}
+
+// volleyCriticals works out the critical hit and wound thresholds for a volley. Criticals
+// score on an unmodified 6 unless the weapon, the attacker's abilities, the caller or a
+// matching Anti-KEYWORD X+ lowers them; the lowest threshold wins.
+func volleyCriticals(att, def UnitSnapshot, ab WeaponAbilities, opts ShootingOptions) (critThreshold, critThreshold) {
+    hit := critThreshold{TN: 6}
+    wound := critThreshold{TN: 6}
+    tn := func(x int) string { return fmt.Sprintf("%d+", x) }
+    if ab.CritHit > 0 { hit.lower(ab.CritHit, "Critical Hits "+tn(ab.CritHit), "Critical Hits", tn(ab.CritHit)) }
+    if ab.CritWound > 0 { wound.lower(ab.CritWound, "Critical Wounds "+tn(ab.CritWound), "Critical Wounds", tn(ab.CritWound)) }
+    ur := unitRulesOf(att.Abilities)
+    if ur.critHit > 0 { hit.lower(ur.critHit, ur.critHitSrc, "Critical Hits", tn(ur.critHit)) }
+    if ur.critWound > 0 { wound.lower(ur.critWound, ur.critWoundSrc, "Critical Wounds", tn(ur.critWound)) }
+    hit.lower(opts.CritHit, "Critical hit option", "Critical Hits", tn(opts.CritHit))
+    wound.lower(opts.CritWound, "Critical wound option", "Critical Wounds", tn(opts.CritWound))
+    // Anti-KEYWORD X+: an unmodified wound roll of X+ is a critical wound against that keyword
+    for _, an := range ab.Anti {
+        for _, dk := range def.Keywords {
+            // whole keywords only, so Anti-Fly doesn't reach a Flyer
+            if strings.EqualFold(strings.TrimSpace(dk), an.Keyword) {
+                kw := an.Keyword
+                if kw != "" { kw = strings.ToUpper(kw[:1]) + kw[1:] }
+                wound.lower(an.Threshold, fmt.Sprintf("Anti-%s %d+ (defender has '%s')", kw, an.Threshold, dk), "Anti", kw, tn(an.Threshold))
+                break
+            }
+        }
+    }
+    return hit, wound
+}
@@ -0,0 +1,87 @@
+package engine
+
+import "testing"
+
+func TestShootingCriticalHits(t *testing.T) {
+    w := WeaponSnapshot{Name: "Bolt rifle", Type: "ranged", Attacks: "2", Skill: 3, Strength: 4, Damage: "1", Abilities: []string{"Lethal Hits"}}
+    def := UnitSnapshot{Name: "Target", T: 4, Sv: 3, W: 10}
+    // hits: 6 (critical, auto-wounds), 4; wound: 4; saves: 1, 3
+    rng := NewScriptedRoller(6, 4, 4, 1, 3)
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: rng})
+    if err != nil {
+        t.Fatal(err)
+    }
+    sp := res.Subphases
+    if res.Hits != 2 || sp.Hits.Critical != 1 || res.Wounds != 2 || res.Saved != 1 || res.Unsaved != 1 || res.DefenderWounds != 9 {
+        t.Errorf("got hits %d (crit %d) wounds %d saved %d unsaved %d left %d, want 2 (1) 2 1 1 9",
+            res.Hits, sp.Hits.Critical, res.Wounds, res.Saved, res.Unsaved, res.DefenderWounds)
+    }
+    if got := rng.Used(); got != 5 {
+        t.Errorf("rolled %d dice, want 5 (the auto-wound is not rolled)", got)
+    }
+}
+
+func TestCriticalThresholds(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "2", Skill: 3, Strength: 4, Damage: "1", Abilities: []string{"Sustained Hits 1"}}
+    target := UnitSnapshot{T: 4, Sv: 7, W: 10}
+    // hit rolls 5, 5: criticals only when they score on 5+
+    for _, c := range []struct {
+        opts ShootingOptions
+        att  UnitSnapshot
+        hits int
+        crit int
+    }{
+        {ShootingOptions{}, UnitSnapshot{}, 2, 6},
+        {ShootingOptions{CritHit: 5}, UnitSnapshot{}, 4, 5},
+        {ShootingOptions{}, UnitSnapshot{Abilities: []string{"Critical Hits 5+"}}, 4, 5},
+    } {
+        c.opts.Roller = NewScriptedRoller(5, 5, 1, 1, 1, 1)
+        res, err := ResolveShootingWith(c.att, target, w, c.opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Hits != c.hits || res.Subphases.Hits.CritTarget != c.crit {
+            t.Errorf("crit option %d, attacker %v: %d hits, crits on %d+; want %d, %d+",
+                c.opts.CritHit, c.att.Abilities, res.Hits, res.Subphases.Hits.CritTarget, c.hits, c.crit)
+        }
+    }
+    if _, err := ResolveShootingWith(UnitSnapshot{}, target, w, ShootingOptions{CritWound: 7}); err == nil {
+        t.Error("a critical threshold of 7+ was accepted")
+    }
+}
+
+func TestAntiScoresCriticalWounds(t *testing.T) {
+    w := WeaponSnapshot{Name: "Shuriken", Type: "ranged", Attacks: "1", Skill: 3, Strength: 3, Damage: "1", Abilities: []string{"Anti-Infantry 4+", "Devastating Wounds"}}
+    // hit 3, wound 4: fails S3 vs T5 (6+), but is a critical wound against Infantry
+    for _, c := range []struct {
+        keywords []string
+        mortal   int
+    }{{[]string{"Infantry"}, 1}, {[]string{"Vehicle"}, 0}} {
+        def := UnitSnapshot{T: 5, Sv: 2, W: 5, Keywords: c.keywords}
+        res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 4, 6)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.MortalWounds != c.mortal || res.Subphases.Wounds.Critical != c.mortal {
+            t.Errorf("%v: %d mortal wounds from %d criticals, want %d", c.keywords, res.MortalWounds, res.Subphases.Wounds.Critical, c.mortal)
+        }
+    }
+}
+
+func TestAntiMatchesWholeKeywords(t *testing.T) {
+    w := WeaponSnapshot{Name: "Flakk missile", Type: "ranged", Attacks: "1", Skill: 3, Strength: 3, Damage: "1", Abilities: []string{"Anti-Fly 4+"}}
+    // hit 3, wound 4: fails S3 vs T5 (6+) unless it's a critical wound
+    for _, c := range []struct {
+        keywords []string
+        wounds   int
+    }{{[]string{"FLY"}, 1}, {[]string{"Flyer"}, 0}, {[]string{"Vehicle", "Aircraft"}, 0}} {
+        def := UnitSnapshot{T: 5, Sv: 7, W: 5, Keywords: c.keywords}
+        res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 4, 1)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Wounds != c.wounds {
+            t.Errorf("%v: %d wounds, want %d", c.keywords, res.Wounds, c.wounds)
+        }
+    }
+}
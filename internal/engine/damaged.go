@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DamagedProfile is a vehicle or monster's degraded bracket (Datasheets.csv damaged_w and
+// damaged_description): while a model has MinW-MaxW wounds left its attacks take HitMod and
+// its Objective Control drops by OCLoss. Other effects in the text are not modelled.
+type DamagedProfile struct {
+    MinW        int    `json:"min_w"`
+    MaxW        int    `json:"max_w"`
+    HitMod      int    `json:"hit_mod,omitempty"`
+    OCLoss      int    `json:"oc_loss,omitempty"`
+    Description string `json:"description"`
+}
+
+var (
+    reDamagedRange = regexp.MustCompile(`^(\d+)\s*-\s*(\d+)$`)
+    reDamagedHit   = regexp.MustCompile(`(?i)subtract (\d+) from the hit roll`)
+    reDamagedOC    = regexp.MustCompile(`(?i)subtract (\d+) from (?:this model.s|its) objective control`)
+)
+
+// ParseDamagedProfile reads a damaged bracket such as "1-4" and its rules text; ok is false
+// when the datasheet has none
+func ParseDamagedProfile(w, desc string) (DamagedProfile, bool) {
+    m := reDamagedRange.FindStringSubmatch(strings.TrimSpace(w))
+    if m == nil { return DamagedProfile{}, false }
+    p := DamagedProfile{Description: strings.TrimSpace(desc)}
+    p.MinW, _ = strconv.Atoi(m[1])
+    p.MaxW, _ = strconv.Atoi(m[2])
+    if hm := reDamagedHit.FindStringSubmatch(desc); hm != nil {
+        n, _ := strconv.Atoi(hm[1])
+        p.HitMod = -n
+    }
+    if om := reDamagedOC.FindStringSubmatch(desc); om != nil {
+        p.OCLoss, _ = strconv.Atoi(om[1])
+    }
+    return p, true
+}
+
+// Applies reports whether any surviving model has wounds left inside the bracket
+func (p DamagedProfile) Applies(ms []ModelState) bool {
+    for _, m := range ms {
+        if m.Wounds > 0 && m.Wounds >= p.MinW && m.Wounds <= p.MaxW { return true }
+    }
+    return false
+}
+
+// Effects renders the modelled effects for the log, e.g. "-1 to hit, OC -5"
+func (p DamagedProfile) Effects() string {
+    var parts []string
+    if p.HitMod != 0 { parts = append(parts, fmt.Sprintf("%+d to hit", p.HitMod)) }
+    if p.OCLoss != 0 { parts = append(parts, fmt.Sprintf("OC -%d", p.OCLoss)) }
+    if len(parts) == 0 { return "no modelled effect" }
+    return strings.Join(parts, ", ")
+}
+
+// IsDamaged reports whether a unit fights on its damaged profile: once one of its models
+// has dropped into the bracket it stays degraded for the rest of the match
+func IsDamaged(u UnitSnapshot) bool {
+    if u.Damaged == nil { return false }
+    return u.Degraded || u.Damaged.Applies(unitModels(u))
+}
+
+// damagedModifiers is the hit penalty a degraded attacker suffers
+func damagedModifiers(att UnitSnapshot) Modifiers {
+    if !IsDamaged(att) || att.Damaged.HitMod == 0 { return nil }
+    return Modifiers{{Stage: StageHit, Value: att.Damaged.HitMod, Source: "Damaged"}}
+}
+
+// damagedEvent announces a unit dropping into its damaged bracket; ok is false if it hasn't
+func damagedEvent(before, after UnitSnapshot) (Event, bool) {
+    if IsDamaged(before) || !IsDamaged(after) { return Event{}, false }
+    p := after.Damaged
+    e := ability("Damaged", "%s has %d-%d wounds left: %s for the rest of the battle", after.Name, p.MinW, p.MaxW, p.Effects()).withAbility("Damaged", fmt.Sprintf("%d-%d", p.MinW, p.MaxW))
+    if p.HitMod != 0 { e.Stage, e.Modifier = StageHit, p.HitMod }
+    return e, true
+}
+
+// DamagedOC returns a unit's Objective Control after its damaged bracket's penalty
+func DamagedOC(u UnitSnapshot) int {
+    if !IsDamaged(u) { return u.OC }
+    oc := u.OC - u.Damaged.OCLoss
+    if oc < 0 { oc = 0 }
+    return oc
+}
@@ -0,0 +1,65 @@
+package engine
+
+import "testing"
+
+func TestParseDamagedProfile(t *testing.T) {
+    p, ok := ParseDamagedProfile("1-4", "While this model has 1-4 wounds remaining, subtract 5 from this model's Objective Control characteristic and each time this model makes an attack, subtract 1 from the Hit roll.")
+    if !ok || p.MinW != 1 || p.MaxW != 4 || p.HitMod != -1 || p.OCLoss != 5 {
+        t.Errorf("got %+v, %v", p, ok)
+    }
+    if p.Effects() != "-1 to hit, OC -5" {
+        t.Errorf("Effects() = %q", p.Effects())
+    }
+    if _, ok := ParseDamagedProfile("", ""); ok {
+        t.Error("a datasheet without a bracket parsed as damaged")
+    }
+}
+
+func TestDamagedBracketApplies(t *testing.T) {
+    p := DamagedProfile{MinW: 1, MaxW: 4, HitMod: -1, OCLoss: 2}
+    tank := UnitSnapshot{Name: "Tank", W: 12, OC: 3, Damaged: &p, Models: []ModelState{{Name: "Tank", W: 12, Wounds: 5}}}
+    if IsDamaged(tank) || DamagedOC(tank) != 3 {
+        t.Errorf("5 wounds left: damaged %v OC %d, want false 3", IsDamaged(tank), DamagedOC(tank))
+    }
+    tank.Models[0].Wounds = 4
+    if !IsDamaged(tank) || DamagedOC(tank) != 1 {
+        t.Errorf("4 wounds left: damaged %v OC %d, want true 1", IsDamaged(tank), DamagedOC(tank))
+    }
+    // Once degraded a unit stays degraded, even if it is healed out of the bracket
+    tank.Models[0].Wounds, tank.Degraded = 8, true
+    if !IsDamaged(tank) {
+        t.Error("a degraded unit recovered")
+    }
+}
+
+func TestDamagedAttackerHitPenalty(t *testing.T) {
+    w := WeaponSnapshot{Name: "Battle cannon", Type: "ranged", Attacks: "1", Skill: 3, Strength: 4, Damage: "1"}
+    def := UnitSnapshot{Name: "Target", T: 4, Sv: 7, W: 10}
+    p := DamagedProfile{MinW: 1, MaxW: 4, HitMod: -1}
+    att := UnitSnapshot{Name: "Tank", W: 12, Damaged: &p, Models: []ModelState{{Name: "Tank", W: 12, Wounds: 12}}}
+    // A hit roll of 3 hits on 3+, but misses at -1 once the tank is damaged
+    for _, c := range []struct{ wounds, hits int }{{12, 1}, {3, 0}} {
+        att.Models[0].Wounds = c.wounds
+        res, err := ResolveShootingWith(att, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 4)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Hits != c.hits {
+            t.Errorf("attacker on %d wounds: %d hits, want %d", c.wounds, res.Hits, c.hits)
+        }
+    }
+}
+
+func TestFightMarksDefenderDamaged(t *testing.T) {
+    p := DamagedProfile{MinW: 1, MaxW: 4, HitMod: -1}
+    tank := Fighter{Unit: UnitSnapshot{Name: "Tank", T: 10, Sv: 7, W: 6, Damaged: &p}}
+    // hit 3, wound 6, save 1: 3 damage leaves the tank on 3 wounds
+    ogre := Fighter{Unit: UnitSnapshot{Name: "Ogre", T: 6, Sv: 7, W: 6}, Weapons: []WeaponSnapshot{melee("Club", "1", "3")}, Charged: true}
+    res, err := ResolveFight(ogre, tank, FightOptions{Roller: NewScriptedRoller(3, 6, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if s := res.Sides[1]; s.Wounds != 3 || !s.Damaged {
+        t.Errorf("tank: %d wounds damaged %v, want 3 true", s.Wounds, s.Damaged)
+    }
+}
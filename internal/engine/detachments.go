@@ -0,0 +1,152 @@
+package engine
+
+import "strings"
+
+// Conditions under which a detachment rule's effect applies to an attack
+const (
+    CondAlways              = ""
+    CondChosenTarget        = "chosen_target" // the target picked by the rule (quarry, focus, ...); in a duel, the opposing unit
+    CondBelowStarting       = "below_starting_strength"
+    CondBelowHalf           = "below_half_strength"
+    CondTargetBelowStarting = "target_below_starting_strength"
+    CondTargetBelowHalf     = "target_below_half_strength"
+)
+
+// DetachmentEffect is one roll modifier or re-roll a detachment rule grants
+type DetachmentEffect struct {
+    Stage          Stage        `json:"stage"`
+    Modifier       int          `json:"modifier,omitempty"`
+    Reroll         RerollPolicy `json:"reroll,omitempty"`
+    When           string       `json:"when,omitempty"`
+    Attack         string       `json:"attack,omitempty"`          // "melee" or "ranged" to limit the effect to those attacks
+    TargetKeywords []string     `json:"target_keywords,omitempty"` // the target needs one of these
+}
+
+// DetachmentRule is the part of a detachment ability the engine can apply to attacks
+type DetachmentRule struct {
+    Name     string             `json:"name"`
+    Keywords []string           `json:"keywords,omitempty"` // the attacking unit needs one of these
+    Exclude  []string           `json:"exclude,omitempty"`  // units with any of these don't benefit
+    Effects  []DetachmentEffect `json:"effects"`
+}
+
+// detachmentRules are the detachment abilities expressible as modifiers and re-rolls,
+// keyed by ability name. Faction keywords are implied by the detachment's faction.
+var detachmentRules = map[string]DetachmentRule{
+    "assemblage of might": {Keywords: []string{"Character"}, Effects: []DetachmentEffect{
+        {Stage: StageWound, Modifier: 1, When: CondChosenTarget},
+    }},
+    "against all odds": {Exclude: []string{"Vehicle"}, Effects: []DetachmentEffect{
+        {Stage: StageHit, Modifier: 1},
+        {Stage: StageWound, Modifier: 1},
+    }},
+    "priority quarry": {Keywords: []string{"Anathema Psykana"}, Effects: []DetachmentEffect{
+        {Stage: StageHit, Reroll: RerollOnes, When: CondChosenTarget},
+    }},
+    "focus of hatred": {Exclude: []string{"Damned"}, Effects: []DetachmentEffect{
+        {Stage: StageHit, Reroll: RerollFailed, When: CondChosenTarget},
+    }},
+    "worthy foes": {Keywords: []string{"Noble", "Lychguard", "Triarch"}, Effects: []DetachmentEffect{
+        {Stage: StageWound, Modifier: 1, When: CondChosenTarget},
+    }},
+    "destroy the daemonic": {Keywords: []string{"Inquisitor", "Inquisitorial Agents", "Ordo Malleus"}, Effects: []DetachmentEffect{
+        {Stage: StageHit, Reroll: RerollOnes},
+        {Stage: StageWound, Reroll: RerollOnes, TargetKeywords: []string{"Daemon"}},
+    }},
+    "the blood of martyrs": {Effects: []DetachmentEffect{
+        {Stage: StageHit, Modifier: 1, When: CondBelowStarting},
+        {Stage: StageWound, Modifier: 1, When: CondBelowHalf},
+    }},
+    "hunter’s instincts": {Keywords: []string{"Kroot"}, Effects: []DetachmentEffect{
+        {Stage: StageHit, Modifier: 1, When: CondTargetBelowStarting},
+        {Stage: StageWound, Modifier: 1, When: CondTargetBelowHalf},
+    }},
+    "enraged behemoths": {Keywords: []string{"Monster"}, Effects: []DetachmentEffect{
+        {Stage: StageHit, Modifier: 1, When: CondBelowStarting},
+        {Stage: StageWound, Modifier: 1, When: CondBelowHalf},
+    }},
+    "a noble death in combat": {Keywords: []string{"Death Company"}, Effects: []DetachmentEffect{
+        {Stage: StageWound, Reroll: RerollOnes, When: CondBelowStarting, Attack: "melee"},
+        {Stage: StageWound, Reroll: RerollFailed, When: CondBelowHalf, Attack: "melee"},
+    }},
+}
+
+// DetachmentRuleFor returns the engine rule for a detachment ability by name; false
+// means the ability has no effect the engine can express
+func DetachmentRuleFor(name string) (DetachmentRule, bool) {
+    key := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(name, "'", "’")), " "))
+    r, ok := detachmentRules[key]
+    if ok { r.Name = strings.TrimSpace(name) }
+    return r, ok
+}
+
+// Applies reports whether a unit benefits from the rule
+func (r DetachmentRule) Applies(u UnitSnapshot) bool {
+    for _, k := range r.Exclude {
+        if hasUnitAbility(u.Keywords, k) { return false }
+    }
+    if len(r.Keywords) == 0 { return true }
+    for _, k := range r.Keywords {
+        if hasUnitAbility(u.Keywords, k) { return true }
+    }
+    return false
+}
+
+// BelowStartingStrength reports whether a unit has lost any models, or for a
+// single-model unit any wounds
+func BelowStartingStrength(ms []ModelState) bool {
+    if len(ms) == 1 { return ms[0].Wounds < ms[0].W }
+    return AliveCount(ms) < len(ms)
+}
+
+// holds reports whether an effect's conditions are met for an attack
+func (e DetachmentEffect) holds(att, def UnitSnapshot, w WeaponSnapshot) bool {
+    if e.Attack == "melee" && !w.IsMelee() { return false }
+    if e.Attack == "ranged" && w.IsMelee() { return false }
+    if len(e.TargetKeywords) > 0 {
+        ok := false
+        for _, k := range e.TargetKeywords {
+            if hasUnitAbility(def.Keywords, k) { ok = true }
+        }
+        if !ok { return false }
+    }
+    switch e.When {
+    case CondBelowStarting:
+        return BelowStartingStrength(unitModels(att))
+    case CondBelowHalf:
+        return BelowHalfStrength(unitModels(att))
+    case CondTargetBelowStarting:
+        return BelowStartingStrength(unitModels(def))
+    case CondTargetBelowHalf:
+        return BelowHalfStrength(unitModels(def))
+    }
+    return true
+}
+
+// DetachmentEffects collects the modifiers and re-rolls the rules grant the attacker for
+// attacks with w against def
+func DetachmentEffects(rules []DetachmentRule, att, def UnitSnapshot, w WeaponSnapshot) (Modifiers, Rerolls) {
+    var ms Modifiers
+    rs := Rerolls{}
+    for _, r := range rules {
+        if !r.Applies(att) { continue }
+        for _, e := range r.Effects {
+            if !e.holds(att, def, w) { continue }
+            if e.Modifier != 0 { ms = append(ms, Modifier{Stage: e.Stage, Value: e.Modifier, Source: r.Name}) }
+            if e.Reroll != RerollNone { rs = MergeRerolls(rs, Rerolls{e.Stage: e.Reroll}) }
+        }
+    }
+    return ms, rs
+}
+
+// MergeRerolls combines re-roll policies per stage: the more permissive of "ones" and
+// "failed" wins, and a "single" re-roll stacks with "ones" (see RerollPolicy.stack)
+func MergeRerolls(a, b Rerolls) Rerolls {
+    out := Rerolls{}
+    for _, rs := range []Rerolls{a, b} {
+        for st, p := range rs {
+            if p = out[st].stack(p); p != RerollNone { out[st] = p }
+        }
+    }
+    return out
+}
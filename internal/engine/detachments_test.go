@@ -0,0 +1,64 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestDetachmentRuleFor(t *testing.T) {
+    r, ok := DetachmentRuleFor("Hunter's  Instincts")
+    if !ok || r.Name != "Hunter's  Instincts" {
+        t.Fatalf("DetachmentRuleFor = %+v, %v", r, ok)
+    }
+    if !r.Applies(UnitSnapshot{Keywords: []string{"Infantry", "Kroot"}}) || r.Applies(UnitSnapshot{Keywords: []string{"Infantry"}}) {
+        t.Error("Hunter's Instincts should apply to Kroot only")
+    }
+    if _, ok := DetachmentRuleFor("Oath of Moment"); ok {
+        t.Error("an unsupported rule was found")
+    }
+    odds, _ := DetachmentRuleFor("Against All Odds")
+    if odds.Applies(UnitSnapshot{Keywords: []string{"Vehicle"}}) {
+        t.Error("an excluded keyword still benefits")
+    }
+}
+
+func TestDetachmentEffects(t *testing.T) {
+    martyrs, _ := DetachmentRuleFor("The Blood of Martyrs")
+    death, _ := DetachmentRuleFor("A Noble Death in Combat")
+    sword := WeaponSnapshot{Name: "Sword", Type: "melee"}
+    gun := WeaponSnapshot{Name: "Gun", Type: "ranged"}
+    att := UnitSnapshot{Keywords: []string{"Death Company"}, Models: squad(4, 1)}
+    def := UnitSnapshot{W: 10}
+    ms, rs := DetachmentEffects([]DetachmentRule{martyrs, death}, att, def, sword)
+    if len(ms) != 0 || len(rs) != 0 {
+        t.Errorf("a unit at full strength got %v %v", ms, rs)
+    }
+    att.Models[0].Wounds = 0
+    ms, rs = DetachmentEffects([]DetachmentRule{martyrs, death}, att, def, sword)
+    if !reflect.DeepEqual(ms, Modifiers{{Stage: StageHit, Value: 1, Source: martyrs.Name}}) || !reflect.DeepEqual(rs, Rerolls{StageWound: RerollOnes}) {
+        t.Errorf("below starting strength: %v %v", ms, rs)
+    }
+    att.Models[1].Wounds, att.Models[2].Wounds = 0, 0
+    ms, rs = DetachmentEffects([]DetachmentRule{martyrs, death}, att, def, sword)
+    if len(ms) != 2 || !reflect.DeepEqual(rs, Rerolls{StageWound: RerollFailed}) {
+        t.Errorf("below half strength: %v %v", ms, rs)
+    }
+    // the re-rolls are melee only
+    if _, rs = DetachmentEffects([]DetachmentRule{death}, att, def, gun); len(rs) != 0 {
+        t.Errorf("ranged attack got %v", rs)
+    }
+}
+
+func TestMergeRerolls(t *testing.T) {
+    got := MergeRerolls(Rerolls{StageHit: RerollOnes, StageWound: RerollFailed}, Rerolls{StageHit: RerollFailed, StageWound: RerollOnes, StageSave: RerollOnes})
+    want := Rerolls{StageHit: RerollFailed, StageWound: RerollFailed, StageSave: RerollOnes}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("MergeRerolls = %v, want %v", got, want)
+    }
+    // a single re-roll stacks with "ones" and is absorbed by "failed"
+    got = MergeRerolls(Rerolls{StageHit: RerollSingle, StageWound: RerollSingle, StageSave: RerollSingle}, Rerolls{StageHit: RerollOnes, StageWound: RerollFailed})
+    want = Rerolls{StageHit: RerollOnesSingle, StageWound: RerollFailed, StageSave: RerollSingle}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("MergeRerolls = %v, want %v", got, want)
+    }
+}
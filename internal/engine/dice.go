@@ -1,45 +1,93 @@
 package engine
 
 import (
+	crand "crypto/rand"
+	"encoding/binary"
 	"math/rand"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 )
 
-var diceRe = regexp.MustCompile(`(?i)^\s*(\d+)?\s*d\s*(\d+)(\s*([+\-x*])\s*(\d+))?\s*$`)
+// Roller is the dice source the engine rolls against. Roll returns a value in 1..sides.
+type Roller interface {
+    Roll(sides int) int
+}
 
-// rollExpr supports: N, NdM, NdM+K, NdM-K, NdM xK (multiply) / * K
-func rollExpr(r *rand.Rand, expr string) int {
-    expr = strings.TrimSpace(expr)
-    if expr == "" { return 0 }
-    // raw int
-    if n, err := strconv.Atoi(expr); err == nil {
-        return n
-    }
-    m := diceRe.FindStringSubmatch(expr)
-    if m == nil {
-        return 0
-    }
-    count := 1
-    if m[1] != "" { count, _ = strconv.Atoi(m[1]) }
-    sides, _ := strconv.Atoi(m[2])
-    total := 0
-    for i := 0; i < count; i++ {
-        total += 1 + r.Intn(sides)
-    }
-    if m[3] != "" {
-        op := m[4]
-        k, _ := strconv.Atoi(m[5])
-        switch op {
-        case "+": total += k
-        case "-": total -= k
-        case "x", "*": total *= k
-        }
+// Seeder is implemented by rollers whose sequence can be reproduced from a seed
+type Seeder interface {
+    Seed() int64
+}
+
+// SeededRoller is a deterministic PRNG roller; the same seed replays the same dice
+type SeededRoller struct {
+    seed int64
+    r    *rand.Rand
+}
+
+func NewSeededRoller(seed int64) *SeededRoller {
+    return &SeededRoller{seed: seed, r: rand.New(rand.NewSource(seed))}
+}
+
+func (s *SeededRoller) Roll(sides int) int {
+    if sides <= 0 { return 0 }
+    return 1 + s.r.Intn(sides)
+}
+
+func (s *SeededRoller) Seed() int64 { return s.seed }
+
+// ScriptedRoller returns a fixed sequence of results (wrapping around when exhausted).
+// Values are clamped into 1..sides so a script of d6 results can't break a d3 roll.
+type ScriptedRoller struct {
+    rolls []int
+    pos   int
+}
+
+func NewScriptedRoller(rolls ...int) *ScriptedRoller {
+    return &ScriptedRoller{rolls: append([]int(nil), rolls...)}
+}
+
+func (s *ScriptedRoller) Roll(sides int) int {
+    if sides <= 0 { return 0 }
+    if len(s.rolls) == 0 { return 1 }
+    v := s.rolls[s.pos%len(s.rolls)]
+    s.pos++
+    if v < 1 { v = 1 }
+    if v > sides { v = sides }
+    return v
+}
+
+// Used reports how many scripted values have been consumed so far
+func (s *ScriptedRoller) Used() int { return s.pos }
+
+// CryptoRoller draws from crypto/rand; not reproducible, so it has no seed
+type CryptoRoller struct{}
+
+func (CryptoRoller) Roll(sides int) int {
+    if sides <= 0 { return 0 }
+    var b [8]byte
+    if _, err := crand.Read(b[:]); err != nil {
+        return 1 + rand.Intn(sides)
     }
-    if total < 0 { total = 0 }
-    return total
+    return 1 + int(binary.LittleEndian.Uint64(b[:])%uint64(sides))
+}
+
+// NewSeed returns a fresh time-based seed. It's kept within 2^53 so it survives
+// a round trip through JSON numbers in the browser.
+func NewSeed() int64 { return time.Now().UnixNano() & (1<<53 - 1) }
+
+// rollExpr rolls a dice expression; see DiceExpr for the grammar
+func rollExpr(r Roller, expr string) int {
+    return MustParseDice(expr).Roll(r)
 }
 
-func newRNG() *rand.Rand { return rand.New(rand.NewSource(time.Now().UnixNano())) }
+func newRNG() Roller { return NewSeededRoller(NewSeed()) }
+
+// AddToExpr adds n to a characteristic that may be a dice expression: "2" -> "3",
+// "D6" -> "D6+1", "D6+1" -> "D6+2". Expressions it can't read are returned unchanged.
+func AddToExpr(expr string, n int) string {
+    expr = strings.TrimSpace(expr)
+    if n == 0 { return expr }
+    d, err := ParseDice(expr)
+    if err != nil { return expr }
+    return d.Add(n)
+}
@@ -0,0 +1,49 @@
+package engine
+
+import "testing"
+
+func TestScriptedRoller(t *testing.T) {
+    r := NewScriptedRoller(6, 2, 9)
+    got := []int{r.Roll(6), r.Roll(3), r.Roll(6), r.Roll(6)}
+    // 9 is clamped to the die's sides, and the script wraps around once exhausted
+    want := []int{6, 2, 6, 6}
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("rolls = %v, want %v", got, want)
+        }
+    }
+    if r.Used() != 4 {
+        t.Errorf("Used() = %d, want 4", r.Used())
+    }
+}
+
+func TestSeededRollerReplays(t *testing.T) {
+    a, b := NewSeededRoller(42), NewSeededRoller(42)
+    for i := 0; i < 100; i++ {
+        if x, y := a.Roll(6), b.Roll(6); x != y || x < 1 || x > 6 {
+            t.Fatalf("roll %d: %d and %d from the same seed", i, x, y)
+        }
+    }
+    if a.Seed() != 42 {
+        t.Errorf("Seed() = %d, want 42", a.Seed())
+    }
+}
+
+func TestRollExpr(t *testing.T) {
+    cases := []struct {
+        expr  string
+        rolls []int
+        want  int
+    }{
+        {"3", nil, 3},
+        {"D6", []int{4}, 4},
+        {"2D6+1", []int{3, 5}, 9},
+        {"D3x2", []int{3}, 6},
+        {"D6-3", []int{1}, 0},
+    }
+    for _, c := range cases {
+        if got := rollExpr(NewScriptedRoller(c.rolls...), c.expr); got != c.want {
+            t.Errorf("rollExpr(%q) with %v = %d, want %d", c.expr, c.rolls, got, c.want)
+        }
+    }
+}
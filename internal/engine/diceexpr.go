@@ -0,0 +1,472 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiceExpr is a parsed Attacks, Damage or ability dice expression. The grammar is
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("x" | "*") N }
+//	factor = N | [N] "D" N [("kh" | "kl") N] | ("best" | "worst") "(" expr ")" | "(" expr ")"
+//
+// so "3", "D6+D3", "2D6kh1" (roll two, keep the highest), "D3x2" and "best(D6)" (roll it
+// twice, keep the higher) all parse. Letters are case-insensitive and spaces are ignored.
+// Results never go below 0.
+type DiceExpr struct {
+    root diceNode
+    dist pmf // exact distribution of Roll, clamped at 0
+}
+
+// diceNode is one part of a dice expression
+type diceNode interface {
+    roll(r Roller) int
+    values() vdist
+    bounds() (lo, hi int) // lowest and highest result, before clamping at 0
+    String() string
+}
+
+// Size limits keep a typo like "100D100" (or a hostile "999999x999999") from stalling
+// or exhausting memory in the exact distribution, whose size grows with the values
+const (
+    maxDiceCount = 30
+    maxDiceSides = 100
+    maxKeepCombos = 50000 // sides^count outcomes enumerated for keep-highest/lowest
+    maxDiceValue  = 200   // no part of an expression, nor any multiplier, may go beyond ±this
+    // The parser recurses once per parenthesis, so the text and its nesting are capped too
+    maxDiceExprLen = 64
+    maxDiceDepth   = 8
+)
+
+var diceCache = memo[DiceExpr]{limit: 4096} // datasheets use a few dozen expressions
+
+// ParseDice parses a dice expression
+func ParseDice(expr string) (DiceExpr, error) {
+    if len(expr) > maxDiceExprLen {
+        return DiceExpr{}, fmt.Errorf("dice expression too long (%d bytes, want at most %d)", len(expr), maxDiceExprLen)
+    }
+    if d, ok := diceCache.load(expr); ok { return d, nil }
+    src := strings.ToLower(strings.Join(strings.Fields(expr), ""))
+    if src == "" { return DiceExpr{}, fmt.Errorf("empty dice expression") }
+    p := &diceParser{src: src}
+    root, err := p.expr()
+    if err == nil && p.pos < len(src) { err = p.errorf("unexpected %q", src[p.pos:]) }
+    if err != nil { return DiceExpr{}, fmt.Errorf("dice expression %q: %v", expr, err) }
+    d := DiceExpr{root: root, dist: root.values().clamped()}
+    diceCache.store(expr, d)
+    return d, nil
+}
+
+// MustParseDice is ParseDice for expressions already validated (by WeaponSnapshot.Validate
+// or at ability canonicalization); it panics if expr doesn't parse
+func MustParseDice(expr string) DiceExpr {
+    d, err := ParseDice(expr)
+    if err != nil { panic(fmt.Sprintf("engine: MustParseDice(%q): %v", expr, err)) }
+    return d
+}
+
+// Roll rolls the expression
+func (d DiceExpr) Roll(r Roller) int {
+    if d.root == nil { return 0 }
+    v := d.root.roll(r)
+    if v < 0 { v = 0 }
+    return v
+}
+
+// Min is the lowest possible result
+func (d DiceExpr) Min() int {
+    for v, pr := range d.dist {
+        if pr > 0 { return v }
+    }
+    return 0
+}
+
+// Max is the highest possible result
+func (d DiceExpr) Max() int {
+    if len(d.dist) == 0 { return 0 }
+    return len(d.dist) - 1
+}
+
+// Mean is the average result
+func (d DiceExpr) Mean() float64 { return d.dist.mean() }
+
+// Random reports whether the expression involves dice
+func (d DiceExpr) Random() bool { return d.Min() != d.Max() }
+
+// String renders the expression canonically, e.g. "D6+D3"
+func (d DiceExpr) String() string {
+    if d.root == nil { return "0" }
+    return d.root.String()
+}
+
+// Add returns the expression with n added, folding it into a trailing constant:
+// "2"+1 -> "3", "D6"+1 -> "D6+1", "D6+1"+1 -> "D6+2"
+func (d DiceExpr) Add(n int) string {
+    if n == 0 { return d.String() }
+    terms := []diceTerm{{sign: 1, node: d.root}}
+    if s, ok := d.root.(diceSum); ok { terms = append([]diceTerm(nil), s...) }
+    last := terms[len(terms)-1]
+    if c, ok := last.node.(diceConst); ok {
+        k := last.sign*int(c) + n
+        if len(terms) == 1 { return strconv.Itoa(k) }
+        terms = terms[:len(terms)-1]
+        if k == 0 { return diceSum(terms).String() }
+        if k < 0 { return diceSum(append(terms, diceTerm{sign: -1, node: diceConst(-k)})).String() }
+        return diceSum(append(terms, diceTerm{sign: 1, node: diceConst(k)})).String()
+    }
+    if n < 0 { return diceSum(append(terms, diceTerm{sign: -1, node: diceConst(-n)})).String() }
+    return diceSum(append(terms, diceTerm{sign: 1, node: diceConst(n)})).String()
+}
+
+type diceConst int
+
+func (c diceConst) roll(Roller) int    { return int(c) }
+func (c diceConst) values() vdist      { return vdist{lo: int(c), p: []float64{1}} }
+func (c diceConst) bounds() (int, int) { return int(c), int(c) }
+func (c diceConst) String() string     { return strconv.Itoa(int(c)) }
+
+// diceRoll is NdM, optionally keeping only the Keep highest (or lowest) dice
+type diceRoll struct {
+    Count, Sides int
+    Keep         int // 0 keeps every die
+    Lowest       bool
+}
+
+func (d diceRoll) roll(r Roller) int {
+    rolls := make([]int, d.Count)
+    for i := range rolls { rolls[i] = r.Roll(d.Sides) }
+    return d.keep(rolls)
+}
+
+// keep sums the kept dice
+func (d diceRoll) keep(rolls []int) int {
+    if d.Keep > 0 {
+        rolls = append([]int(nil), rolls...)
+        sort.Ints(rolls)
+        if d.Lowest { rolls = rolls[:d.Keep] } else { rolls = rolls[len(rolls)-d.Keep:] }
+    }
+    total := 0
+    for _, v := range rolls { total += v }
+    return total
+}
+
+func (d diceRoll) values() vdist {
+    die := vdist{lo: 1, p: make([]float64, d.Sides)}
+    for i := range die.p { die.p[i] = 1 / float64(d.Sides) }
+    if d.Keep == 0 {
+        out := vdist{lo: 0, p: []float64{1}}
+        for i := 0; i < d.Count; i++ { out = out.add(die) }
+        return out
+    }
+    // Enumerate every combination of faces
+    out := vdist{lo: 0, p: make([]float64, d.Count*d.Sides+1)}
+    each := 1.0
+    for i := 0; i < d.Count; i++ { each /= float64(d.Sides) }
+    rolls := make([]int, d.Count)
+    var walk func(i int)
+    walk = func(i int) {
+        if i == d.Count {
+            out.p[d.keep(rolls)] += each
+            return
+        }
+        for v := 1; v <= d.Sides; v++ {
+            rolls[i] = v
+            walk(i + 1)
+        }
+    }
+    walk(0)
+    return out.trim()
+}
+
+func (d diceRoll) bounds() (int, int) {
+    n := d.Count
+    if d.Keep > 0 { n = d.Keep }
+    return n, n * d.Sides
+}
+
+func (d diceRoll) String() string {
+    s := "D" + strconv.Itoa(d.Sides)
+    if d.Count != 1 { s = strconv.Itoa(d.Count) + s }
+    if d.Keep > 0 {
+        if d.Lowest { s += "kl" } else { s += "kh" }
+        s += strconv.Itoa(d.Keep)
+    }
+    return s
+}
+
+type diceTerm struct {
+    sign int // +1 or -1
+    node diceNode
+}
+
+// diceSum adds and subtracts terms left to right
+type diceSum []diceTerm
+
+func (s diceSum) roll(r Roller) int {
+    total := 0
+    for _, t := range s { total += t.sign * t.node.roll(r) }
+    return total
+}
+
+func (s diceSum) values() vdist {
+    out := vdist{lo: 0, p: []float64{1}}
+    for _, t := range s {
+        v := t.node.values()
+        if t.sign < 0 { v = v.negate() }
+        out = out.add(v)
+    }
+    return out
+}
+
+func (s diceSum) bounds() (int, int) {
+    lo, hi := 0, 0
+    for _, t := range s {
+        l, h := t.node.bounds()
+        if t.sign < 0 { l, h = -h, -l }
+        lo, hi = lo+l, hi+h
+    }
+    return lo, hi
+}
+
+func (s diceSum) String() string {
+    var b strings.Builder
+    for i, t := range s {
+        if t.sign < 0 { b.WriteString("-") } else if i > 0 { b.WriteString("+") }
+        b.WriteString(t.node.String())
+    }
+    return b.String()
+}
+
+// diceTimes multiplies a result by a constant ("D3x2")
+type diceTimes struct {
+    node diceNode
+    k    int
+}
+
+func (m diceTimes) roll(r Roller) int { return m.node.roll(r) * m.k }
+func (m diceTimes) values() vdist     { return m.node.values().scale(m.k) }
+
+func (m diceTimes) bounds() (int, int) {
+    lo, hi := m.node.bounds()
+    return lo * m.k, hi * m.k
+}
+
+func (m diceTimes) String() string {
+    s := m.node.String()
+    if _, ok := m.node.(diceSum); ok { s = "(" + s + ")" }
+    return s + "x" + strconv.Itoa(m.k)
+}
+
+// diceTwice rolls an expression twice and keeps the higher (or lower) result
+type diceTwice struct {
+    node  diceNode
+    worst bool
+}
+
+func (t diceTwice) roll(r Roller) int {
+    a, b := t.node.roll(r), t.node.roll(r)
+    if (b > a) != t.worst && b != a { return b }
+    return a
+}
+
+func (t diceTwice) values() vdist      { return t.node.values().twice(t.worst) }
+func (t diceTwice) bounds() (int, int) { return t.node.bounds() }
+
+func (t diceTwice) String() string {
+    if t.worst { return "worst(" + t.node.String() + ")" }
+    return "best(" + t.node.String() + ")"
+}
+
+// diceParser is a recursive-descent parser over a lower-cased, space-free expression
+type diceParser struct {
+    src   string
+    pos   int
+    depth int // open parentheses around pos
+}
+
+func (p *diceParser) errorf(format string, args ...any) error {
+    return fmt.Errorf("at %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *diceParser) peek() byte {
+    if p.pos < len(p.src) { return p.src[p.pos] }
+    return 0
+}
+
+func (p *diceParser) expr() (diceNode, error) {
+    var sum diceSum
+    sign := 1
+    for {
+        t, err := p.term()
+        if err != nil { return nil, err }
+        sum = append(sum, diceTerm{sign: sign, node: t})
+        if err := p.checkBounds(sum); err != nil { return nil, err }
+        switch p.peek() {
+        case '+': sign = 1
+        case '-': sign = -1
+        default:
+            if len(sum) == 1 && sum[0].sign > 0 { return sum[0].node, nil }
+            return sum, nil
+        }
+        p.pos++
+    }
+}
+
+func (p *diceParser) term() (diceNode, error) {
+    f, err := p.factor()
+    if err != nil { return nil, err }
+    for p.peek() == 'x' || p.peek() == '*' {
+        p.pos++
+        k, ok := p.number()
+        if !ok { return nil, p.errorf("expected a number to multiply by") }
+        if k > maxDiceValue { return nil, p.errorf("multiplier %d out of range (want 0-%d)", k, maxDiceValue) }
+        f = diceTimes{node: f, k: k}
+        if err := p.checkBounds(f); err != nil { return nil, err }
+    }
+    return f, nil
+}
+
+// checkBounds rejects a (partial) expression whose results could go beyond ±maxDiceValue,
+// before anything builds its distribution
+func (p *diceParser) checkBounds(n diceNode) error {
+    lo, hi := n.bounds()
+    if hi > maxDiceValue || lo < -maxDiceValue {
+        return p.errorf("%s ranges %d to %d (want within ±%d)", n, lo, hi, maxDiceValue)
+    }
+    return nil
+}
+
+func (p *diceParser) factor() (diceNode, error) {
+    for _, fn := range []string{"best", "worst"} {
+        if !strings.HasPrefix(p.src[p.pos:], fn+"(") { continue }
+        p.pos += len(fn)
+        inner, err := p.group()
+        if err != nil { return nil, err }
+        return diceTwice{node: inner, worst: fn == "worst"}, nil
+    }
+    if p.peek() == '(' { return p.group() }
+    n, hasCount := p.number()
+    if p.peek() != 'd' {
+        if !hasCount {
+            if p.pos >= len(p.src) { return nil, p.errorf("unexpected end") }
+            return nil, p.errorf("unexpected %q", p.src[p.pos:])
+        }
+        return diceConst(n), nil
+    }
+    p.pos++
+    d := diceRoll{Count: 1}
+    if hasCount { d.Count = n }
+    sides, ok := p.number()
+    if !ok { return nil, p.errorf("D needs a number of sides") }
+    d.Sides = sides
+    if strings.HasPrefix(p.src[p.pos:], "kh") || strings.HasPrefix(p.src[p.pos:], "kl") {
+        d.Lowest = p.src[p.pos+1] == 'l'
+        p.pos += 2
+        if d.Keep, ok = p.number(); !ok { return nil, p.errorf("keep needs a number of dice") }
+        if d.Keep < 1 || d.Keep > d.Count { return nil, p.errorf("can't keep %d of %d dice", d.Keep, d.Count) }
+        if d.Keep == d.Count { d.Keep = 0 }
+    }
+    switch {
+    case d.Count < 1 || d.Count > maxDiceCount:
+        return nil, p.errorf("dice count %d out of range (want 1-%d)", d.Count, maxDiceCount)
+    case d.Sides < 2 || d.Sides > maxDiceSides:
+        return nil, p.errorf("D%d out of range (want D2-D%d)", d.Sides, maxDiceSides)
+    }
+    if d.Keep > 0 {
+        combos := 1
+        for i := 0; i < d.Count && combos <= maxKeepCombos; i++ { combos *= d.Sides }
+        if combos > maxKeepCombos { return nil, p.errorf("too many dice to keep from (%dD%d)", d.Count, d.Sides) }
+    }
+    return d, nil
+}
+
+// group parses "(" expr ")"
+func (p *diceParser) group() (diceNode, error) {
+    if p.peek() != '(' { return nil, p.errorf("expected (") }
+    if p.depth >= maxDiceDepth { return nil, p.errorf("parentheses nested too deep (want at most %d)", maxDiceDepth) }
+    p.pos++
+    p.depth++
+    inner, err := p.expr()
+    if err != nil { return nil, err }
+    if p.peek() != ')' { return nil, p.errorf("missing )") }
+    p.pos++
+    p.depth--
+    return inner, nil
+}
+
+// number reads a non-negative integer, reporting whether there was one
+func (p *diceParser) number() (int, bool) {
+    start := p.pos
+    for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' && p.pos-start < 6 { p.pos++ }
+    if p.pos == start { return 0, false }
+    n, _ := strconv.Atoi(p.src[start:p.pos])
+    return n, true
+}
+
+// vdist is a distribution over integers that may be negative: p[i] is P(lo+i)
+type vdist struct {
+    lo int
+    p  []float64
+}
+
+func (a vdist) add(b vdist) vdist {
+    out := vdist{lo: a.lo + b.lo, p: make([]float64, len(a.p)+len(b.p)-1)}
+    for i, x := range a.p {
+        if x == 0 { continue }
+        for j, y := range b.p { out.p[i+j] += x * y }
+    }
+    return out
+}
+
+func (a vdist) negate() vdist {
+    out := vdist{lo: -(a.lo + len(a.p) - 1), p: make([]float64, len(a.p))}
+    for i, x := range a.p { out.p[len(a.p)-1-i] = x }
+    return out
+}
+
+func (a vdist) scale(k int) vdist {
+    if k == 0 { return vdist{lo: 0, p: []float64{1}} }
+    out := vdist{lo: a.lo * k, p: make([]float64, (len(a.p)-1)*k+1)}
+    for i, x := range a.p { out.p[i*k] = x }
+    return out
+}
+
+// twice is the distribution of the higher (or lower) of two independent draws
+func (a vdist) twice(worst bool) vdist {
+    out := vdist{lo: a.lo, p: make([]float64, len(a.p))}
+    below, cum := 0.0, 0.0 // P(X < v), P(X <= v)
+    for i, x := range a.p {
+        cum += x
+        if worst {
+            // P(min >= v) = (1-P(X<v))^2
+            out.p[i] = (1-below)*(1-below) - (1-cum)*(1-cum)
+        } else {
+            out.p[i] = cum*cum - below*below
+        }
+        below = cum
+    }
+    return out
+}
+
+// trim drops impossible values from the top
+func (a vdist) trim() vdist {
+    for len(a.p) > 1 && a.p[len(a.p)-1] == 0 { a.p = a.p[:len(a.p)-1] }
+    return a
+}
+
+// clamped folds every negative value into 0
+func (a vdist) clamped() pmf {
+    a = a.trim()
+    hi := a.lo + len(a.p) - 1
+    if hi < 0 { hi = 0 }
+    out := make(pmf, hi+1)
+    for i, x := range a.p {
+        v := a.lo + i
+        if v < 0 { v = 0 }
+        out[v] += x
+    }
+    return out
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+    "math"
+    "strings"
+    "testing"
+)
+
+func TestParseDice(t *testing.T) {
+    cases := []struct {
+        expr     string
+        min, max int
+        mean     float64
+        str      string
+    }{
+        {"3", 3, 3, 3, "3"},
+        {"D6+D3", 2, 9, 5.5, "D6+D3"},
+        {"2D6kh1", 1, 6, 161.0 / 36, "2D6kh1"},
+        {"best(D6)", 1, 6, 161.0 / 36, "best(D6)"},
+        {"worst(D6)", 1, 6, 91.0 / 36, "worst(D6)"},
+        {"D3x2", 2, 6, 4, "D3x2"},
+        {"(D3+1)x2", 4, 8, 6, "(D3+1)x2"},
+        {"d6 + 1", 2, 7, 4.5, "D6+1"},
+        {"D6-3", 0, 3, 1, "D6-3"}, // clamped at 0
+        {"D100x2", 2, 200, 101, "D100x2"},
+        {"((((((((1))))))))", 1, 1, 1, "1"}, // 8 levels is the limit
+    }
+    for _, c := range cases {
+        d, err := ParseDice(c.expr)
+        if err != nil {
+            t.Errorf("ParseDice(%q): %v", c.expr, err)
+            continue
+        }
+        if d.Min() != c.min || d.Max() != c.max || math.Abs(d.Mean()-c.mean) > 1e-9 || d.String() != c.str {
+            t.Errorf("ParseDice(%q) = %s min %d max %d mean %.4f, want %s min %d max %d mean %.4f",
+                c.expr, d, d.Min(), d.Max(), d.Mean(), c.str, c.min, c.max, c.mean)
+        }
+    }
+}
+
+func TestParseDiceRejects(t *testing.T) {
+    cases := []struct{ expr, err string }{
+        {"", "empty"},
+        {"D", "needs a number of sides"},
+        {"D6+", "unexpected end"},
+        {"abc", "unexpected"},
+        {"2D6kh3", "can't keep 3 of 2 dice"},
+        {"100D100", "dice count 100 out of range"},
+        {"D6x201", "multiplier 201 out of range"},
+        {"999999x999999", "out of range"},
+        {"201", "ranges 201 to 201"},
+        {"D100x2+1", "ranges 3 to 201"},
+        {strings.Repeat("1+", 32) + "1", "too long"},
+        {strings.Repeat("(", 2000000) + "1" + strings.Repeat(")", 2000000), "too long"},
+        {"((((((((((1))))))))))", "nested too deep"},
+        {"best(best(best(best(best(best(best(best(best(D6)))))))))", "nested too deep"},
+    }
+    for _, c := range cases {
+        _, err := ParseDice(c.expr)
+        if err == nil || !strings.Contains(err.Error(), c.err) {
+            t.Errorf("ParseDice(%q) error = %v, want one containing %q", c.expr, err, c.err)
+        }
+    }
+}
+
+func TestMustParseDicePanics(t *testing.T) {
+    defer func() {
+        if recover() == nil { t.Error("MustParseDice(\"D\") did not panic") }
+    }()
+    MustParseDice("D")
+}
+
+// TestDiceRollMatchesDistribution rolls each expression with a seeded roller and checks
+// every result is in range and the sample mean is close to the exact one
+func TestDiceRollMatchesDistribution(t *testing.T) {
+    const n = 20000
+    for _, expr := range []string{"D6+D3", "2D6kh1", "worst(D6)", "D3x2", "D6-3"} {
+        d := MustParseDice(expr)
+        rng := NewSeededRoller(1)
+        sum := 0
+        for i := 0; i < n; i++ {
+            v := d.Roll(rng)
+            if v < d.Min() || v > d.Max() {
+                t.Fatalf("%s rolled %d, outside %d-%d", expr, v, d.Min(), d.Max())
+            }
+            sum += v
+        }
+        if got := float64(sum) / n; math.Abs(got-d.Mean()) > 0.05 {
+            t.Errorf("%s sample mean %.3f, want about %.3f", expr, got, d.Mean())
+        }
+    }
+}
+
+func TestDiceRollScripted(t *testing.T) {
+    cases := []struct {
+        expr  string
+        rolls []int
+        want  int
+    }{
+        {"D6+D3", []int{4, 2}, 6},
+        {"2D6kh1", []int{3, 5}, 5},
+        {"worst(D6)", []int{3, 5}, 3},
+        {"(D3+1)x2", []int{2}, 6},
+        {"D6-3", []int{1}, 0},
+    }
+    for _, c := range cases {
+        rng := NewScriptedRoller(c.rolls...)
+        if got := MustParseDice(c.expr).Roll(rng); got != c.want || rng.Used() != len(c.rolls) {
+            t.Errorf("%s with %v = %d using %d dice, want %d using %d", c.expr, c.rolls, got, rng.Used(), c.want, len(c.rolls))
+        }
+    }
+}
@@ -0,0 +1,379 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Distribution is the exact outcome of one weapon volley, computed by convolving the
+// per-stage probabilities instead of sampling them. It follows the same rules and
+// ordering as ResolveShootingWith: normal damage is allocated model by model with
+// excess lost, then Devastating Wounds mortal wounds spill over.
+type Distribution struct {
+    PMF             []float64 `json:"pmf"`              // PMF[d]: probability the defender loses exactly d wounds
+    Expected        float64   `json:"expected"`         // expected wounds lost
+    KillProbability float64   `json:"kill_probability"` // probability every model is slain
+    ExpectedSlain   float64   `json:"expected_models_slain"`
+    ExpectedAttacks float64   `json:"expected_attacks"`
+    ExpectedUnsaved float64   `json:"expected_unsaved"` // unsaved normal wounds
+    ExpectedMortal  float64   `json:"expected_devastating"` // critical wounds turned into mortal wounds
+    Notes           []string  `json:"notes,omitempty"` // rules the calculation can't model exactly
+}
+
+// pmf is a probability mass function over non-negative integers, indexed by value
+type pmf []float64
+
+// mean returns the expected value
+func (p pmf) mean() float64 {
+    m := 0.0
+    for v, pr := range p { m += float64(v) * pr }
+    return m
+}
+
+// convolve returns the distribution of the sum of two independent values
+func (p pmf) convolve(q pmf) pmf {
+    if len(p) == 0 || len(q) == 0 { return pmf{1} }
+    out := make(pmf, len(p)+len(q)-1)
+    for i, a := range p {
+        if a == 0 { continue }
+        for j, b := range q { out[i+j] += a * b }
+    }
+    return out
+}
+
+// capAt folds all mass above max into max
+func (p pmf) capAt(max int) pmf {
+    if len(p) <= max+1 { return p }
+    out := append(pmf(nil), p[:max+1]...)
+    for _, pr := range p[max+1:] { out[max] += pr }
+    return out
+}
+
+// exprDist is the exact distribution of rollExpr for a dice expression
+func exprDist(expr string) pmf { return MustParseDice(expr).dist }
+
+// rerollExprDist applies an attacks/damage "ones" re-roll the way rerollExpr does: the
+// lowest result is re-rolled
+func rerollExprDist(p pmf, expr string, policy RerollPolicy) pmf {
+    d := MustParseDice(expr)
+    if !d.Random() || policy != RerollOnes { return p }
+    min := d.Min()
+    out := make(pmf, len(p))
+    for v, pr := range p {
+        if v != min {
+            out[v] += pr
+            continue
+        }
+        for w, pw := range p { out[w] += pr * pw }
+    }
+    return out
+}
+
+// d6Faces returns the distribution of a D6's final face when faces failing the
+// policy's test may be re-rolled once; failed reports whether a face failed
+func d6Faces(policy RerollPolicy, failed func(face int) bool) [7]float64 {
+    var out [7]float64
+    for a := 1; a <= 6; a++ {
+        eligible := (policy == RerollOnes && a == 1) || (policy == RerollFailed && failed(a))
+        if !eligible {
+            out[a] += 1.0 / 6
+            continue
+        }
+        for b := 1; b <= 6; b++ { out[b] += 1.0 / 36 }
+    }
+    return out
+}
+
+// joint is a distribution over (unsaved normal wounds, devastating wounds)
+type joint [][]float64
+
+func (j joint) convolve(k joint) joint {
+    rows, cols := len(j)+len(k)-1, 0
+    for _, r := range j { if len(r) > cols { cols = len(r) } }
+    kc := 0
+    for _, r := range k { if len(r) > kc { kc = len(r) } }
+    cols += kc - 1
+    out := make(joint, rows)
+    for i := range out { out[i] = make([]float64, cols) }
+    for a, ra := range j {
+        for b, pa := range ra {
+            if pa == 0 { continue }
+            for c, rc := range k {
+                for d, pc := range rc { out[a+c][b+d] += pa * pc }
+            }
+        }
+    }
+    return out
+}
+
+func (j joint) add(k joint, weight float64) joint {
+    for len(j) < len(k) { j = append(j, nil) }
+    for a, r := range k {
+        for len(j[a]) < len(r) { j[a] = append(j[a], 0) }
+        for b, p := range r { j[a][b] += weight * p }
+    }
+    return j
+}
+
+// jointOf builds a joint distribution from (normal, devastating, probability) outcomes
+func jointOf(outcomes ...[3]float64) joint {
+    var j joint
+    for _, o := range outcomes {
+        single := make(joint, int(o[0])+1)
+        single[int(o[0])] = make([]float64, int(o[1])+1)
+        single[int(o[0])][int(o[1])] = 1
+        j = j.add(single, o[2])
+    }
+    return j
+}
+
+// power returns the distribution of n independent copies summed
+func (j joint) power(n int) joint {
+    out := joint{{1}}
+    for i := 0; i < n; i++ { out = out.convolve(j) }
+    return out
+}
+
+// fnpDist thins each point of damage by the chance it gets through Feel No Pain
+func fnpDist(p pmf, through float64) pmf {
+    if through >= 1 { return p }
+    out := make(pmf, len(p))
+    row := pmf{1} // binomial(d, through), built up one point at a time
+    for d, pr := range p {
+        if d > 0 { row = row.convolve(pmf{1 - through, through}) }
+        if pr == 0 { continue }
+        for k, pk := range row { out[k] += pr * pk }
+    }
+    return out
+}
+
+// Size limits for DamageDistribution: its state space grows with the defender's models
+// and wounds and the number of hits, so anything larger is refused rather than left to
+// run for minutes. They sit well above any datasheet unit and weapon.
+const (
+    MaxDistModels = 30  // models in the defending unit
+    MaxDistWounds = 200 // wounds left across the defending unit
+    MaxDistHits   = 120 // most hits one volley can score, counting Rapid Fire and Sustained Hits
+)
+
+// validateDistribution checks a volley against the size limits
+func validateDistribution(def UnitSnapshot, w WeaponSnapshot, ab WeaponAbilities, halfRange bool) error {
+    models := unitModels(def)
+    if len(models) > MaxDistModels {
+        return fmt.Errorf("defender has %d models (distribution supports up to %d)", len(models), MaxDistModels)
+    }
+    total := 0
+    for _, m := range models {
+        if m.Wounds < 0 || m.Wounds > MaxDistWounds {
+            return fmt.Errorf("model %s has %d wounds (distribution supports 0-%d)", m.Name, m.Wounds, MaxDistWounds)
+        }
+        total += m.Wounds
+    }
+    if total > MaxDistWounds {
+        return fmt.Errorf("defender has %d wounds (distribution supports up to %d)", total, MaxDistWounds)
+    }
+    hits := MustParseDice(w.Attacks).Max()
+    if halfRange && ab.RapidFire != "" { hits += MustParseDice(ab.RapidFire).Max() }
+    if ab.SustainedHits != "" && !ab.Torrent { hits *= 1 + MustParseDice(ab.SustainedHits).Max() }
+    if hits > MaxDistHits {
+        return fmt.Errorf("%s can score %d hits (distribution supports up to %d)", w.Name, hits, MaxDistHits)
+    }
+    return nil
+}
+
+// DamageDistribution computes the exact distribution of wounds the defender loses to one
+// volley. Single (Command) re-rolls can't be modelled per die and are ignored, with a note.
+// Volleys beyond MaxDistModels, MaxDistWounds or MaxDistHits are refused.
+func DamageDistribution(att UnitSnapshot, def UnitSnapshot, w WeaponSnapshot, opts ShootingOptions) (Distribution, error) {
+    if err := opts.validate(w); err != nil {
+        return Distribution{}, err
+    }
+    var out Distribution
+    rules := rulesOrDefault(opts.Ruleset)
+    ab := rules.WeaponAbilities(w.Abilities...)
+    if err := validateDistribution(def, w, ab, opts.halfRange(w)); err != nil {
+        return Distribution{}, err
+    }
+    if len(ab.Unknown) > 0 {
+        out.Notes = append(out.Notes, fmt.Sprintf("Unrecognized weapon abilities ignored: [%s]", strings.Join(ab.Unknown, ", ")))
+    }
+    critHit, critWound := volleyCriticals(att, def, ab, opts)
+    rr := volleyRerolls(ab, opts)
+    policy := func(st Stage) RerollPolicy {
+        p := rr.policy[st]
+        if rr.single[st] != "" && p != RerollFailed {
+            out.Notes = append(out.Notes, fmt.Sprintf("Single re-roll for %s is not modelled", st))
+        }
+        return p
+    }
+    mods := volleyModifiers(att, def, w, ab, opts)
+    hitMod, woundMod, saveMod := mods.Net(StageHit), mods.Net(StageWound), mods.Net(StageSave)
+    skill := w.Skill
+    if opts.Overwatch { skill, hitMod, critHit = 6, 0, critThreshold{TN: 6} }
+    halfRange := opts.halfRange(w)
+
+    // Attacks
+    attacks := rerollExprDist(exprDist(w.Attacks), w.Attacks, policy(StageAttacks))
+    if halfRange && ab.RapidFire != "" { attacks = attacks.convolve(exprDist(ab.RapidFire)) }
+    out.ExpectedAttacks = attacks.mean()
+
+    // Per-die outcome probabilities after re-rolls
+    hitFaces := d6Faces(policy(StageHit), func(f int) bool { return !critHit.isCrit(f) && !rollPasses(f, hitMod, skill) })
+    woundTN := rules.WoundTarget(w.Strength, def.T)
+    canWound := woundTN <= 6
+    woundFaces := d6Faces(policy(StageWound), func(f int) bool { return canWound && !critWound.isCrit(f) && !rollPasses(f, woundMod, woundTN) })
+    // Conditional invulnerable saves that depend on the model hit are taken as the first
+    // model's, since which model each attack reaches isn't tracked here
+    saveDef := def
+    model := ""
+    if invulnPerModel(def) {
+        ms := unitModels(def)
+        if i := allocationTarget(ms, ab.Precision); i >= 0 { model = ms[i].Name }
+        out.Notes = append(out.Notes, fmt.Sprintf("Invulnerable saves that depend on the model use %s's", model))
+    }
+    saveDef.InvSv, _ = invulnFor(def, w, model)
+    _, saveTN, _ := rules.SaveTargets(saveDef, w, saveMod)
+    saveFaces := d6Faces(policy(StageSave), func(f int) bool { return f < saveTN || f == 1 })
+    var pHit, pCritHit, pWound, pCritWound, pUnsaved float64
+    for f := 1; f <= 6; f++ {
+        switch {
+        case critHit.isCrit(f): pCritHit += hitFaces[f]
+        case rollPasses(f, hitMod, skill): pHit += hitFaces[f]
+        }
+        switch {
+        case !canWound:
+        case critWound.isCrit(f): pCritWound += woundFaces[f]
+        case rollPasses(f, woundMod, woundTN): pWound += woundFaces[f]
+        }
+        if f < saveTN || f == 1 { pUnsaved += saveFaces[f] }
+    }
+
+    // One wound roll: a normal (or non-devastating critical) wound goes to saves
+    toSave := pWound
+    devastating := 0.0
+    if ab.DevastatingWounds { devastating = pCritWound } else { toSave += pCritWound }
+    woundRoll := jointOf([3]float64{1, 0, toSave * pUnsaved}, [3]float64{0, 1, devastating}, [3]float64{0, 0, 1 - toSave*pUnsaved - devastating})
+    autoWound := jointOf([3]float64{1, 0, pUnsaved}, [3]float64{0, 0, 1 - pUnsaved})
+    // One attack: torrent auto-hits without criticals; critical hits may auto-wound and add sustained hits
+    var perAttack joint
+    if ab.Torrent {
+        perAttack = woundRoll
+    } else {
+        crit := woundRoll
+        if ab.LethalHits { crit = autoWound }
+        if ab.SustainedHits != "" {
+            var extra joint
+            for x, px := range exprDist(ab.SustainedHits) {
+                if px > 0 { extra = extra.add(woundRoll.power(x), px) }
+            }
+            crit = crit.convolve(extra)
+        }
+        perAttack = jointOf([3]float64{0, 0, 1 - pHit - pCritHit}).add(woundRoll, pHit).add(crit, pCritHit)
+    }
+    var wounds joint
+    acc := joint{{1}}
+    for n, pn := range attacks {
+        if n > 0 { acc = acc.convolve(perAttack) }
+        if pn > 0 { wounds = wounds.add(acc, pn) }
+    }
+
+    // Damage per unsaved wound, after Melta and Feel No Pain
+    dmg := rerollExprDist(exprDist(w.Damage), w.Damage, policy(StageDamage))
+    if halfRange && ab.Melta != "" { dmg = dmg.convolve(exprDist(ab.Melta)) }
+    through := 1.0
+    if fnpTN := unitRulesOf(def.Abilities).fnp; fnpTN > 0 {
+        fnpFaces := d6Faces(policy(StageFNP), func(f int) bool { return f < fnpTN || f == 1 })
+        for f := fnpTN; f <= 6; f++ {
+            if f != 1 { through -= fnpFaces[f] }
+        }
+    }
+
+    // Allocation order: the models in the order allocationTarget picks them
+    var slots []int
+    models := unitModels(def)
+    for i := allocationTarget(models, ab.Precision); i >= 0; i = allocationTarget(models, ab.Precision) {
+        slots = append(slots, models[i].Wounds)
+        models[i].Wounds = 0
+    }
+    total := 0
+    for _, s := range slots { total += s }
+    maxW := 0
+    for _, s := range slots { if s > maxW { maxW = s } }
+    normal := fnpDist(dmg, through).capAt(maxW)
+    // state[i][wl]: slot i is the next to take damage with wl wounds left; i == len(slots) is destroyed
+    state := make([][]float64, len(slots)+1)
+    for i := range state { state[i] = make([]float64, maxW+1) }
+    if len(slots) > 0 { state[0][slots[0]] = 1 } else { state[0][0] = 1 }
+    remaining := func(i, wl int) int {
+        r := wl
+        for _, s := range slots[min(i+1, len(slots)):] { r += s }
+        if i >= len(slots) { return 0 }
+        return r
+    }
+    slainAfter := func(i, wl, t int) int {
+        for i < len(slots) && t >= wl {
+            t -= wl
+            i++
+            if i < len(slots) { wl = slots[i] }
+        }
+        return i
+    }
+    // mortals[m]: total mortal wounds through Feel No Pain from m devastating wounds, capped at the unit's wounds
+    mortals := []pmf{{1}}
+    maxDev := 0
+    for _, r := range wounds { if len(r)-1 > maxDev { maxDev = len(r) - 1 } }
+    sum := pmf{1}
+    for m := 1; m <= maxDev; m++ {
+        sum = sum.convolve(dmg)
+        mortals = append(mortals, fnpDist(sum, through).capAt(total))
+    }
+
+    out.PMF = make([]float64, total+1)
+    for n, row := range wounds {
+        if n > 0 {
+            next := make([][]float64, len(state))
+            for i := range next { next[i] = make([]float64, maxW+1) }
+            for i, ws := range state {
+                for wl, p := range ws {
+                    if p == 0 { continue }
+                    if i >= len(slots) {
+                        next[i][wl] += p
+                        continue
+                    }
+                    for d, pd := range normal {
+                        if pd == 0 { continue }
+                        if d < wl {
+                            next[i][wl-d] += p * pd
+                        } else if i+1 < len(slots) {
+                            next[i+1][slots[i+1]] += p * pd
+                        } else {
+                            next[i+1][0] += p * pd
+                        }
+                    }
+                }
+            }
+            state = next
+        }
+        for m, pnm := range row {
+            if pnm == 0 { continue }
+            out.ExpectedUnsaved += float64(n) * pnm
+            out.ExpectedMortal += float64(m) * pnm
+            for i, ws := range state {
+                for wl, p := range ws {
+                    if p == 0 { continue }
+                    r := remaining(i, wl)
+                    for t, pt := range mortals[m] {
+                        if pt == 0 { continue }
+                        pr := p * pnm * pt
+                        lost := total - r + min(t, r)
+                        out.PMF[lost] += pr
+                        if lost == total { out.KillProbability += pr }
+                        out.ExpectedSlain += float64(slainAfter(i, wl, t)) * pr
+                    }
+                }
+            }
+        }
+    }
+    out.Expected = pmf(out.PMF).mean()
+    return out, nil
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+    "math"
+    "strings"
+    "testing"
+)
+
+// TestDamageDistributionMatchesSimulation compares the exact distribution with seeded
+// simulated volleys
+func TestDamageDistributionMatchesSimulation(t *testing.T) {
+    squad := []ModelState{{Name: "A", W: 2, Wounds: 2}, {Name: "B", W: 2, Wounds: 2}, {Name: "C", W: 2, Wounds: 2}}
+    cases := []struct {
+        name string
+        w    WeaponSnapshot
+        def  UnitSnapshot
+    }{
+        {"sustained lethal", WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "D6", Skill: 3, Strength: 4, AP: -1, Damage: "1", Abilities: []string{"Sustained Hits 1", "Lethal Hits"}},
+            UnitSnapshot{Name: "Squad", T: 4, Sv: 3, Models: squad}},
+        {"devastating FNP", WeaponSnapshot{Name: "Cannon", Type: "ranged", Attacks: "3", Skill: 3, Strength: 6, AP: -2, Damage: "D3", Abilities: []string{"Devastating Wounds"}},
+            UnitSnapshot{Name: "Squad", T: 4, Sv: 3, Abilities: []string{"Feel No Pain 5+"}, Models: squad}},
+        {"invulnerable", WeaponSnapshot{Name: "Melta", Type: "ranged", Attacks: "2", Skill: 3, Strength: 9, AP: -4, Damage: "D6"},
+            UnitSnapshot{Name: "Walker", T: 9, Sv: 2, InvSv: 4, W: 10}},
+    }
+    const n = 40000
+    for _, c := range cases {
+        dist, err := DamageDistribution(UnitSnapshot{}, c.def, c.w, ShootingOptions{})
+        if err != nil {
+            t.Fatalf("%s: %v", c.name, err)
+        }
+        if len(dist.Notes) > 0 {
+            t.Fatalf("%s: distribution isn't exact: %v", c.name, dist.Notes)
+        }
+        total := ModelsRemaining(unitModels(c.def))
+        counts := make([]float64, total+1)
+        rng := NewSeededRoller(7)
+        for i := 0; i < n; i++ {
+            res, err := ResolveShootingWith(UnitSnapshot{}, c.def, c.w, ShootingOptions{Roller: rng})
+            if err != nil {
+                t.Fatalf("%s: %v", c.name, err)
+            }
+            counts[total-res.DefenderWounds]++
+        }
+        mean := 0.0
+        for d, k := range counts {
+            mean += float64(d) * k / n
+            p := 0.0
+            if d < len(dist.PMF) { p = dist.PMF[d] }
+            // about five standard errors of the sampled frequency
+            if tol := 5*math.Sqrt(p*(1-p)/n) + 0.002; math.Abs(k/n-p) > tol {
+                t.Errorf("%s: P(%d wounds lost) simulated %.4f, exact %.4f", c.name, d, k/n, p)
+            }
+        }
+        if math.Abs(mean-dist.Expected) > 0.05 {
+            t.Errorf("%s: mean wounds lost simulated %.3f, exact %.3f", c.name, mean, dist.Expected)
+        }
+    }
+}
+
+func TestDamageDistributionLimits(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "2", Skill: 3, Strength: 4, Damage: "1"}
+    horde := UnitSnapshot{Name: "Horde", T: 3, Sv: 6, Models: make([]ModelState, MaxDistModels+1)}
+    for i := range horde.Models { horde.Models[i] = ModelState{Name: "Gaunt", W: 1, Wounds: 1} }
+    if _, err := DamageDistribution(UnitSnapshot{}, horde, w, ShootingOptions{}); err == nil || !strings.Contains(err.Error(), "models") {
+        t.Errorf("%d models: error = %v, want a model limit error", len(horde.Models), err)
+    }
+    big := UnitSnapshot{Name: "Titan", T: 12, Sv: 2, W: MaxDistWounds + 1}
+    if _, err := DamageDistribution(UnitSnapshot{}, big, w, ShootingOptions{}); err == nil {
+        t.Errorf("%d wounds: no error", big.W)
+    }
+    w.Attacks = "D100x2"
+    w.Abilities = []string{"Sustained Hits D3"}
+    if _, err := DamageDistribution(UnitSnapshot{}, UnitSnapshot{Name: "Target", T: 4, Sv: 3, W: 10}, w, ShootingOptions{}); err == nil {
+        t.Errorf("%s attacks with Sustained Hits: no error", w.Attacks)
+    }
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EnhancementEffect is the part of an enhancement the engine can apply: abilities for
+// the bearer or its unit, and changes to the bearer's weapons. Conditional effects
+// ("while ...", "each time ...", "... instead") are left out.
+type EnhancementEffect struct {
+    Abilities       []string `json:"abilities,omitempty"`        // gained by the bearer's unit
+    BearerAbilities []string `json:"bearer_abilities,omitempty"` // gained by the bearer only
+    Weapons         string   `json:"weapons,omitempty"`          // "melee", "ranged" or "" for all of the bearer's weapons
+    Attacks         int      `json:"attacks,omitempty"`
+    Strength        int      `json:"strength,omitempty"`
+    AP              int      `json:"ap,omitempty"` // improvement: 1 makes AP -1 into AP -2
+    Damage          int      `json:"damage,omitempty"`
+    WeaponAbilities []string `json:"weapon_abilities,omitempty"`
+}
+
+var (
+    enhFNPRe      = regexp.MustCompile(`^(the bearer has|models in the bearer’?s unit have) the feel no pain (\d)\+ ability`)
+    enhAddRe      = regexp.MustCompile(`add (\d) to the ([a-z ,]+?) characteristics? of`)
+    enhImproveRe  = regexp.MustCompile(`improve the ([a-z ,]+?) characteristics? of .*? by (\d)`)
+    enhBracketRe  = regexp.MustCompile(`\[([^\]]+)\]`)
+    enhCondPrefix = []string{"while ", "if ", "each time ", "at the start", "in your ", "once per "}
+)
+
+// ParseEnhancement reads an enhancement's rules text (HTML already stripped)
+func ParseEnhancement(desc string) EnhancementEffect {
+    var e EnhancementEffect
+    text := strings.ReplaceAll(strings.ToLower(desc), "bearers ", "bearer’s ")
+    text = strings.ReplaceAll(text, "bearer's", "bearer’s")
+    for _, s := range strings.Split(text, ". ") {
+        s = strings.TrimSpace(strings.Join(strings.Fields(s), " "))
+        if enhConditional(s) { continue }
+        if m := enhFNPRe.FindStringSubmatch(s); m != nil && !strings.Contains(s, " against ") {
+            ab := "Feel No Pain " + m[2] + "+"
+            if strings.HasPrefix(m[1], "the bearer") {
+                e.BearerAbilities = append(e.BearerAbilities, ab)
+            } else {
+                e.Abilities = append(e.Abilities, ab)
+            }
+            continue
+        }
+        if !strings.Contains(s, "bearer") || !strings.Contains(s, "weapons") { continue }
+        switch {
+        case strings.Contains(s, "melee weapons"):
+            e.Weapons = "melee"
+        case strings.Contains(s, "ranged weapons"):
+            e.Weapons = "ranged"
+        }
+        for _, m := range enhAddRe.FindAllStringSubmatch(s, -1) {
+            n, _ := strconv.Atoi(m[1])
+            e.addStats(m[2], n)
+        }
+        for _, m := range enhImproveRe.FindAllStringSubmatch(s, -1) {
+            n, _ := strconv.Atoi(m[2])
+            e.addStats(m[1], n)
+        }
+        if strings.Contains(s, "have the [") {
+            for _, m := range enhBracketRe.FindAllStringSubmatch(s, -1) {
+                e.WeaponAbilities = append(e.WeaponAbilities, strings.TrimSpace(m[1]))
+            }
+        }
+    }
+    return e
+}
+
+// enhConditional reports whether a sentence only applies under some condition
+func enhConditional(s string) bool {
+    for _, p := range enhCondPrefix {
+        if strings.HasPrefix(s, p) { return true }
+    }
+    return strings.Contains(s, " instead") || strings.Contains(s, "until ")
+}
+
+// addStats adds n to each characteristic in a list like "attacks, strength and damage"
+func (e *EnhancementEffect) addStats(list string, n int) {
+    for _, part := range strings.FieldsFunc(strings.ReplaceAll(list, " and ", ","), func(r rune) bool { return r == ',' }) {
+        switch strings.TrimSpace(part) {
+        case "attacks":
+            e.Attacks += n
+        case "strength":
+            e.Strength += n
+        case "armour penetration":
+            e.AP += n
+        case "damage":
+            e.Damage += n
+        }
+    }
+}
+
+// Supported reports whether the engine applies anything from the enhancement
+func (e EnhancementEffect) Supported() bool {
+    return len(e.Abilities)+len(e.BearerAbilities)+len(e.WeaponAbilities) > 0 || e.Attacks != 0 || e.Strength != 0 || e.AP != 0 || e.Damage != 0
+}
+
+// AppliesTo reports whether a weapon of the bearer is affected
+func (e EnhancementEffect) AppliesTo(w WeaponSnapshot) bool {
+    switch e.Weapons {
+    case "melee":
+        return w.IsMelee()
+    case "ranged":
+        return !w.IsMelee()
+    }
+    return true
+}
+
+// ApplyWeapon returns the bearer's weapon with the enhancement's changes
+func (e EnhancementEffect) ApplyWeapon(w WeaponSnapshot) WeaponSnapshot {
+    if !e.AppliesTo(w) { return w }
+    w.Attacks = AddToExpr(w.Attacks, e.Attacks)
+    w.Strength += e.Strength
+    w.AP -= e.AP
+    w.Damage = AddToExpr(w.Damage, e.Damage)
+    if len(e.WeaponAbilities) > 0 {
+        w.Abilities = ParseWeaponAbilities(append(append([]string(nil), w.Abilities...), e.WeaponAbilities...)...).Tokens()
+    }
+    return w
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseEnhancement(t *testing.T) {
+    cases := []struct {
+        desc string
+        want EnhancementEffect
+    }{
+        {"Add 1 to the Attacks and Damage characteristics of the bearer's melee weapons.",
+            EnhancementEffect{Weapons: "melee", Attacks: 1, Damage: 1}},
+        {"The bearer has the Feel No Pain 5+ ability.",
+            EnhancementEffect{BearerAbilities: []string{"Feel No Pain 5+"}}},
+        {"Models in the bearer's unit have the Feel No Pain 6+ ability.",
+            EnhancementEffect{Abilities: []string{"Feel No Pain 6+"}}},
+        {"Ranged weapons equipped by the bearer have the [LETHAL HITS] ability.",
+            EnhancementEffect{Weapons: "ranged", WeaponAbilities: []string{"lethal hits"}}},
+        // conditional effects are left out
+        {"While the bearer is leading a unit, add 1 to the Attacks characteristic of the bearer's melee weapons.",
+            EnhancementEffect{}},
+    }
+    for _, c := range cases {
+        if got := ParseEnhancement(c.desc); !reflect.DeepEqual(got, c.want) {
+            t.Errorf("ParseEnhancement(%q) = %+v, want %+v", c.desc, got, c.want)
+        }
+    }
+    if (EnhancementEffect{}).Supported() {
+        t.Error("an empty effect is supported")
+    }
+}
+
+func TestEnhancementApplyWeapon(t *testing.T) {
+    e := EnhancementEffect{Weapons: "melee", Attacks: 1, Strength: 1, AP: 1, Damage: 1, WeaponAbilities: []string{"lethal hits"}}
+    sword := WeaponSnapshot{Name: "Sword", Type: "melee", Attacks: "D6", Strength: 4, AP: -1, Damage: "2"}
+    got := e.ApplyWeapon(sword)
+    want := WeaponSnapshot{Name: "Sword", Type: "melee", Attacks: "D6+1", Strength: 5, AP: -2, Damage: "3", Abilities: []string{"Lethal Hits"}}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("ApplyWeapon = %+v, want %+v", got, want)
+    }
+    gun := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "2", Damage: "1"}
+    if got := e.ApplyWeapon(gun); !reflect.DeepEqual(got, gun) {
+        t.Errorf("a melee enhancement changed a ranged weapon: %+v", got)
+    }
+}
+
+func TestAddToExpr(t *testing.T) {
+    for _, c := range []struct{ expr, want string }{{"2", "3"}, {"D6", "D6+1"}, {"D6+1", "D6+2"}, {"lots", "lots"}} {
+        if got := AddToExpr(c.expr, 1); got != c.want {
+            t.Errorf("AddToExpr(%q, 1) = %q, want %q", c.expr, got, c.want)
+        }
+    }
+}
@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventKind names one step of combat resolution
+type EventKind string
+
+const (
+    EventSeed        EventKind = "seed"              // dice seed of the roller
+    EventAbility     EventKind = "ability_triggered" // a weapon ability or rule took effect
+    EventNote        EventKind = "note"              // anything else worth showing (e.g. ignored abilities)
+    EventRange       EventKind = "range"
+    EventAttacks     EventKind = "attacks"
+    EventModifiers   EventKind = "modifiers"
+    EventTarget      EventKind = "target" // the number a stage needs, with how it was worked out
+    EventHitRoll     EventKind = "hit_roll"
+    EventWoundRoll   EventKind = "wound_roll"
+    EventSaveRoll    EventKind = "save_roll"
+    EventReroll      EventKind = "reroll"
+    EventDamageRoll  EventKind = "damage_roll"
+    EventFNPRoll     EventKind = "fnp_roll"
+    EventAllocation  EventKind = "allocation"
+    EventTotal       EventKind = "total"   // a stage's successes
+    EventSummary     EventKind = "summary" // damage dealt and what is left of the target
+    EventCharge      EventKind = "charge"  // charge declared
+    EventChargeRoll  EventKind = "charge_roll"
+    EventFight       EventKind = "fight"  // a unit's fight activation (Name fights, piles in, attacks, consolidates)
+    EventBattleShock EventKind = "battle_shock"
+)
+
+// Outcomes of a roll
+const (
+    OutcomeAuto     = "auto"
+    OutcomeCritical = "critical"
+    OutcomeHit      = "hit"
+    OutcomeMiss     = "miss"
+    OutcomeWound    = "wound"
+    OutcomeFail     = "fail"
+    OutcomeSaved    = "saved"
+    OutcomeFailed   = "failed"
+    OutcomeSlain    = "slain"
+    OutcomeHalf     = "half" // target within half range
+    OutcomeSuccess  = "success"
+    OutcomeActive   = "active" // an ability in play for the whole volley
+)
+
+// Steps of a fight activation, carried in a fight event's Outcome
+const (
+    FightActivates   = "fights"      // Effect is the fight step
+    FightDestroyed   = "destroyed"   // slain before its turn came
+    FightNoWeapons   = "no_weapons"
+    FightPileIn      = "pile_in"     // Value is the distance
+    FightAttacks     = "attacks"     // Effect is the weapon
+    FightConsolidate = "consolidate" // Value is the distance
+    FightOver        = "over"        // Effect lists each side's wounds left
+)
+
+// Event is one typed step of a volley, charge, fight or Battle-shock test. Which fields are
+// set depends on Kind. Clients read the fields; String renders them as an English log
+// line for display.
+type Event struct {
+    Kind     EventKind `json:"kind"`
+    Depth    int       `json:"depth,omitempty"`    // nesting, e.g. a volley inside a fight
+    Stage    Stage     `json:"stage,omitempty"`    // roll stage of rolls, re-rolls, targets, modifiers and totals
+    Index    int       `json:"index,omitempty"`    // 1-based die, attack or model number
+    Roll     int       `json:"roll,omitempty"`     // unmodified die result (the original one for re-rolls)
+    Rolls    []int     `json:"rolls,omitempty"`    // several dice at once (Feel No Pain, 2D6)
+    Modifier int       `json:"modifier,omitempty"` // net modifier applied to the roll
+    Target   int       `json:"target,omitempty"`   // number needed (X+), or a weapon's range
+    Outcome  string    `json:"outcome,omitempty"`
+    Value    int       `json:"value,omitempty"`  // result: attacks, damage, a re-rolled die, a total
+    Expr     string    `json:"expr,omitempty"`   // dice expression rolled
+    Name     string    `json:"name,omitempty"`   // ability, rule, unit or model the event is about
+    Effect   string    `json:"effect,omitempty"` // what an ability did, or how a target was worked out
+    Critical int       `json:"critical,omitempty"`
+    Failed   int       `json:"failed,omitempty"`
+    Left     int       `json:"left,omitempty"` // wounds left
+    Lost     int       `json:"lost,omitempty"` // damage or mortal wounds lost
+    Slain    int       `json:"slain,omitempty"`
+    Models   int       `json:"models,omitempty"` // models left
+    Mortal   bool      `json:"mortal,omitempty"` // mortal wounds rather than normal damage
+    Seed     int64     `json:"seed,omitempty"`
+    // Wound target: the weapon's Strength against the target's Toughness
+    Strength  int `json:"strength,omitempty"`
+    Toughness int `json:"toughness,omitempty"`
+    // Save target: the weapon's AP, the unit's armour save, the armour save after AP and
+    // modifiers (7 for none), and whether the invulnerable save in Target is taken instead
+    AP           int  `json:"ap,omitempty"`
+    BaseSave     int  `json:"base_save,omitempty"`
+    Save         int  `json:"save,omitempty"`
+    Invulnerable bool `json:"invulnerable,omitempty"`
+    // Ability events: the ability without its parameters and the parameters, e.g.
+    // "Sustained Hits" ["D3"] or "Anti" ["Infantry" "4+"]; Name is the label shown
+    Ability string   `json:"ability,omitempty"`
+    Params  []string `json:"params,omitempty"`
+}
+
+// rollLabels are the log words for each stage's roll outcomes
+var rollLabels = map[EventKind]map[string]string{
+    EventHitRoll:   {OutcomeCritical: "CRITICAL HIT", OutcomeHit: "HIT", OutcomeMiss: "MISS"},
+    EventWoundRoll: {OutcomeCritical: "CRITICAL WOUND", OutcomeWound: "WOUND", OutcomeFail: "FAIL"},
+    EventSaveRoll:  {OutcomeSaved: "SAVED", OutcomeFailed: "FAILED"},
+}
+
+// String renders the event as an English log line
+func (e Event) String() string {
+    return strings.Repeat("  ", e.Depth) + e.text()
+}
+
+func (e Event) text() string {
+    switch e.Kind {
+    case EventSeed:
+        return fmt.Sprintf("Dice seed: %d", e.Seed)
+    case EventAbility:
+        if e.Outcome == OutcomeActive { return fmt.Sprintf("%s active: %s", e.Name, e.Effect) }
+        return fmt.Sprintf("%s: %s", e.Name, e.Effect)
+    case EventRange:
+        if e.Outcome == OutcomeHalf {
+            return fmt.Sprintf("Range: target at %d\" is within half range of %d\"", e.Value, e.Target)
+        }
+        return fmt.Sprintf("Range: target at %d\" is within range %d\"", e.Value, e.Target)
+    case EventAttacks:
+        return fmt.Sprintf("Attacks A=%s -> %d", e.Expr, e.Value)
+    case EventModifiers:
+        return fmt.Sprintf("Modifiers to %s: %s", e.Stage, e.Effect)
+    case EventTarget:
+        switch e.Stage {
+        case StageHit:
+            return fmt.Sprintf("To Hit: needs %d+", e.Target)
+        case StageWound:
+            how := fmt.Sprintf("S %d vs T %d", e.Strength, e.Toughness)
+            if e.Target > 6 { how += " (can't wound)" }
+            return fmt.Sprintf("To Wound base: %s -> needs %d+", how, e.Target)
+        }
+        return "Saves: " + e.saveText()
+    case EventHitRoll, EventWoundRoll:
+        if e.Outcome == OutcomeAuto {
+            return fmt.Sprintf("Hit (%s) %d: auto-hit", e.Name, e.Index)
+        }
+        word := "Hit"
+        if e.Kind == EventWoundRoll { word = "Wound" }
+        return fmt.Sprintf("%s roll %d: %s -> %s (needs %d+)", word, e.Index, rollStr(e.Roll, e.Modifier), rollLabels[e.Kind][e.Outcome], e.Target)
+    case EventSaveRoll:
+        return fmt.Sprintf("Save roll %d: %d -> %s (needs %d+)", e.Index, e.Roll, rollLabels[e.Kind][e.Outcome], e.Target)
+    case EventReroll:
+        return fmt.Sprintf("%s: %s roll %d re-rolled %d -> %d", e.Name, e.Stage, e.Index, e.Roll, e.Value)
+    case EventDamageRoll:
+        label := "Damage roll"
+        if e.Mortal { label = "Devastating Wounds mortal wounds" }
+        return fmt.Sprintf("%s %d: %s -> %d", label, e.Index, e.Expr, e.Value)
+    case EventFNPRoll:
+        return fmt.Sprintf("Feel No Pain %d+ (%s): rolls %v -> ignored %d damage", e.Target, e.Name, e.Rolls, e.Value)
+    case EventAllocation:
+        return e.allocationText()
+    case EventTotal:
+        switch e.Stage {
+        case StageWound:
+            return fmt.Sprintf("Wounds total: %d (critical: %d)", e.Value, e.Critical)
+        case StageSave:
+            return fmt.Sprintf("Saves total: %d, Unsaved total: %d (TN %d+)", e.Value, e.Failed, e.Target)
+        }
+        return fmt.Sprintf("Hits total: %d", e.Value)
+    case EventSummary:
+        if e.Index > 0 {
+            return fmt.Sprintf("Total Damage: %d, Models slain: %d, Models left: %d, Defender Wounds left: %d", e.Value, e.Slain, e.Models, e.Left)
+        }
+        return fmt.Sprintf("Total Damage: %d, Defender Wounds left: %d", e.Value, e.Left)
+    case EventCharge:
+        return fmt.Sprintf("%s declares a charge against a target %d\" away", e.Name, e.Target)
+    case EventChargeRoll:
+        if e.Outcome == OutcomeSuccess {
+            return fmt.Sprintf("Charge roll: %d + %d = %d (needs %d) -> SUCCESS, %s is in Engagement Range", e.Rolls[0], e.Rolls[1], e.Value, e.Target, e.Name)
+        }
+        return fmt.Sprintf("Charge roll: %d + %d = %d (needs %d) -> FAILED", e.Rolls[0], e.Rolls[1], e.Value, e.Target)
+    case EventFight:
+        return e.fightText()
+    case EventBattleShock:
+        if len(e.Rolls) < 2 {
+            return fmt.Sprintf("%s is Below Half-strength: Battle-shock test", e.Name)
+        }
+        if e.Outcome == OutcomeSuccess {
+            return fmt.Sprintf("Battle-shock roll: %d + %d = %d (Ld %d+) -> PASSED", e.Rolls[0], e.Rolls[1], e.Value, e.Target)
+        }
+        return fmt.Sprintf("Battle-shock roll: %d + %d = %d (Ld %d+) -> FAILED, %s is Battle-shocked (OC 0, no Stratagems) until its next Command phase", e.Rolls[0], e.Rolls[1], e.Value, e.Target, e.Name)
+    }
+    // Notes carry their own wording
+    return e.Effect
+}
+
+// saveText renders how a save target was worked out
+func (e Event) saveText() string {
+    sv := "no save"
+    if e.Save < 7 { sv = fmt.Sprintf("%d+", e.Save) }
+    mod := ""
+    if e.Modifier != 0 { mod = fmt.Sprintf(" and modifier %+d", e.Modifier) }
+    how := fmt.Sprintf("AP %d%s modifies Sv to %s", e.AP, mod, sv)
+    if e.Invulnerable { how += fmt.Sprintf(", Invulnerable %d+ is better -> using Invulnerable", e.Target) }
+    if e.Name != "" { how = e.Name + ": " + how }
+    return how
+}
+
+// fightText renders one step of a fight activation
+func (e Event) fightText() string {
+    switch e.Outcome {
+    case FightActivates:
+        label := "Remaining Combats"
+        if e.Effect == StepFightsFirst { label = "Fights First" }
+        return fmt.Sprintf("%s: %s fights", label, e.Name)
+    case FightDestroyed:
+        return fmt.Sprintf("%s was destroyed before it could fight", e.Name)
+    case FightNoWeapons:
+        return fmt.Sprintf("%s has no melee weapons to fight with", e.Name)
+    case FightPileIn:
+        return fmt.Sprintf("%s piles in %d\"", e.Name, e.Value)
+    case FightAttacks:
+        return fmt.Sprintf("%s attacks with %s", e.Name, e.Effect)
+    case FightConsolidate:
+        return fmt.Sprintf("%s consolidates %d\"", e.Name, e.Value)
+    }
+    return "Fight over: " + e.Effect
+}
+
+// allocationText renders where damage or mortal wounds went
+func (e Event) allocationText() string {
+    if e.Index == 0 {
+        if e.Mortal { return fmt.Sprintf("No models left to allocate to: %d mortal wound(s) lost", e.Lost) }
+        return fmt.Sprintf("No models left to allocate to: %d damage lost", e.Lost)
+    }
+    if e.Mortal {
+        if e.Outcome == OutcomeSlain { return fmt.Sprintf("Mortal wounds: %s (model %d) SLAIN", e.Name, e.Index) }
+        return fmt.Sprintf("Mortal wounds: %s (model %d) has %d wound(s) left", e.Name, e.Index, e.Left)
+    }
+    if e.Outcome == OutcomeSlain {
+        msg := fmt.Sprintf("Allocated %d to %s (model %d): SLAIN", e.Value, e.Name, e.Index)
+        if e.Lost > 0 { msg += fmt.Sprintf(", %d excess damage lost", e.Lost) }
+        return msg
+    }
+    return fmt.Sprintf("Allocated %d to %s (model %d): %d wound(s) left", e.Value, e.Name, e.Index, e.Left)
+}
+
+// FormatEvents renders events as log lines
+func FormatEvents(events []Event) []string {
+    out := make([]string, 0, len(events))
+    for _, e := range events {
+        out = append(out, e.String())
+    }
+    return out
+}
+
+// eventLog collects a resolution's events; a quiet one drops them so simulations don't
+// pay for building and rendering them
+type eventLog struct {
+    quiet  bool
+    events []Event
+}
+
+func (l *eventLog) add(es ...Event) {
+    if !l.quiet { l.events = append(l.events, es...) }
+}
+
+// logs renders the events as text, or nil when quiet
+func (l *eventLog) logs() []string {
+    if l.quiet { return nil }
+    return FormatEvents(l.events)
+}
+
+// nest returns events one level deeper, for a volley inside a charge or fight
+func nest(events []Event) []Event {
+    out := make([]Event, len(events))
+    for i, e := range events {
+        e.Depth++
+        out[i] = e
+    }
+    return out
+}
+
+// note is a free-text event
+func note(kind EventKind, format string, args ...any) Event {
+    return Event{Kind: kind, Effect: fmt.Sprintf(format, args...)}
+}
+
+// ability is an AbilityTriggered event; Ability is name until withAbility says otherwise
+func ability(name, format string, args ...any) Event {
+    return Event{Kind: EventAbility, Name: name, Ability: name, Effect: fmt.Sprintf(format, args...)}
+}
+
+// withAbility sets an ability event's ability and parameters, for labels that carry them
+// (e.g. "Sustained Hits D3")
+func (e Event) withAbility(name string, params ...string) Event {
+    e.Ability, e.Params = name, params
+    return e
+}
+
+// active announces an ability that applies to the whole volley
+func active(name, format string, args ...any) Event {
+    e := ability(name, format, args...)
+    e.Outcome = OutcomeActive
+    return e
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestShootingEvents(t *testing.T) {
+    w := WeaponSnapshot{Name: "Bolt rifle", Type: "ranged", Attacks: "2", Skill: 3, Strength: 4, Damage: "1"}
+    def := UnitSnapshot{Name: "Target", T: 4, Sv: 3, W: 10}
+    // hits: 6, 2; wound 4; save 1
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(6, 2, 4, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var hits, saves []Event
+    for _, e := range res.Events {
+        switch e.Kind {
+        case EventHitRoll:
+            hits = append(hits, e)
+        case EventSaveRoll:
+            saves = append(saves, e)
+        }
+    }
+    wantHits := []Event{
+        {Kind: EventHitRoll, Index: 1, Roll: 6, Target: 3, Outcome: OutcomeCritical},
+        {Kind: EventHitRoll, Index: 2, Roll: 2, Target: 3, Outcome: OutcomeMiss},
+    }
+    if !reflect.DeepEqual(hits, wantHits) {
+        t.Errorf("hit events = %+v, want %+v", hits, wantHits)
+    }
+    if len(saves) != 1 || saves[0].Roll != 1 || saves[0].Outcome != OutcomeFailed || saves[0].Target != 3 {
+        t.Errorf("save events = %+v", saves)
+    }
+    if !reflect.DeepEqual(res.Logs, FormatEvents(res.Events)) {
+        t.Error("logs are not the rendered events")
+    }
+}
+
+func TestStructuredEvents(t *testing.T) {
+    w := WeaponSnapshot{Name: "Shuriken", Type: "ranged", Attacks: "1", Skill: 3, Strength: 4, AP: -3, Damage: "1", Abilities: []string{"Sustained Hits 1", "Anti-Infantry 4+"}}
+    def := UnitSnapshot{Name: "Guardians", T: 4, Sv: 3, InvSv: 5, W: 10, Keywords: []string{"Infantry"}}
+    // hit 6 (critical, one extra hit); wounds 4, 4; saves 1, 1
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(6, 4, 4, 1, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    find := func(match func(Event) bool) Event {
+        for _, e := range res.Events {
+            if match(e) { return e }
+        }
+        t.Fatal("no matching event")
+        return Event{}
+    }
+    save := find(func(e Event) bool { return e.Kind == EventTarget && e.Stage == StageSave })
+    if want := (Event{Kind: EventTarget, Stage: StageSave, Target: 5, AP: -3, BaseSave: 3, Save: 6, Invulnerable: true}); !reflect.DeepEqual(save, want) {
+        t.Errorf("save target = %+v, want %+v", save, want)
+    }
+    sustained := find(func(e Event) bool { return e.Kind == EventAbility && e.Ability == "Sustained Hits" && e.Index > 0 })
+    if !reflect.DeepEqual(sustained.Params, []string{"1"}) || sustained.Index != 1 || sustained.Value != 1 {
+        t.Errorf("sustained hits = %+v, want params [1], attack 1, 1 extra hit", sustained)
+    }
+    anti := find(func(e Event) bool { return e.Kind == EventAbility && e.Ability == "Anti" })
+    if !reflect.DeepEqual(anti.Params, []string{"Infantry", "4+"}) || anti.Stage != StageWound || anti.Target != 4 {
+        t.Errorf("anti = %+v, want params [Infantry 4+] on wound 4+", anti)
+    }
+}
+
+func TestEventString(t *testing.T) {
+    cases := []struct {
+        e    Event
+        want string
+    }{
+        {Event{Kind: EventHitRoll, Index: 1, Roll: 3, Modifier: 1, Target: 3, Outcome: OutcomeHit}, "Hit roll 1: 3+1=4 -> HIT (needs 3+)"},
+        {Event{Kind: EventSaveRoll, Index: 2, Roll: 2, Target: 4, Outcome: OutcomeFailed}, "Save roll 2: 2 -> FAILED (needs 4+)"},
+        {Event{Kind: EventReroll, Name: "Twin-linked", Stage: StageWound, Index: 1, Roll: 1, Value: 5}, "Twin-linked: wound roll 1 re-rolled 1 -> 5"},
+        {Event{Kind: EventAllocation, Depth: 1, Name: "Marine", Index: 2, Value: 2, Outcome: OutcomeSlain, Lost: 1}, "  Allocated 2 to Marine (model 2): SLAIN, 1 excess damage lost"},
+        {Event{Kind: EventChargeRoll, Name: "Boyz", Rolls: []int{3, 4}, Value: 7, Target: 8}, "Charge roll: 3 + 4 = 7 (needs 8) -> FAILED"},
+        {Event{Kind: EventTarget, Stage: StageWound, Target: 4, Strength: 4, Toughness: 4}, "To Wound base: S 4 vs T 4 -> needs 4+"},
+        {Event{Kind: EventTarget, Stage: StageSave, Target: 4, Modifier: 1, Name: "Captain", AP: -2, BaseSave: 3, Save: 5, Invulnerable: true},
+            "Saves: Captain: AP -2 and modifier +1 modifies Sv to 5+, Invulnerable 4+ is better -> using Invulnerable"},
+    }
+    for _, c := range cases {
+        if got := c.e.String(); got != c.want {
+            t.Errorf("%+v: got %q, want %q", c.e, got, c.want)
+        }
+    }
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fight steps in the order they are resolved
+const (
+    StepFightsFirst = "fights_first"
+    StepRemaining   = "remaining_combats"
+)
+
+// pileInDistance is how far a unit piles in before and consolidates after it fights
+const pileInDistance = 3
+
+// Fighter is one side of a fight
+type Fighter struct {
+    Unit UnitSnapshot
+    // The melee weapon the unit fights with, plus any Extra Attacks weapons (see FightLoadout)
+    Weapons   []WeaponSnapshot
+    Charged   bool      // made a Charge move this turn: fights in the Fights First step (and enables Lance)
+    Modifiers Modifiers // caller-supplied modifiers for this side's attacks
+    Rerolls   Rerolls   // re-roll policies for this side's attacks
+}
+
+// FightOptions carries the per-fight inputs that aren't part of either fighter
+type FightOptions struct {
+    Roller Roller // dice source; nil means a fresh time-seeded roller
+    // Index (0 or 1) of the fighter whose turn it is. Within a fight step the other
+    // player's eligible unit fights first.
+    Active int
+    Quiet   bool    // skip events and logs (see ShootingOptions.Quiet)
+    Ruleset Ruleset // for every volley; nil means DefaultRuleset
+}
+
+// FightActivation is one unit's activation: pile in, fight with each weapon, consolidate
+type FightActivation struct {
+    Side        int              `json:"side"`
+    Unit        string           `json:"unit"`
+    Step        string           `json:"step"`
+    PileIn      int              `json:"pile_in"`     // inches
+    Volleys     []ShootingResult `json:"volleys"`     // one per weapon, each with its own subphases
+    Consolidate int              `json:"consolidate"` // inches
+    Skipped     string           `json:"skipped,omitempty"` // why the unit didn't fight
+}
+
+// FightSide is the state of one fighter after the fight
+type FightSide struct {
+    Name        string       `json:"name"`
+    Models      []ModelState `json:"models"`
+    Wounds      int          `json:"wounds"` // wounds left across the unit
+    ModelsSlain int          `json:"models_slain"`
+    Damaged     bool         `json:"damaged,omitempty"` // dropped into its damaged bracket
+}
+
+// FightResult captures the fight phase between two units
+type FightResult struct {
+    Logs        []string          `json:"logs"` // Events rendered as text
+    Events      []Event           `json:"events"`
+    Order       []string          `json:"order"` // units in activation order
+    Activations []FightActivation `json:"activations"`
+    Sides       [2]FightSide      `json:"sides"`
+    Seed        int64             `json:"seed"`
+}
+
+// unseededRoller hides a roller's seed so per-weapon volleys don't each log it
+type unseededRoller struct{ Roller }
+
+// FightLoadout picks the weapons a unit fights with: the chosen weapon plus every
+// weapon with Extra Attacks, which is used in addition to it
+func FightLoadout(weapons []WeaponSnapshot, chosen int) []WeaponSnapshot {
+    var out []WeaponSnapshot
+    if chosen >= 0 && chosen < len(weapons) { out = append(out, weapons[chosen]) }
+    for i, w := range weapons {
+        if i != chosen && ParseWeaponAbilities(w.Abilities...).ExtraAttacks {
+            out = append(out, w)
+        }
+    }
+    return out
+}
+
+// fightsFirst reports whether a fighter resolves its attacks in the Fights First step
+func (f Fighter) fightsFirst() bool {
+    return f.Charged || hasUnitAbility(f.Unit.Abilities, "Fights First")
+}
+
+// validate checks the fighter has at most one main melee weapon besides Extra Attacks
+// weapons. A fighter without weapons is allowed; it just makes no attacks.
+func (f Fighter) validate() error {
+    main := 0
+    for _, w := range f.Weapons {
+        if !w.IsMelee() {
+            return fmt.Errorf("%s is not a melee weapon", w.Name)
+        }
+        if !ParseWeaponAbilities(w.Abilities...).ExtraAttacks { main++ }
+    }
+    if main > 1 {
+        return fmt.Errorf("%s can fight with only one weapon besides Extra Attacks weapons", f.Unit.Name)
+    }
+    return nil
+}
+
+// fightOrder returns the sides in activation order with their step: Fights First units
+// before the rest, and within a step the player whose turn it isn't goes first
+func fightOrder(fs [2]Fighter, active int) ([]int, []string) {
+    first := 1 - active
+    var order []int
+    var steps []string
+    for _, step := range []string{StepFightsFirst, StepRemaining} {
+        for _, side := range []int{first, active} {
+            if fs[side].fightsFirst() == (step == StepFightsFirst) {
+                order = append(order, side)
+                steps = append(steps, step)
+            }
+        }
+    }
+    return order, steps
+}
+
+// ResolveFight resolves the fight phase between two units in base contact. Each unit
+// activates once in fight order, piling in, attacking with its weapons and consolidating;
+// a unit destroyed before its activation doesn't fight.
+func ResolveFight(a, b Fighter, opts FightOptions) (FightResult, error) {
+    if opts.Active != 0 && opts.Active != 1 {
+        return FightResult{}, fmt.Errorf("active fighter must be 0 or 1, got %d", opts.Active)
+    }
+    fs := [2]Fighter{a, b}
+    for _, f := range fs {
+        if err := f.validate(); err != nil {
+            return FightResult{}, err
+        }
+        for _, err := range []error{f.Modifiers.Validate(), f.Rerolls.Validate()} {
+            if err != nil { return FightResult{}, err }
+        }
+    }
+    ev := &eventLog{quiet: opts.Quiet}
+    rng := opts.Roller
+    if rng == nil { rng = newRNG() }
+    var seed int64
+    if sd, ok := rng.(Seeder); ok {
+        seed = sd.Seed()
+        ev.add(Event{Kind: EventSeed, Seed: seed})
+    }
+    volleyRng := unseededRoller{rng}
+
+    models := [2][]ModelState{unitModels(a.Unit), unitModels(b.Unit)}
+    slain := [2]int{}
+    order, steps := fightOrder(fs, opts.Active)
+    res := FightResult{Seed: seed, Order: make([]string, 0, len(order)), Activations: make([]FightActivation, 0, len(order))}
+    for i, side := range order {
+        f, foe := fs[side], fs[1-side]
+        act := FightActivation{Side: side, Unit: f.Unit.Name, Step: steps[i]}
+        res.Order = append(res.Order, f.Unit.Name)
+        ev.add(Event{Kind: EventFight, Name: f.Unit.Name, Outcome: FightActivates, Effect: act.Step})
+        if AliveCount(models[side]) == 0 {
+            act.Skipped = "destroyed before it could fight"
+            ev.add(Event{Kind: EventFight, Name: f.Unit.Name, Outcome: FightDestroyed})
+            res.Activations = append(res.Activations, act)
+            continue
+        }
+        if len(f.Weapons) == 0 {
+            act.Skipped = "no melee weapons"
+            ev.add(Event{Kind: EventFight, Name: f.Unit.Name, Outcome: FightNoWeapons})
+            res.Activations = append(res.Activations, act)
+            continue
+        }
+        act.PileIn = pileInDistance
+        act.Volleys = make([]ShootingResult, 0, len(f.Weapons))
+        ev.add(Event{Kind: EventFight, Name: f.Unit.Name, Outcome: FightPileIn, Value: pileInDistance})
+        att := f.Unit
+        att.Models = models[side] // the attacker is only read
+        for _, w := range f.Weapons {
+            if AliveCount(models[1-side]) == 0 { break }
+            def := foe.Unit
+            def.Models = models[1-side]
+            vr, err := ResolveShootingWith(att, def, w, ShootingOptions{Roller: volleyRng, Charged: f.Charged, Modifiers: f.Modifiers, Rerolls: f.Rerolls, Quiet: opts.Quiet, Ruleset: opts.Ruleset})
+            if err != nil {
+                return FightResult{}, err
+            }
+            ev.add(Event{Kind: EventFight, Name: f.Unit.Name, Outcome: FightAttacks, Effect: w.Name})
+            ev.add(nest(vr.Events)...)
+            models[1-side] = vr.Models
+            slain[1-side] += vr.ModelsSlain
+            def.Models = vr.Models
+            if IsDamaged(def) { fs[1-side].Unit.Degraded = true }
+            act.Volleys = append(act.Volleys, vr)
+        }
+        act.Consolidate = pileInDistance
+        ev.add(Event{Kind: EventFight, Name: f.Unit.Name, Outcome: FightConsolidate, Value: pileInDistance})
+        res.Activations = append(res.Activations, act)
+    }
+    for side := range fs {
+        u := fs[side].Unit
+        u.Models = models[side]
+        res.Sides[side] = FightSide{Name: u.Name, Models: models[side], Wounds: ModelsRemaining(models[side]), ModelsSlain: slain[side], Damaged: IsDamaged(u)}
+    }
+    if !ev.quiet {
+        names := make([]string, 0, 2)
+        for _, s := range res.Sides {
+            names = append(names, fmt.Sprintf("%s %d wound(s) left", s.Name, s.Wounds))
+        }
+        ev.add(Event{Kind: EventFight, Outcome: FightOver, Effect: strings.Join(names, ", ")})
+    }
+    res.Events, res.Logs = ev.events, ev.logs()
+    return res, nil
+}
+
+// Summary totals one side's attacks in the ShootingResult shape, with the whole fight's
+// logs, so callers that show a single volley can show a fight the same way
+func (f FightResult) Summary(side int) ShootingResult {
+    out := ShootingResult{Logs: f.Logs, Events: f.Events, Seed: f.Seed}
+    for _, act := range f.Activations {
+        if act.Side != side { continue }
+        for _, v := range act.Volleys {
+            out.Attacks += v.Attacks
+            out.Hits += v.Hits
+            out.Wounds += v.Wounds
+            out.Saved += v.Saved
+            out.Unsaved += v.Unsaved
+            out.DamageTotal += v.DamageTotal
+            out.MortalWounds += v.MortalWounds
+            for _, st := range v.SingleRerolls {
+                if !containsStage(out.SingleRerolls, st) { out.SingleRerolls = append(out.SingleRerolls, st) }
+            }
+        }
+    }
+    foe := f.Sides[1-side]
+    out.DefenderWounds = foe.Wounds
+    out.ModelsSlain = foe.ModelsSlain
+    out.WoundsLeftOnModel = woundsOnDamagedModel(foe.Models)
+    out.Models = foe.Models
+    return out
+}
+
+func containsStage(sts []Stage, st Stage) bool {
+    for _, s := range sts {
+        if s == st { return true }
+    }
+    return false
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func melee(name, attacks, damage string, abilities ...string) WeaponSnapshot {
+    return WeaponSnapshot{Name: name, Type: "melee", Attacks: attacks, Skill: 3, Strength: 4, Damage: damage, Abilities: abilities}
+}
+
+func TestFightOrder(t *testing.T) {
+    plain := Fighter{Unit: UnitSnapshot{Name: "A"}}
+    first := Fighter{Unit: UnitSnapshot{Name: "B", Abilities: []string{"Fights First"}}}
+    cases := []struct {
+        fs     [2]Fighter
+        active int
+        order  []int
+        steps  []string
+    }{
+        // the player whose turn it isn't fights first within a step
+        {[2]Fighter{plain, plain}, 0, []int{1, 0}, []string{StepRemaining, StepRemaining}},
+        {[2]Fighter{plain, plain}, 1, []int{0, 1}, []string{StepRemaining, StepRemaining}},
+        // a charger fights in the Fights First step
+        {[2]Fighter{{Unit: plain.Unit, Charged: true}, plain}, 0, []int{0, 1}, []string{StepFightsFirst, StepRemaining}},
+        {[2]Fighter{plain, first}, 1, []int{1, 0}, []string{StepFightsFirst, StepRemaining}},
+    }
+    for i, c := range cases {
+        order, steps := fightOrder(c.fs, c.active)
+        if !reflect.DeepEqual(order, c.order) || !reflect.DeepEqual(steps, c.steps) {
+            t.Errorf("case %d: order %v %v, want %v %v", i, order, steps, c.order, c.steps)
+        }
+    }
+}
+
+func TestFightSlainUnitDoesNotFight(t *testing.T) {
+    a := Fighter{Unit: UnitSnapshot{Name: "Chargers", T: 4, Sv: 3, W: 2}, Weapons: []WeaponSnapshot{melee("Sword", "2", "1")}, Charged: true}
+    b := Fighter{Unit: UnitSnapshot{Name: "Victims", T: 4, Sv: 7, W: 2}, Weapons: []WeaponSnapshot{melee("Claws", "4", "1")}}
+    // the chargers hit and wound twice against no save, slaying the defenders first
+    res, err := ResolveFight(a, b, FightOptions{Roller: NewScriptedRoller(3, 3, 4, 4), Active: 0})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []string{"Chargers", "Victims"}; !reflect.DeepEqual(res.Order, want) {
+        t.Errorf("order %v, want %v", res.Order, want)
+    }
+    if res.Sides[1].Wounds != 0 || res.Activations[1].Skipped == "" || res.Sides[0].Wounds != 2 {
+        t.Errorf("sides %+v, second activation %+v; want the defenders slain before fighting", res.Sides, res.Activations[1])
+    }
+}
+
+func TestFightLoadoutAndValidation(t *testing.T) {
+    ws := []WeaponSnapshot{melee("Sword", "3", "1"), melee("Axe", "2", "2"), melee("Bite", "1", "1", "Extra Attacks")}
+    got := FightLoadout(ws, 1)
+    if len(got) != 2 || got[0].Name != "Axe" || got[1].Name != "Bite" {
+        t.Errorf("FightLoadout = %v, want Axe and Bite", got)
+    }
+    two := Fighter{Unit: UnitSnapshot{Name: "Greedy"}, Weapons: ws[:2]}
+    if _, err := ResolveFight(two, Fighter{Unit: UnitSnapshot{Name: "Foe", W: 1}}, FightOptions{}); err == nil {
+        t.Error("two main melee weapons were accepted")
+    }
+    gun := Fighter{Unit: UnitSnapshot{Name: "Shooter"}, Weapons: []WeaponSnapshot{{Name: "Gun", Type: "ranged", Attacks: "1", Damage: "1"}}}
+    if _, err := ResolveFight(gun, Fighter{Unit: UnitSnapshot{Name: "Foe", W: 1}}, FightOptions{}); err == nil {
+        t.Error("a ranged weapon was accepted in a fight")
+    }
+}
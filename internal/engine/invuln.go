@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Attack types an invulnerable save can be limited to
+const (
+    AgainstRanged = "ranged"
+    AgainstMelee  = "melee"
+)
+
+// InvulnSave is an invulnerable save that only applies under a condition: against one
+// type of attack, to some of the unit's models, or both
+type InvulnSave struct {
+    TN      int      `json:"tn"`                // 2-6
+    Against string   `json:"against,omitempty"` // AgainstRanged or AgainstMelee; empty for every attack
+    Models  []string `json:"models,omitempty"`  // the only models (by name) it covers; empty for all
+    Except  []string `json:"except,omitempty"`  // models (by name) it doesn't cover
+    Source  string   `json:"source,omitempty"`  // the datasheet text the condition came from
+}
+
+// appliesTo reports whether the save can be taken against the weapon by the named model
+func (s InvulnSave) appliesTo(w WeaponSnapshot, model string) bool {
+    switch s.Against {
+    case AgainstRanged:
+        if w.IsMelee() { return false }
+    case AgainstMelee:
+        if !w.IsMelee() { return false }
+    }
+    if len(s.Models) > 0 && !matchesModel(s.Models, model) { return false }
+    return !matchesModel(s.Except, model)
+}
+
+// perModel reports whether the save depends on which model the attack is allocated to
+func (s InvulnSave) perModel() bool { return len(s.Models) > 0 || len(s.Except) > 0 }
+
+// Condition describes when the save applies, e.g. "against ranged attacks"
+func (s InvulnSave) Condition() string {
+    var parts []string
+    if s.Against != "" { parts = append(parts, "against "+s.Against+" attacks") }
+    if len(s.Models) > 0 { parts = append(parts, "for "+strings.Join(s.Models, ", ")) }
+    if len(s.Except) > 0 { parts = append(parts, "except "+strings.Join(s.Except, ", ")) }
+    return strings.Join(parts, ", ")
+}
+
+// matchesModel reports whether a model's name is one of names (case-insensitive), so
+// "Kill Team Terminator" matches "KILL TEAM TERMINATOR" models but not "Terminator" ones
+func matchesModel(names []string, model string) bool {
+    m := strings.TrimSpace(model)
+    if m == "" { return false }
+    for _, n := range names {
+        if strings.EqualFold(strings.TrimSpace(n), m) { return true }
+    }
+    return false
+}
+
+var (
+    invTNRe      = regexp.MustCompile(`([2-6])\+`)
+    invOnlyRe    = regexp.MustCompile(`^(?:the )?(.+?)(?: models?)? only\.?$`)
+    invExcludeRe = regexp.MustCompile(`^excluding (?:the )?(.+?)\.?$`)
+)
+
+// ParseInvulnSaves reads a datasheet's invulnerable save and its description. It returns
+// the save that always applies (0 if none) and the conditional ones. Recognised conditions
+// are "against ranged/melee attacks" (including "improved to X+ against melee attacks"),
+// "<model> only" and "Excluding the <model>"; other notes (such as re-roll restrictions)
+// don't limit when the save applies, so the save stays unconditional.
+func ParseInvulnSaves(tn int, descr string) (int, []InvulnSave) {
+    if tn < 2 || tn > 6 { tn = 0 }
+    src := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(descr), "*"))
+    d := strings.ToLower(strings.Join(strings.Fields(src), " "))
+    if d == "" { return tn, nil }
+    save := InvulnSave{TN: tn, Source: src}
+    if m := invTNRe.FindStringSubmatch(d); m != nil {
+        save.TN, _ = strconv.Atoi(m[1])
+    }
+    switch {
+    case strings.Contains(d, "ranged attacks"):
+        save.Against = AgainstRanged
+    case strings.Contains(d, "melee attacks"):
+        save.Against = AgainstMelee
+    case invExcludeRe.MatchString(d):
+        save.Except = []string{titleWords(invExcludeRe.FindStringSubmatch(d)[1])}
+        return 0, []InvulnSave{save}
+    case invOnlyRe.MatchString(d):
+        save.Models = []string{titleWords(invOnlyRe.FindStringSubmatch(d)[1])}
+        return 0, []InvulnSave{save}
+    default:
+        return tn, nil
+    }
+    if save.TN == 0 { return tn, nil }
+    // "improved to 4+ against melee attacks": the listed save still applies to everything else
+    if strings.Contains(d, "improved") || (tn > 0 && save.TN != tn) {
+        return tn, []InvulnSave{save}
+    }
+    return 0, []InvulnSave{save}
+}
+
+// titleWords capitalises each word of a model name taken from lowercased text
+func titleWords(s string) string {
+    words := strings.Fields(s)
+    for i, w := range words {
+        words[i] = strings.ToUpper(w[:1]) + w[1:]
+    }
+    return strings.Join(words, " ")
+}
+
+// invulnFor returns the best invulnerable save a model of the unit has against the
+// weapon: the unit's InvSv or a conditional save whose condition matches. The
+// conditional save is returned when it's the one that counts, for the log.
+func invulnFor(u UnitSnapshot, w WeaponSnapshot, model string) (int, *InvulnSave) {
+    best := u.InvSv
+    var from *InvulnSave
+    for i := range u.InvSaves {
+        s := &u.InvSaves[i]
+        if s.TN < 2 || s.TN > 6 || !s.appliesTo(w, model) { continue }
+        if best == 0 || s.TN < best {
+            best, from = s.TN, s
+        }
+    }
+    return best, from
+}
+
+// invulnPerModel reports whether any of the unit's invulnerable saves depends on the
+// model an attack is allocated to
+func invulnPerModel(u UnitSnapshot) bool {
+    for _, s := range u.InvSaves {
+        if s.perModel() { return true }
+    }
+    return false
+}
+
+// invulnNote renders the log note for a conditional save that was used
+func invulnNote(s *InvulnSave, model string) Event {
+    cond := s.Condition()
+    if s.perModel() && model != "" && len(s.Models) == 0 { cond += " (" + model + ")" }
+    e := ability("Invulnerable Save", "%d+ %s (%s)", s.TN, cond, s.Source).withAbility("Invulnerable Save", fmt.Sprintf("%d+", s.TN))
+    e.Stage, e.Target = StageSave, s.TN
+    return e
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseInvulnSaves(t *testing.T) {
+    cases := []struct {
+        tn    int
+        descr string
+        base  int
+        saves []InvulnSave
+    }{
+        {4, "", 4, nil},
+        {4, "* This model has a 4+ invulnerable save against ranged attacks.", 0, []InvulnSave{{TN: 4, Against: AgainstRanged, Source: "This model has a 4+ invulnerable save against ranged attacks."}}},
+        {5, "Improved to 4+ against melee attacks.", 5, []InvulnSave{{TN: 4, Against: AgainstMelee, Source: "Improved to 4+ against melee attacks."}}},
+        {4, "Captain only", 0, []InvulnSave{{TN: 4, Models: []string{"Captain"}, Source: "Captain only"}}},
+        {5, "Excluding the Servitor.", 0, []InvulnSave{{TN: 5, Except: []string{"Servitor"}, Source: "Excluding the Servitor."}}},
+        {4, "You cannot re-roll invulnerable saving throws.", 4, nil},
+    }
+    for _, c := range cases {
+        base, saves := ParseInvulnSaves(c.tn, c.descr)
+        if base != c.base || !reflect.DeepEqual(saves, c.saves) {
+            t.Errorf("ParseInvulnSaves(%d, %q) = %d %+v, want %d %+v", c.tn, c.descr, base, saves, c.base, c.saves)
+        }
+    }
+}
+
+func TestInvulnerableAgainstRangedOnly(t *testing.T) {
+    def := UnitSnapshot{Name: "Shieldbearer", T: 4, Sv: 3, W: 10, InvSaves: []InvulnSave{{TN: 4, Against: AgainstRanged}}}
+    // hit 3, wound 5, save 4: AP -3 leaves the armour save at 6+, so only the invulnerable save holds
+    for _, c := range []struct {
+        kind  string
+        saved int
+    }{{"ranged", 1}, {"melee", 0}} {
+        w := WeaponSnapshot{Name: "Blade", Type: c.kind, Attacks: "1", Skill: 3, Strength: 4, AP: -3, Damage: "1"}
+        res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 5, 4)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Saved != c.saved {
+            t.Errorf("%s attack: saved %d, want %d", c.kind, res.Saved, c.saved)
+        }
+    }
+}
+
+func TestInvulnerablePerModel(t *testing.T) {
+    def := UnitSnapshot{Name: "Retinue", T: 4, Sv: 7, W: 1, InvSaves: []InvulnSave{{TN: 4, Except: []string{"Servitor"}}},
+        Models: []ModelState{{Name: "Servitor", W: 1, Wounds: 1}, {Name: "Magos", W: 1, Wounds: 1}}}
+    w := WeaponSnapshot{Name: "Bolter", Type: "ranged", Attacks: "2", Skill: 3, Strength: 4, Damage: "1"}
+    // hits 3, 3; wounds 4, 4; saves 5, 5: the Servitor takes the first wound without a
+    // save, then the Magos saves on its 4+ invulnerable
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(3, 3, 4, 4, 5, 5)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Saved != 1 || res.ModelsSlain != 1 || res.Models[1].Wounds != 1 {
+        t.Errorf("saved %d slain %d, models %+v; want the Magos to save", res.Saved, res.ModelsSlain, res.Models)
+    }
+}
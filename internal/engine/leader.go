@@ -0,0 +1,61 @@
+package engine
+
+import "strings"
+
+// AttachLeader combines a leader and the bodyguard unit it leads into one unit. The
+// combined unit uses the bodyguard's Toughness and saves, the best Leadership of the
+// two, and gains the leader's abilities and keywords. The leader's models join the
+// unit as Character models, which attacks only reach with Precision or once the
+// bodyguard is destroyed. Each side's invulnerable saves only cover its own models.
+func AttachLeader(bodyguard, leader UnitSnapshot) UnitSnapshot {
+    u := bodyguard
+    u.ID = bodyguard.ID + "+" + leader.ID
+    u.Name = leader.Name + " leading " + bodyguard.Name
+    if leader.Ld > 0 && (u.Ld == 0 || leader.Ld < u.Ld) { u.Ld = leader.Ld }
+    u.Keywords = mergeNames(bodyguard.Keywords, leader.Keywords)
+    u.Abilities = mergeNames(bodyguard.Abilities, leader.Abilities)
+    u.Models = unitModels(bodyguard)
+    // each side's model names, once each
+    var guards, names []string
+    for _, m := range u.Models { guards = mergeNames(guards, []string{m.Name}) }
+    for _, m := range unitModels(leader) {
+        m.Character = true
+        u.Models = append(u.Models, m)
+        names = mergeNames(names, []string{m.Name})
+    }
+    // the bodyguard's unconditional save becomes a scoped one, so it stops covering the leader
+    u.InvSv = 0
+    u.InvSaves = nil
+    for _, s := range unitInvulns(bodyguard) {
+        if len(s.Models) == 0 { s.Models = guards }
+        u.InvSaves = append(u.InvSaves, s)
+    }
+    for _, s := range unitInvulns(leader) {
+        if len(s.Models) == 0 { s.Models = names }
+        u.InvSaves = append(u.InvSaves, s)
+    }
+    u.W = ModelsRemaining(u.Models)
+    return u
+}
+
+// unitInvulns lists a unit's invulnerable saves, its unconditional one included
+func unitInvulns(unit UnitSnapshot) []InvulnSave {
+    out := append([]InvulnSave(nil), unit.InvSaves...)
+    if unit.InvSv > 0 {
+        out = append(out, InvulnSave{TN: unit.InvSv, Source: unit.Name})
+    }
+    return out
+}
+
+// mergeNames appends the names in b that aren't already in a (case-insensitive)
+func mergeNames(a, b []string) []string {
+    out := append([]string(nil), a...)
+    for _, n := range b {
+        seen := false
+        for _, o := range out {
+            if strings.EqualFold(strings.TrimSpace(o), strings.TrimSpace(n)) { seen = true }
+        }
+        if !seen { out = append(out, n) }
+    }
+    return out
+}
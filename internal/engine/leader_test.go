@@ -0,0 +1,67 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestAttachLeader(t *testing.T) {
+    guard := UnitSnapshot{ID: "g", Name: "Intercessors", T: 4, Sv: 3, Ld: 7, Keywords: []string{"Infantry"}, Abilities: []string{"Oath"}, Models: squad(2, 2)}
+    leader := UnitSnapshot{ID: "l", Name: "Captain", T: 4, Sv: 3, Ld: 6, Keywords: []string{"Infantry", "Character"}, Abilities: []string{"oath", "Rites"}, W: 5}
+    u := AttachLeader(guard, leader)
+    if u.Name != "Captain leading Intercessors" || u.Ld != 6 || u.W != 9 || len(u.Models) != 3 || !u.Models[2].Character {
+        t.Errorf("attached unit %+v", u)
+    }
+    if len(u.Keywords) != 2 || len(u.Abilities) != 2 {
+        t.Errorf("keywords %v abilities %v, want the names merged without duplicates", u.Keywords, u.Abilities)
+    }
+    if len(guard.Models) != 2 || guard.Models[0].Character {
+        t.Error("the bodyguard's models were changed")
+    }
+}
+
+func TestPrecisionReachesCharacters(t *testing.T) {
+    u := AttachLeader(UnitSnapshot{Name: "Guard", Models: squad(2, 1)}, UnitSnapshot{Name: "Captain", W: 5})
+    if got := allocationTarget(u.Models, false); got != 0 {
+        t.Errorf("without Precision the attack goes to model %d, want a bodyguard", got)
+    }
+    if got := allocationTarget(u.Models, true); got != 2 {
+        t.Errorf("with Precision the attack goes to model %d, want the Character", got)
+    }
+    u.Models[0].Wounds, u.Models[1].Wounds = 0, 0
+    if got := allocationTarget(u.Models, false); got != 2 {
+        t.Errorf("with the bodyguard destroyed the attack goes to model %d, want the Character", got)
+    }
+}
+
+func TestShootingPrecision(t *testing.T) {
+    unit := AttachLeader(UnitSnapshot{Name: "Guard", T: 4, Sv: 7, Models: squad(2, 1)}, UnitSnapshot{Name: "Captain", W: 5})
+    sniper := WeaponSnapshot{Name: "Sniper", Type: "ranged", Attacks: "1", Skill: 3, Strength: 4, Damage: "3", Abilities: []string{"Precision"}}
+    res, err := ResolveShootingWith(UnitSnapshot{}, unit, sniper, ShootingOptions{Roller: NewScriptedRoller(3, 4)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Models[2].Wounds != 2 || res.Models[0].Wounds != 1 {
+        t.Errorf("models after a Precision shot: %+v", res.Models)
+    }
+}
+
+func TestAttachLeaderScopesInvulnerableSaves(t *testing.T) {
+    terminator := ModelState{Name: "Terminator", W: 3, Wounds: 3}
+    guards := UnitSnapshot{ID: "t", Name: "Terminators", InvSv: 4, Models: []ModelState{terminator, terminator, terminator}}
+    leader := UnitSnapshot{ID: "c", Name: "Captain", InvSv: 5, Models: []ModelState{{Name: "Terminator Captain", W: 5, Wounds: 5}}}
+    u := AttachLeader(guards, leader)
+    gun := WeaponSnapshot{Name: "Bolter", Type: "ranged"}
+    // "Terminator" names the bodyguard's models only, not the Terminator Captain
+    for _, c := range []struct {
+        model string
+        want  int
+    }{{"Terminator", 4}, {"terminator", 4}, {"Terminator Captain", 5}} {
+        if got, _ := invulnFor(u, gun, c.model); got != c.want {
+            t.Errorf("%s: %d+ invulnerable save, want %d+", c.model, got, c.want)
+        }
+    }
+    if len(u.InvSaves) != 2 || !reflect.DeepEqual(u.InvSaves[0].Models, []string{"Terminator"}) {
+        t.Errorf("invulnerable saves %+v, want the bodyguard's scoped to Terminator once", u.InvSaves)
+    }
+}
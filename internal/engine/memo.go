@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// memo caches values parsed from strings (dice expressions, ability lists) so the hot
+// resolution path doesn't parse the same text on every volley. Keys can come from client
+// requests, so it stops taking new entries once it holds limit of them.
+type memo[V any] struct {
+    limit int64
+    m     sync.Map // key -> V
+    n     atomic.Int64
+}
+
+func (c *memo[V]) load(key string) (V, bool) {
+    v, ok := c.m.Load(key)
+    if !ok {
+        var zero V
+        return zero, false
+    }
+    return v.(V), true
+}
+
+func (c *memo[V]) store(key string, v V) {
+    if c.n.Load() >= c.limit { return }
+    if _, loaded := c.m.LoadOrStore(key, v); !loaded { c.n.Add(1) }
+}
+
+// memoKey joins a list of strings into one cache key
+func memoKey(src []string) string {
+    if len(src) == 1 { return src[0] }
+    return strings.Join(src, "\x00")
+}
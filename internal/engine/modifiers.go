@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stage names a roll that modifiers can apply to
+type Stage string
+
+const (
+    StageHit   Stage = "hit"
+    StageWound Stage = "wound"
+    StageSave  Stage = "save"
+)
+
+// Modifier is a +N/-N to one roll stage, tagged with the rule that granted it
+type Modifier struct {
+    Stage  Stage  `json:"stage"`
+    Value  int    `json:"value"`
+    Source string `json:"source"`
+}
+
+// Modifiers is a stack of roll modifiers from abilities, options and callers
+type Modifiers []Modifier
+
+// Validate rejects modifiers for unknown stages or with a zero value
+func (ms Modifiers) Validate() error {
+    for _, m := range ms {
+        switch m.Stage {
+        case StageHit, StageWound, StageSave:
+        default:
+            return fmt.Errorf("unknown modifier stage %q (want hit, wound or save)", m.Stage)
+        }
+        if m.Value == 0 {
+            return fmt.Errorf("modifier %q for %s has no value", m.Source, m.Stage)
+        }
+    }
+    return nil
+}
+
+// For returns the modifiers that apply to one stage
+func (ms Modifiers) For(stage Stage) Modifiers {
+    var out Modifiers
+    for _, m := range ms {
+        if m.Stage == stage { out = append(out, m) }
+    }
+    return out
+}
+
+// Net sums a stage's modifiers and applies the 10th edition caps: hit and wound
+// rolls can't be modified by more than +1 or -1, and a save can't be improved by
+// more than +1 (worsening is uncapped).
+func (ms Modifiers) Net(stage Stage) int {
+    net := 0
+    for _, m := range ms.For(stage) {
+        net += m.Value
+    }
+    if net > 1 { net = 1 }
+    if net < -1 && stage != StageSave { net = -1 }
+    return net
+}
+
+// Describe renders a stage's modifiers for the log, e.g. "Heavy +1, Stealth -1 -> net +0"
+func (ms Modifiers) Describe(stage Stage) string {
+    list := ms.For(stage)
+    parts := make([]string, 0, len(list))
+    raw := 0
+    for _, m := range list {
+        parts = append(parts, fmt.Sprintf("%s %+d", m.Source, m.Value))
+        raw += m.Value
+    }
+    net := ms.Net(stage)
+    out := fmt.Sprintf("%s -> net %+d", strings.Join(parts, ", "), net)
+    if net != raw { out += fmt.Sprintf(" (capped from %+d)", raw) }
+    return out
+}
+
+// hasUnitAbility reports whether a unit has an ability by exact (case-insensitive) name
+func hasUnitAbility(abilities []string, name string) bool {
+    for _, a := range abilities {
+        if strings.EqualFold(strings.TrimSpace(a), name) { return true }
+    }
+    return false
+}
+
+// volleyModifiers collects the modifiers that weapon abilities, a damaged attacker, the
+// defender's abilities and the volley options grant, followed by any caller-supplied ones
+func volleyModifiers(att, def UnitSnapshot, w WeaponSnapshot, ab WeaponAbilities, opts ShootingOptions) Modifiers {
+    ms := damagedModifiers(att)
+    ranged := !w.IsMelee()
+    if ab.Heavy && opts.Stationary {
+        ms = append(ms, Modifier{Stage: StageHit, Value: 1, Source: "Heavy (remained stationary)"})
+    }
+    if ab.IndirectFire && opts.TargetHidden {
+        ms = append(ms, Modifier{Stage: StageHit, Value: -1, Source: "Indirect Fire (target not visible)"})
+    }
+    if ranged && hasUnitAbility(def.Abilities, "Stealth") {
+        ms = append(ms, Modifier{Stage: StageHit, Value: -1, Source: "Stealth"})
+    }
+    if ab.Lance && opts.Charged {
+        ms = append(ms, Modifier{Stage: StageWound, Value: 1, Source: "Lance (charged)"})
+    }
+    // Benefit of Cover: +1 to armour saves against ranged attacks, unless the weapon ignores it.
+    // It doesn't apply to models with a 3+ or better save against AP 0.
+    cover := ranged && (opts.Cover || (ab.IndirectFire && opts.TargetHidden))
+    if cover && !ab.IgnoresCover && !(def.Sv <= 3 && w.AP == 0) {
+        ms = append(ms, Modifier{Stage: StageSave, Value: 1, Source: "Benefit of Cover"})
+    }
+    return append(ms, opts.Modifiers...)
+}
@@ -0,0 +1,65 @@
+package engine
+
+import "testing"
+
+func TestModifiersNetCaps(t *testing.T) {
+    ms := Modifiers{
+        {Stage: StageHit, Value: 1, Source: "Heavy"},
+        {Stage: StageHit, Value: 1, Source: "Aura"},
+        {Stage: StageWound, Value: -1, Source: "Stealth"},
+        {Stage: StageWound, Value: -1, Source: "Debuff"},
+        {Stage: StageSave, Value: -2, Source: "Debuff"},
+        {Stage: StageSave, Value: 1, Source: "Cover"},
+    }
+    for _, c := range []struct {
+        stage Stage
+        want  int
+    }{{StageHit, 1}, {StageWound, -1}, {StageSave, -1}} {
+        if got := ms.Net(c.stage); got != c.want {
+            t.Errorf("Net(%s) = %d, want %d", c.stage, got, c.want)
+        }
+    }
+    if got, want := ms.Describe(StageHit), "Heavy +1, Aura +1 -> net +1 (capped from +2)"; got != want {
+        t.Errorf("Describe(hit) = %q, want %q", got, want)
+    }
+    if err := (Modifiers{{Stage: "charge", Value: 1}}).Validate(); err == nil {
+        t.Error("an unknown stage was accepted")
+    }
+    if err := (Modifiers{{Stage: StageHit, Source: "Nothing"}}).Validate(); err == nil {
+        t.Error("a zero modifier was accepted")
+    }
+}
+
+func TestShootingModifiers(t *testing.T) {
+    heavy := WeaponSnapshot{Name: "Heavy bolter", Type: "ranged", Attacks: "3", Skill: 4, Strength: 5, Damage: "1", Abilities: []string{"Heavy"}}
+    target := UnitSnapshot{T: 4, Sv: 4, W: 10}
+    // hit rolls 3, 3, 1: Heavy turns the 3s into hits, an unmodified 1 always misses
+    res, err := ResolveShootingWith(UnitSnapshot{}, target, heavy, ShootingOptions{Roller: NewScriptedRoller(3, 3, 1, 1, 1), Stationary: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Hits != 2 || res.Subphases.Hits.Modifier != 1 {
+        t.Errorf("stationary: %d hits with modifier %d, want 2 and +1", res.Hits, res.Subphases.Hits.Modifier)
+    }
+    // Stealth cancels Heavy
+    target.Abilities = []string{"Stealth"}
+    res, _ = ResolveShootingWith(UnitSnapshot{}, target, heavy, ShootingOptions{Roller: NewScriptedRoller(3, 3, 1, 1, 1), Stationary: true})
+    if res.Hits != 0 || res.Subphases.Hits.Modifier != 0 {
+        t.Errorf("stationary against Stealth: %d hits with modifier %d, want 0 and 0", res.Hits, res.Subphases.Hits.Modifier)
+    }
+}
+
+func TestCoverImprovesArmourSave(t *testing.T) {
+    w := WeaponSnapshot{Name: "Bolter", Type: "ranged", Attacks: "1", Skill: 3, Strength: 4, AP: -1, Damage: "1"}
+    target := UnitSnapshot{T: 4, Sv: 4, W: 10}
+    // hit 3, wound 4, save 4: fails against 5+, passes against 4+ in cover
+    for _, cover := range []bool{false, true} {
+        res, err := ResolveShootingWith(UnitSnapshot{}, target, w, ShootingOptions{Roller: NewScriptedRoller(3, 4, 4), Cover: cover})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if want := map[bool]int{false: 0, true: 1}[cover]; res.Saved != want {
+            t.Errorf("cover %v: %d saved, want %d", cover, res.Saved, want)
+        }
+    }
+}
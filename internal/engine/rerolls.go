@@ -0,0 +1,176 @@
+package engine
+
+import "fmt"
+
+// Roll stages that only re-rolls (not modifiers) apply to
+const (
+    StageAttacks Stage = "attacks"
+    StageDamage  Stage = "damage"
+    StageFNP     Stage = "fnp"
+)
+
+// RerollPolicy says which dice of a roll stage may be re-rolled
+type RerollPolicy string
+
+const (
+    RerollNone       RerollPolicy = ""
+    RerollOnes       RerollPolicy = "ones"        // re-roll unmodified 1s
+    RerollFailed     RerollPolicy = "failed"      // re-roll every failed die; not for attacks or damage, which can't fail
+    RerollSingle     RerollPolicy = "single"      // re-roll one failed die per volley (Command Re-roll)
+    RerollOnesSingle RerollPolicy = "ones+single" // "ones" plus a single re-roll for another failed die
+)
+
+// parts splits a policy into the part that applies to every die (ones or failed) and
+// whether it adds a single re-roll
+func (p RerollPolicy) parts() (RerollPolicy, bool) {
+    switch p {
+    case RerollSingle:
+        return RerollNone, true
+    case RerollOnesSingle:
+        return RerollOnes, true
+    }
+    return p, false
+}
+
+// strength orders the every-die parts so the more permissive one wins when sources overlap
+func (p RerollPolicy) strength() int {
+    switch p {
+    case RerollFailed:
+        return 2
+    case RerollOnes:
+        return 1
+    }
+    return 0
+}
+
+// stack combines two policies for the same stage. A single re-roll stacks with "ones";
+// "failed" already re-rolls every die a single re-roll could take, so it absorbs it.
+func (p RerollPolicy) stack(q RerollPolicy) RerollPolicy {
+    pb, ps := p.parts()
+    qb, qs := q.parts()
+    base := pb
+    if qb.strength() > pb.strength() { base = qb }
+    switch {
+    case !ps && !qs, base == RerollFailed:
+        return base
+    case base == RerollOnes:
+        return RerollOnesSingle
+    }
+    return RerollSingle
+}
+
+// Rerolls assigns a re-roll policy to each roll stage, e.g. {"hit": "ones", "wound": "failed"}
+type Rerolls map[Stage]RerollPolicy
+
+// Validate rejects unknown stages and policies. Attacks and Damage rolls have no target
+// to fail, so they only take "ones", "single" and "ones+single".
+func (rs Rerolls) Validate() error {
+    for st, p := range rs {
+        switch st {
+        case StageAttacks, StageHit, StageWound, StageSave, StageDamage, StageFNP:
+        default:
+            return fmt.Errorf("unknown re-roll stage %q (want attacks, hit, wound, save, damage or fnp)", st)
+        }
+        switch p {
+        case RerollNone, RerollOnes, RerollFailed, RerollSingle, RerollOnesSingle:
+        default:
+            return fmt.Errorf("unknown re-roll policy %q for %s (want ones, failed, single or ones+single)", p, st)
+        }
+        if p == RerollFailed && (st == StageAttacks || st == StageDamage) {
+            return fmt.Errorf("%s rolls can't fail, so they can't take a %q re-roll (want ones, single or ones+single)", st, p)
+        }
+    }
+    return nil
+}
+
+// Reroll records a die that was re-rolled; both values are kept for the UI
+type Reroll struct {
+    Index    int    `json:"index"` // 1-based position of the die within its stage
+    Original int    `json:"original"`
+    Result   int    `json:"result"`
+    Source   string `json:"source"`
+}
+
+// rerollStages lists the stages re-rolls apply to, in the order a volley rolls them
+var rerollStages = []Stage{StageAttacks, StageHit, StageWound, StageSave, StageDamage, StageFNP}
+
+// rerollPlan tracks the effective policy per stage for one volley
+type rerollPlan struct {
+    policy map[Stage]RerollPolicy // ones or failed
+    source map[Stage]string
+    single map[Stage]string // source of each stage's single re-roll
+    used   map[Stage]bool   // single re-rolls already spent
+}
+
+// newRerollPlan returns an empty plan; its maps are made on the first grant, so most
+// volleys (which have no re-rolls) don't allocate them
+func newRerollPlan() *rerollPlan { return &rerollPlan{} }
+
+// grant adds a policy for a stage. A single re-roll is kept alongside the stage's other
+// policy; otherwise the more permissive policy wins.
+func (p *rerollPlan) grant(stage Stage, policy RerollPolicy, source string) {
+    base, single := policy.parts()
+    if base == RerollNone && !single { return }
+    if p.policy == nil {
+        p.policy, p.source, p.single, p.used = map[Stage]RerollPolicy{}, map[Stage]string{}, map[Stage]string{}, map[Stage]bool{}
+    }
+    if base.strength() > p.policy[stage].strength() {
+        p.policy[stage] = base
+        p.source[stage] = source
+    }
+    if single && p.single[stage] == "" { p.single[stage] = source }
+}
+
+// volleyRerolls collects re-rolls granted by weapon abilities and the caller
+func volleyRerolls(ab WeaponAbilities, opts ShootingOptions) *rerollPlan {
+    p := newRerollPlan()
+    if ab.TwinLinked {
+        p.grant(StageWound, RerollFailed, "Twin-linked")
+    }
+    for st, pol := range opts.Rerolls {
+        base, single := pol.parts()
+        p.grant(st, base, "Re-roll")
+        if single { p.grant(st, RerollSingle, "Command Re-roll") }
+    }
+    return p
+}
+
+// allow reports whether a die may be re-rolled under the stage's policy. isOne means
+// the die shows its lowest result; failed means it didn't achieve what was needed.
+// The single re-roll is only spent on a failed die the other policy doesn't cover.
+func (p *rerollPlan) allow(stage Stage, isOne, failed bool) (bool, string) {
+    switch p.policy[stage] {
+    case RerollOnes:
+        if isOne { return true, p.source[stage] }
+    case RerollFailed:
+        if failed { return true, p.source[stage] }
+    }
+    if src := p.single[stage]; src != "" && failed && !p.used[stage] {
+        p.used[stage] = true
+        return true, src
+    }
+    return false, ""
+}
+
+// spent lists the stages whose single re-roll was used
+func (p *rerollPlan) spent() []Stage {
+    var out []Stage
+    for _, st := range rerollStages {
+        if p.used[st] { out = append(out, st) }
+    }
+    return out
+}
+
+// describe lists the active policies as events for the volley log
+func (p *rerollPlan) describe() []Event {
+    var out []Event
+    for _, st := range rerollStages {
+        if pol := p.policy[st]; pol != RerollNone {
+            out = append(out, Event{Kind: EventAbility, Stage: st, Name: p.source[st], Ability: p.source[st], Params: []string{string(pol)}, Effect: fmt.Sprintf("re-rolls for %s: %s", st, pol)})
+        }
+        if src := p.single[st]; src != "" {
+            out = append(out, Event{Kind: EventAbility, Stage: st, Name: src, Ability: src, Params: []string{string(RerollSingle)}, Effect: fmt.Sprintf("re-rolls for %s: %s", st, RerollSingle)})
+        }
+    }
+    return out
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestRerollPolicies(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "3", Skill: 4, Strength: 4, Damage: "1"}
+    target := UnitSnapshot{T: 4, Sv: 7, W: 10}
+    cases := []struct {
+        policy RerollPolicy
+        rolls  []int // hit rolls, each re-roll straight after its die, then wound rolls
+        hits   int
+        want   []Reroll
+    }{
+        // 1 and 2 fail; only the 1 is re-rolled
+        {RerollOnes, []int{1, 6, 2, 5, 1, 1}, 2, []Reroll{{Index: 1, Original: 1, Result: 6, Source: "Re-roll"}}},
+        // both failures are re-rolled
+        {RerollFailed, []int{1, 6, 2, 4, 5, 1, 1, 1}, 3, []Reroll{{Index: 1, Original: 1, Result: 6, Source: "Re-roll"}, {Index: 2, Original: 2, Result: 4, Source: "Re-roll"}}},
+        // only the first failure is re-rolled
+        {RerollSingle, []int{1, 6, 2, 5, 1, 1}, 2, []Reroll{{Index: 1, Original: 1, Result: 6, Source: "Command Re-roll"}}},
+        // the 1 is re-rolled for free and the single re-roll goes to the 2
+        {RerollOnesSingle, []int{1, 6, 2, 4, 5, 1, 1, 1}, 3, []Reroll{{Index: 1, Original: 1, Result: 6, Source: "Re-roll"}, {Index: 2, Original: 2, Result: 4, Source: "Command Re-roll"}}},
+    }
+    for _, c := range cases {
+        res, err := ResolveShootingWith(UnitSnapshot{}, target, w, ShootingOptions{Roller: NewScriptedRoller(c.rolls...), Rerolls: Rerolls{StageHit: c.policy}})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Hits != c.hits || !reflect.DeepEqual(res.Subphases.Hits.Rerolls, c.want) {
+            t.Errorf("%s: %d hits, re-rolls %+v; want %d, %+v", c.policy, res.Hits, res.Subphases.Hits.Rerolls, c.hits, c.want)
+        }
+        if _, single := c.policy.parts(); single != reflect.DeepEqual(res.SingleRerolls, []Stage{StageHit}) {
+            t.Errorf("%s: single re-rolls used %v", c.policy, res.SingleRerolls)
+        }
+    }
+}
+
+func TestSingleRerollOnlySpentWhenUsed(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "2", Skill: 4, Strength: 4, Damage: "1"}
+    target := UnitSnapshot{T: 4, Sv: 7, W: 10}
+    cases := []struct {
+        rerolls Rerolls
+        rolls   []int // hit rolls, then wound rolls
+        want    []Stage
+    }{
+        // both hits land, so there is nothing to re-roll
+        {Rerolls{StageHit: RerollSingle}, []int{4, 5, 1, 1}, nil},
+        // "ones" covers the only failure
+        {Rerolls{StageHit: RerollOnesSingle}, []int{1, 5, 4, 1, 1}, nil},
+        // "failed" absorbs the single re-roll when merged
+        {MergeRerolls(Rerolls{StageHit: RerollSingle}, Rerolls{StageHit: RerollFailed}), []int{2, 3, 5, 4, 1, 1}, nil},
+        {Rerolls{StageHit: RerollSingle}, []int{2, 4, 5, 1, 1}, []Stage{StageHit}},
+    }
+    for _, c := range cases {
+        res, err := ResolveShootingWith(UnitSnapshot{}, target, w, ShootingOptions{Roller: NewScriptedRoller(c.rolls...), Rerolls: c.rerolls})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(res.SingleRerolls, c.want) {
+            t.Errorf("%v with %v: single re-rolls used %v, want %v", c.rerolls, c.rolls, res.SingleRerolls, c.want)
+        }
+    }
+}
+
+func TestTwinLinkedRerollsFailedWounds(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "1", Skill: 4, Strength: 4, Damage: "1", Abilities: []string{"Twin-linked"}}
+    // hit 4, wound 2 re-rolled into 5, no save
+    res, err := ResolveShootingWith(UnitSnapshot{}, UnitSnapshot{T: 4, Sv: 7, W: 10}, w, ShootingOptions{Roller: NewScriptedRoller(4, 2, 5)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Reroll{{Index: 1, Original: 2, Result: 5, Source: "Twin-linked"}}
+    if res.Wounds != 1 || !reflect.DeepEqual(res.Subphases.Wounds.Rerolls, want) {
+        t.Errorf("%d wounds, re-rolls %+v; want 1, %+v", res.Wounds, res.Subphases.Wounds.Rerolls, want)
+    }
+}
+
+func TestRerollsValidate(t *testing.T) {
+    if err := (Rerolls{"charge": RerollOnes}).Validate(); err == nil {
+        t.Error("an unknown stage was accepted")
+    }
+    if err := (Rerolls{StageHit: "sixes"}).Validate(); err == nil {
+        t.Error("an unknown policy was accepted")
+    }
+    if err := (Rerolls{StageFNP: RerollOnes, StageAttacks: RerollSingle, StageDamage: RerollOnesSingle}).Validate(); err != nil {
+        t.Error(err)
+    }
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Ruleset is the core rules the resolver consults: the wound chart, how the save is
+// picked and what weapon abilities mean. Other editions and house rules implement it.
+type Ruleset interface {
+    Name() string
+    // WoundTarget is the D6 result needed to wound; above 6 means S can't wound T at all
+    WoundTarget(s, t int) int
+    // SaveTargets returns the modified armour save (7 = no save), the target actually
+    // rolled against and whether that is the invulnerable save
+    SaveTargets(def UnitSnapshot, w WeaponSnapshot, saveMod int) (int, int, bool)
+    // WeaponAbilities interprets a weapon's ability strings
+    WeaponAbilities(src ...string) WeaponAbilities
+}
+
+// Tenth is 10th edition, the default ruleset
+type Tenth struct{}
+
+func (Tenth) Name() string             { return "10th" }
+func (Tenth) WoundTarget(s, t int) int { return woundTarget(s, t) }
+func (Tenth) WeaponAbilities(src ...string) WeaponAbilities { return ParseWeaponAbilities(src...) }
+func (Tenth) SaveTargets(def UnitSnapshot, w WeaponSnapshot, saveMod int) (int, int, bool) {
+    return saveTargets(def, w, saveMod)
+}
+
+// ClassicWoundChart is 10th edition with the wound chart of earlier editions, which
+// compares S to T by difference: S equal to T wounds on a 4+, each point above or below
+// moves it by one (2+ at best), and S three or more below T can't wound
+type ClassicWoundChart struct{ Tenth }
+
+func (ClassicWoundChart) Name() string { return "classic-wound-chart" }
+
+func (ClassicWoundChart) WoundTarget(s, t int) int {
+    tn := 4 - (s - t)
+    if tn < 2 { tn = 2 }
+    return tn
+}
+
+// HouseRules adjusts a base ruleset with house-rule toggles
+type HouseRules struct {
+    Base  Ruleset // nil means Tenth
+    Label string
+    // Invulnerable saves can't be better than this (e.g. 4 for a 4+ cap); 0 for no cap
+    InvulnerableCap int
+    // Weapon abilities the table ignores, by name (e.g. "Devastating Wounds")
+    Disabled []string
+}
+
+func (h HouseRules) base() Ruleset {
+    if h.Base == nil { return Tenth{} }
+    return h.Base
+}
+
+func (h HouseRules) Name() string             { return h.Label }
+func (h HouseRules) WoundTarget(s, t int) int { return h.base().WoundTarget(s, t) }
+
+func (h HouseRules) SaveTargets(def UnitSnapshot, w WeaponSnapshot, saveMod int) (int, int, bool) {
+    if h.InvulnerableCap > 0 && def.InvSv > 0 && def.InvSv < h.InvulnerableCap {
+        def.InvSv = h.InvulnerableCap
+    }
+    return h.base().SaveTargets(def, w, saveMod)
+}
+
+func (h HouseRules) WeaponAbilities(src ...string) WeaponAbilities {
+    ab := h.base().WeaponAbilities(src...)
+    if len(h.Disabled) == 0 { return ab }
+    var keep []string
+    for _, tok := range ab.Tokens() {
+        if !h.disabled(tok) { keep = append(keep, tok) }
+    }
+    out := h.base().WeaponAbilities(keep...)
+    out.Unknown = ab.Unknown
+    return out
+}
+
+// disabled reports whether a canonical ability token is switched off, e.g. "Sustained
+// Hits 1" is when "Sustained Hits" is
+func (h HouseRules) disabled(tok string) bool {
+    lt := strings.ToLower(tok)
+    for _, d := range h.Disabled {
+        if d = strings.ToLower(strings.TrimSpace(d)); d != "" && strings.HasPrefix(lt, d) { return true }
+    }
+    return false
+}
+
+// DefaultRuleset is used wherever no ruleset is chosen
+var DefaultRuleset Ruleset = Tenth{}
+
+var rulesets = map[string]Ruleset{}
+
+func init() {
+    RegisterRuleset(Tenth{})
+    RegisterRuleset(ClassicWoundChart{})
+    RegisterRuleset(HouseRules{Label: "house-invuln-cap-4", InvulnerableCap: 4})
+    RegisterRuleset(HouseRules{Label: "house-no-devastating-wounds", Disabled: []string{"Devastating Wounds"}})
+}
+
+// RegisterRuleset makes a ruleset selectable by name, replacing any with the same name
+func RegisterRuleset(r Ruleset) {
+    rulesets[strings.ToLower(r.Name())] = r
+}
+
+// RulesetByName looks up a registered ruleset; an empty name is the default
+func RulesetByName(name string) (Ruleset, error) {
+    name = strings.ToLower(strings.TrimSpace(name))
+    if name == "" { return DefaultRuleset, nil }
+    if r, ok := rulesets[name]; ok { return r, nil }
+    return nil, fmt.Errorf("unknown ruleset %q (want one of %s)", name, strings.Join(RulesetNames(), ", "))
+}
+
+// RulesetNames lists the registered rulesets, sorted
+func RulesetNames() []string {
+    out := make([]string, 0, len(rulesets))
+    for _, r := range rulesets {
+        out = append(out, r.Name())
+    }
+    sort.Strings(out)
+    return out
+}
+
+// rulesOrDefault returns r, or the default ruleset when r is nil
+func rulesOrDefault(r Ruleset) Ruleset {
+    if r == nil { return DefaultRuleset }
+    return r
+}
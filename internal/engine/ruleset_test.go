@@ -0,0 +1,78 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestRulesetByName(t *testing.T) {
+    for _, c := range []struct{ name, want string }{
+        {"", "10th"},
+        {"10TH", "10th"},
+        {" classic-wound-chart ", "classic-wound-chart"},
+        {"house-invuln-cap-4", "house-invuln-cap-4"},
+    } {
+        r, err := RulesetByName(c.name)
+        if err != nil || r.Name() != c.want {
+            t.Errorf("RulesetByName(%q) = %v, %v; want %s", c.name, r, err, c.want)
+        }
+    }
+    if _, err := RulesetByName("9th"); err == nil {
+        t.Error("an unknown ruleset was accepted")
+    }
+    want := []string{"10th", "classic-wound-chart", "house-invuln-cap-4", "house-no-devastating-wounds"}
+    if got := RulesetNames(); !reflect.DeepEqual(got, want) {
+        t.Errorf("RulesetNames() = %v, want %v", got, want)
+    }
+}
+
+func TestWoundCharts(t *testing.T) {
+    for _, c := range []struct{ s, t, tenth, classic int }{
+        {4, 4, 4, 4},
+        {8, 4, 2, 2},
+        {5, 4, 3, 3},
+        {6, 4, 3, 2},
+        {3, 4, 5, 5},
+        {2, 4, 6, 6},
+        {1, 4, 6, 7},
+    } {
+        if got := (Tenth{}).WoundTarget(c.s, c.t); got != c.tenth {
+            t.Errorf("10th S%d vs T%d: %d+, want %d+", c.s, c.t, got, c.tenth)
+        }
+        if got := (ClassicWoundChart{}).WoundTarget(c.s, c.t); got != c.classic {
+            t.Errorf("classic S%d vs T%d: %d+, want %d+", c.s, c.t, got, c.classic)
+        }
+    }
+}
+
+func TestRulesetInShooting(t *testing.T) {
+    w := WeaponSnapshot{Name: "Lascannon", Type: "ranged", Attacks: "1", Skill: 3, Strength: 12, AP: -3, Damage: "1", Abilities: []string{"Devastating Wounds"}}
+    def := UnitSnapshot{Name: "Daemon", T: 4, Sv: 3, InvSv: 2, W: 10}
+    cases := []struct {
+        rules          Ruleset
+        rolls          []int
+        saved, mortals int
+    }{
+        // hit 3, wound 6 (critical): Devastating Wounds skips the save
+        {nil, []int{3, 6}, 0, 1},
+        {namedRuleset("house-no-devastating-wounds"), []int{3, 6, 2}, 1, 0},
+        // hit 3, wound 2, save 3: the 2+ invulnerable save is capped to a 4+
+        {Tenth{}, []int{3, 2, 3}, 1, 0},
+        {namedRuleset("house-invuln-cap-4"), []int{3, 2, 3}, 0, 0},
+    }
+    for i, c := range cases {
+        res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(c.rolls...), Ruleset: c.rules})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Saved != c.saved || res.MortalWounds != c.mortals {
+            t.Errorf("case %d: saved %d mortals %d, want %d %d", i, res.Saved, res.MortalWounds, c.saved, c.mortals)
+        }
+    }
+}
+
+// namedRuleset looks up a ruleset the engine registers at init
+func namedRuleset(name string) Ruleset {
+    r, _ := RulesetByName(name)
+    return r
+}
@@ -6,6 +6,69 @@ import (
 	"strings"
 )
 
+// CheckRange rejects a ranged volley at a target beyond the weapon's range.
+// A zero distance or a weapon without a known range is never out of range.
+func CheckRange(w WeaponSnapshot, distance int) error {
+    if distance < 0 {
+        return fmt.Errorf("distance must not be negative (got %d)", distance)
+    }
+    if distance == 0 || w.IsMelee() || w.Range <= 0 {
+        return nil
+    }
+    if distance > w.Range {
+        return fmt.Errorf("target at %d\" is out of range for %s (range %d\")", distance, w.Name, w.Range)
+    }
+    return nil
+}
+
+// feelNoPain returns the best Feel No Pain threshold among the abilities and its source, or 0
+func feelNoPain(abilities []string) (int, string) {
+    fnpTN := 0
+    fnpSrc := ""
+    for _, a := range abilities {
+        al := strings.ToLower(strings.TrimSpace(a))
+        if strings.HasPrefix(al, "feel no pain") || strings.HasPrefix(al, "fnp") {
+            // find an X+ token
+            fields := strings.Fields(al)
+            for _, f := range fields {
+                f = strings.TrimSpace(f)
+                if len(f) >= 2 && f[len(f)-1] == '+' {
+                    if n, err := strconv.Atoi(strings.Trim(f[:len(f)-1], "+ ")) ; err == nil {
+                        if n >= 2 && n <= 6 {
+                            if fnpTN == 0 || n < fnpTN { fnpTN = n; fnpSrc = a }
+                        }
+                    }
+                }
+            }
+        }
+    }
+    return fnpTN, fnpSrc
+}
+
+// saveTargets returns the modified armour save (7 = no save), the target actually
+// rolled against and whether that is the invulnerable save
+func saveTargets(def UnitSnapshot, w WeaponSnapshot, saveMod int) (int, int, bool) {
+    effSave := def.Sv - w.AP - saveMod
+    if effSave < 2 { effSave = 2 }
+    if effSave > 6 { effSave = 7 }
+    if def.InvSv > 0 && def.InvSv < effSave { return effSave, def.InvSv, true }
+    return effSave, effSave, false
+}
+
+// rollPasses applies the hit/wound roll rules: an unmodified 1 always fails, an
+// unmodified 6 always succeeds, otherwise the modified roll must reach the target
+func rollPasses(roll, mod, target int) bool {
+    if roll == 1 { return false }
+    if roll == 6 { return true }
+    return roll+mod >= target
+}
+
+// rollStr renders a die for the log, showing the modifier when there is one ("3+1=4")
+func rollStr(roll, mod int) string {
+    if mod == 0 { return fmt.Sprintf("%d", roll) }
+    return fmt.Sprintf("%d%+d=%d", roll, mod, roll+mod)
+}
+
 func woundTarget(S, T int) int {
     // Returns target roll (2-6) needed to wound
     switch {
@@ -22,273 +85,463 @@ func woundTarget(S, T int) int {
     }
 }
 
-func bestSaveThreshold(sv, inv int, ap int) int {
-    // sv is 2..6 where 2 means 2+, inv 0 if none; ap negative makes saves worse
-    eff := sv - ap // ap e.g., -1 -> 3+ becomes 2 worse? We assume AP is negative numbers in data, so subtracting yields harder save
-    if eff < 2 { eff = 2 }
-    if eff > 6 { eff = 7 } // 7 means no save
-    if inv > 0 && inv < eff {
-        eff = inv
-    }
-    return eff
+// ShootingOptions carries the per-volley inputs that aren't part of the unit or weapon snapshots
+type ShootingOptions struct {
+    Roller   Roller // dice source; nil means a fresh time-seeded roller
+    Distance int    // distance to the target in inches; 0 skips range checks and half-range rules
+    // Situational flags that switch on ability modifiers
+    Stationary   bool // attacker Remained Stationary (Heavy)
+    Charged      bool // attacker made a Charge move this turn (Lance)
+    TargetHidden bool // no target models visible (Indirect Fire)
+    Cover        bool // target has the Benefit of Cover
+    // Extra caller-supplied modifiers (buffs/debuffs), stacked with the ones abilities grant
+    Modifiers Modifiers
+    // Re-roll policy per roll stage, combined with re-rolls abilities grant (e.g. Twin-linked)
+    Rerolls Rerolls
+    // Critical hit / wound on an unmodified X+ (e.g. 5); 0 leaves it to abilities, default 6
+    CritHit   int
+    CritWound int
+    // Fire Overwatch: the attacks only hit on an unmodified 6
+    Overwatch bool
+    // Quiet skips the events, logs and per-die roll lists, for simulations that only need
+    // the totals
+    Quiet bool
+    // Ruleset for the wound chart, saves and ability semantics; nil means DefaultRuleset
+    Ruleset Ruleset
 }
 
-// ResolveShooting executes a single weapon volley from attacker to defender and logs steps
-func ResolveShooting(att UnitSnapshot, def UnitSnapshot, w WeaponSnapshot) ShootingResult {
-    logs := []string{}
-    rng := newRNG()
-    sp := &ShootingSubphases{}
-
-    // Normalize ability flags
-    has := func(key string) bool {
-        key = strings.ToLower(strings.TrimSpace(key))
-        for _, a := range w.Abilities {
-            if strings.Contains(strings.ToLower(a), key) { return true }
+// validate checks the options against the weapon: range, modifiers, re-rolls and crit thresholds
+func (opts ShootingOptions) validate(w WeaponSnapshot) error {
+    if err := w.Validate(); err != nil {
+        return err
+    }
+    if err := CheckRange(w, opts.Distance); err != nil {
+        return err
+    }
+    if err := opts.Modifiers.Validate(); err != nil {
+        return err
+    }
+    if err := opts.Rerolls.Validate(); err != nil {
+        return err
+    }
+    for _, tn := range []int{opts.CritHit, opts.CritWound} {
+        if tn != 0 && (tn < 2 || tn > 6) {
+            return fmt.Errorf("critical threshold %d+ out of range (want 2-6)", tn)
         }
-        // also infer from weapon name/desc tokens if needed (not available here)
-        return false
     }
+    return nil
+}
+
+// halfRange reports whether a ranged weapon's target is within half its range
+func (opts ShootingOptions) halfRange(w WeaponSnapshot) bool {
+    return opts.Distance > 0 && !w.IsMelee() && w.Range > 0 && opts.Distance*2 <= w.Range
+}
+
+// ResolveShooting executes a single weapon volley from attacker to defender and logs steps.
+// It returns an error when the weapon's Attacks or Damage isn't a valid dice expression.
+func ResolveShooting(att UnitSnapshot, def UnitSnapshot, w WeaponSnapshot) (ShootingResult, error) {
+    return ResolveShootingWith(att, def, w, ShootingOptions{})
+}
+
+// ResolveShootingWith is ResolveShooting with explicit per-volley options (dice source, distance).
+// It returns an error when the weapon or options are invalid or the target is out of range.
+func ResolveShootingWith(att UnitSnapshot, def UnitSnapshot, w WeaponSnapshot, opts ShootingOptions) (ShootingResult, error) {
+    if err := opts.validate(w); err != nil {
+        return ShootingResult{}, err
+    }
+    ev := &eventLog{quiet: opts.Quiet}
+    rng := opts.Roller
+    if rng == nil { rng = newRNG() }
+    var seed int64
+    if sd, ok := rng.(Seeder); ok {
+        seed = sd.Seed()
+        ev.add(Event{Kind: EventSeed, Seed: seed})
+    }
+    sp := &ShootingSubphases{}
+    rules := rulesOrDefault(opts.Ruleset)
+
+    // Parse abilities into their typed form once; unknown tokens are reported, not guessed at
+    ab := rules.WeaponAbilities(w.Abilities...)
     // Record abilities summary upfront
-    if len(w.Abilities) > 0 {
-        logs = append(logs, fmt.Sprintf("Weapon Abilities: [%s]", strings.Join(w.Abilities, ", ")))
+    if len(w.Abilities) > 0 && !ev.quiet {
+        ev.add(note(EventNote, "Weapon Abilities: [%s]", strings.Join(ab.Tokens(), ", ")))
+    }
+    if len(ab.Unknown) > 0 && !ev.quiet {
+        ev.add(note(EventNote, "Unrecognized weapon abilities ignored: [%s]", strings.Join(ab.Unknown, ", ")))
     }
 
-    torrent := has("torrent") // auto-hits
-    sustainedHits := 0 // e.g., Sustained Hits X (X can be 1..6)
-    for _, a := range w.Abilities {
-        al := strings.ToLower(strings.TrimSpace(a))
-        if strings.HasPrefix(al, "sustained hits") {
-            // Extract number after label
-            parts := strings.Fields(al)
-            n := 0
-            for _, p := range parts {
-                if v, err := strconv.Atoi(strings.Trim(p, "+")); err == nil { n = v; break }
-            }
-            if n <= 0 { n = 1 }
-            if n > 6 { n = 6 }
-            sustainedHits = n
+    torrent := ab.Torrent // auto-hits
+    sustainedHits := ab.SustainedHits // Sustained Hits X, X may be a dice expression
+    lethalHits := ab.LethalHits // critical hits auto-wound
+    twinLinked := ab.TwinLinked // re-roll failed wounds, via the re-roll plan
+    devastating := ab.DevastatingWounds // crit wounds become mortal wounds
+    critHit, critWound := volleyCriticals(att, def, ab, opts)
+    if opts.Overwatch { critHit = critThreshold{TN: 6} }
+
+    if !ev.quiet {
+        if torrent { ev.add(active("Torrent", "attacks automatically hit")) }
+        if sustainedHits != "" { ev.add(active("Sustained Hits "+sustainedHits, "each critical hit adds +%s hit(s)", sustainedHits).withAbility("Sustained Hits", sustainedHits)) }
+        if lethalHits {
+            e := active("Lethal Hits", "critical hit (%s) converts to auto-wound", critHit.label())
+            e.Stage, e.Target = StageHit, critHit.TN
+            ev.add(e)
+        }
+        if twinLinked { ev.add(active("Twin-linked", "re-roll failed wound rolls once")) }
+        if devastating {
+            e := active("Devastating Wounds", "critical wound (%s) skips saves and inflicts mortal wounds equal to Damage", critWound.label())
+            e.Stage, e.Target = StageWound, critWound.TN
+            ev.add(e)
         }
+        for _, c := range []struct {
+            st   Stage
+            crit critThreshold
+        }{{StageHit, critHit}, {StageWound, critWound}} {
+            if c.crit.TN >= 6 { continue }
+            e := ability(c.crit.Source, "critical %ss on %s", c.st, c.crit.label()).withAbility(c.crit.Ability, c.crit.Params...)
+            e.Stage, e.Target = c.st, c.crit.TN
+            ev.add(e)
+        }
+    }
+
+    // Re-rolls: each die can be re-rolled at most once; both values are kept in the subphases
+    rr := volleyRerolls(ab, opts)
+    if !ev.quiet { ev.add(rr.describe()...) }
+    // rerollD6 re-rolls a single D6 when the stage's policy allows it
+    rerollD6 := func(stage Stage, idx, roll int, failed bool, rec *[]Reroll) int {
+        ok, src := rr.allow(stage, roll == 1, failed)
+        if !ok { return roll }
+        r2 := rng.Roll(6)
+        *rec = append(*rec, Reroll{Index: idx, Original: roll, Result: r2, Source: src})
+        ev.add(Event{Kind: EventReroll, Stage: stage, Index: idx, Roll: roll, Value: r2, Name: src})
+        return r2
+    }
+    // rerollExpr re-rolls a dice expression result (attacks, damage): "ones" re-rolls
+    // the lowest possible result and "single" the first below-average one
+    rerollExpr := func(stage Stage, idx int, d DiceExpr, val int, rec *[]Reroll) int {
+        if !d.Random() { return val }
+        ok, src := rr.allow(stage, val == d.Min(), float64(val) < d.Mean())
+        if !ok { return val }
+        v2 := d.Roll(rng)
+        *rec = append(*rec, Reroll{Index: idx, Original: val, Result: v2, Source: src})
+        ev.add(Event{Kind: EventReroll, Stage: stage, Index: idx, Roll: val, Value: v2, Name: src})
+        return v2
     }
-    lethalHits := has("lethal hits") // crit 6s to wound become auto-wounds? In 10th, crit 6s to hit auto-wound. We'll apply on hits.
-    twinLinked := has("twin-linked") // re-roll wounds
-    devastating := has("devastating wounds") // 6s to wound spill mortals (we'll treat as max damage)
 
-    if torrent { logs = append(logs, "Torrent active: attacks automatically hit") }
-    if sustainedHits > 0 { logs = append(logs, fmt.Sprintf("Sustained Hits %d active: each critical hit adds +%d hit(s)", sustainedHits, sustainedHits)) }
-    if lethalHits { logs = append(logs, "Lethal Hits active: critical hit (6) converts to auto-wound") }
-    if twinLinked { logs = append(logs, "Twin-linked active: re-roll failed wound rolls once") }
-    if devastating { logs = append(logs, "Devastating Wounds active: critical wound (6) converts to maximum damage") }
+    // Range: half-range bonuses only apply when a distance was given for a ranged weapon
+    halfRange := opts.halfRange(w)
+    if opts.Distance > 0 && !w.IsMelee() && w.Range > 0 {
+        rg := Event{Kind: EventRange, Value: opts.Distance, Target: w.Range}
+        if halfRange { rg.Outcome = OutcomeHalf }
+        ev.add(rg)
+    }
 
     // Attacks
-    attacks := rollExpr(rng, w.Attacks)
+    attackDice, damageDice := MustParseDice(w.Attacks), MustParseDice(w.Damage)
+    attacks := attackDice.Roll(rng)
+    attacks = rerollExpr(StageAttacks, 1, attackDice, attacks, &sp.Attacks.Rerolls)
+    ev.add(Event{Kind: EventAttacks, Expr: strings.TrimSpace(w.Attacks), Value: attacks})
+    if halfRange && ab.RapidFire != "" {
+        extra := rollExpr(rng, ab.RapidFire)
+        attacks += extra
+        if !ev.quiet {
+            e := ability("Rapid Fire "+ab.RapidFire, "+%d attack(s) at half range -> %d", extra, attacks).withAbility("Rapid Fire", ab.RapidFire)
+            e.Value = extra
+            ev.add(e)
+        }
+    }
     sp.Attacks.Count = attacks
-    logs = append(logs, fmt.Sprintf("Attacks A=%s -> %d", strings.TrimSpace(w.Attacks), attacks))
+
+    // Modifiers: source-tagged, summed and capped per stage
+    mods := volleyModifiers(att, def, w, ab, opts)
+    hitMod, woundMod, saveMod := mods.Net(StageHit), mods.Net(StageWound), mods.Net(StageSave)
+    for _, st := range []Stage{StageHit, StageWound, StageSave} {
+        if len(mods.For(st)) > 0 && !ev.quiet {
+            ev.add(Event{Kind: EventModifiers, Stage: st, Modifier: mods.Net(st), Effect: mods.Describe(st)})
+        }
+    }
 
     // Hits
-    sp.Hits.Target = w.Skill
-    logs = append(logs, fmt.Sprintf("To Hit: needs %d+", w.Skill))
+    skill := w.Skill
+    if opts.Overwatch {
+        // only an unmodified 6 hits, so modifiers don't matter
+        skill, hitMod = 6, 0
+        if !ev.quiet {
+            e := ability("Fire Overwatch", "attacks only hit on an unmodified 6")
+            e.Stage, e.Target = StageHit, 6
+            ev.add(e)
+        }
+    }
+    sp.Hits.Target = skill
+    sp.Hits.Modifier = hitMod
+    sp.Hits.CritTarget = critHit.TN
+    ev.add(Event{Kind: EventTarget, Stage: StageHit, Target: skill})
     hits := 0
-    critAutoWounds := 0 // from lethal hits (6s to hit)
+    critAutoWounds := 0 // from lethal hits (critical hits)
     for i := 0; i < attacks; i++ {
         var roll int
         if torrent {
             roll = 6 // treat as auto-hit; log as such
-            sp.Hits.Rolls = append(sp.Hits.Rolls, roll)
+            if !ev.quiet { sp.Hits.Rolls = append(sp.Hits.Rolls, roll) }
             hits++
-            logs = append(logs, fmt.Sprintf("Hit (Torrent) %d: auto-hit", i+1))
+            ev.add(Event{Kind: EventHitRoll, Index: i + 1, Outcome: OutcomeAuto, Name: "Torrent"})
         } else {
-            roll = 1 + rng.Intn(6)
-            sp.Hits.Rolls = append(sp.Hits.Rolls, roll)
-        if roll >= w.Skill && roll != 1 {
+            roll = rng.Roll(6)
+            roll = rerollD6(StageHit, i+1, roll, !critHit.isCrit(roll) && !rollPasses(roll, hitMod, skill), &sp.Hits.Rerolls)
+            if !ev.quiet { sp.Hits.Rolls = append(sp.Hits.Rolls, roll) }
+            // a critical hit always hits, whatever the modifiers
+            crit := critHit.isCrit(roll)
+            if crit || rollPasses(roll, hitMod, skill) {
                 hits++
-                logs = append(logs, fmt.Sprintf("Hit roll %d: %d -> HIT (needs %d+)", i+1, roll, w.Skill))
-                if lethalHits && roll == 6 {
+                outcome := OutcomeHit
+                if crit {
+                    sp.Hits.Critical++
+                    outcome = OutcomeCritical
+                }
+                ev.add(Event{Kind: EventHitRoll, Index: i + 1, Roll: roll, Modifier: hitMod, Target: skill, Outcome: outcome})
+                if lethalHits && crit {
                     critAutoWounds++
-            logs = append(logs, "Lethal Hits: critical hit converts to auto-wound")
+                    if !ev.quiet {
+                        e := ability("Lethal Hits", "critical hit converts to auto-wound")
+                        e.Index = i + 1
+                        ev.add(e)
+                    }
                 }
-                if sustainedHits > 0 && roll == 6 {
-                    hits += sustainedHits // add extra hits
-            logs = append(logs, fmt.Sprintf("Sustained Hits: +%d additional hit(s)", sustainedHits))
+                if sustainedHits != "" && crit {
+                    extra := rollExpr(rng, sustainedHits)
+                    hits += extra // add extra hits
+                    if !ev.quiet {
+                        e := ability("Sustained Hits", "+%d additional hit(s)", extra).withAbility("Sustained Hits", sustainedHits)
+                        e.Index, e.Value = i+1, extra
+                        ev.add(e)
+                    }
                 }
             } else {
-                logs = append(logs, fmt.Sprintf("Hit roll %d: %d -> MISS (needs %d+)", i+1, roll, w.Skill))
+                ev.add(Event{Kind: EventHitRoll, Index: i + 1, Roll: roll, Modifier: hitMod, Target: skill, Outcome: OutcomeMiss})
             }
         }
     }
     sp.Hits.Success = hits
-    logs = append(logs, fmt.Sprintf("Hits total: %d", hits))
+    ev.add(Event{Kind: EventTotal, Stage: StageHit, Value: hits})
 
     // Wounds
-    woundTN := woundTarget(w.Strength, def.T)
-    logs = append(logs, fmt.Sprintf("To Wound base: S %d vs T %d -> needs %d+", w.Strength, def.T, woundTN))
-    // Anti- keywords override wound threshold when matching defender keywords
-    antiTN := 0
-    antiKW := ""
-    antiMatchedDefKW := ""
-    for _, a := range w.Abilities {
-        al := strings.ToLower(a)
-        if strings.HasPrefix(al, "anti-") {
-            // Parse e.g., "Anti-Infantry 4+"
-            // Extract keyword and TN
-            kw := ""
-            tn := 0
-            parts := strings.SplitN(strings.TrimPrefix(al, "anti-"), " ", 2)
-            if len(parts) == 2 {
-                kw = strings.TrimSpace(parts[0])
-                s := strings.TrimSpace(parts[1])
-                // s like "4+" or "5+"
-                if len(s) >= 2 && s[len(s)-1] == '+' {
-                    if n, err := strconv.Atoi(strings.TrimSpace(s[:len(s)-1])); err == nil { tn = n }
-                }
-            }
-            if kw != "" && tn >= 2 && tn <= 6 {
-                // if defender has matching keyword (case-insensitive substring match)
-                for _, dk := range def.Keywords {
-                    if strings.Contains(strings.ToLower(dk), kw) {
-                        if antiTN == 0 || tn < antiTN {
-                            antiTN = tn
-                            antiKW = kw
-                            antiMatchedDefKW = dk
-                        }
-                        break
-                    }
-                }
-            }
-        }
-    }
-    if antiTN > 0 && antiTN < woundTN {
-        logs = append(logs, fmt.Sprintf("Anti-%s %d+ applies (defender has '%s'): override wound target to %d+", antiKW, antiTN, antiMatchedDefKW, antiTN))
-        woundTN = antiTN
-    }
+    woundTN := rules.WoundTarget(w.Strength, def.T)
+    canWound := woundTN <= 6
+    ev.add(Event{Kind: EventTarget, Stage: StageWound, Target: woundTN, Strength: w.Strength, Toughness: def.T})
     sp.Wounds.Target = woundTN
+    sp.Wounds.Modifier = woundMod
+    sp.Wounds.CritTarget = critWound.TN
     wounds := 0
+    critWounds := 0 // unmodified critical wound rolls (Lethal Hits auto-wounds are not critical)
     attempts := hits
     // auto-wounds from lethal hits add without rolling
     if critAutoWounds > 0 {
         wounds += critAutoWounds
         attempts -= critAutoWounds
-        logs = append(logs, fmt.Sprintf("Lethal Hits auto-wounds added: +%d", critAutoWounds))
+        if !ev.quiet {
+            e := ability("Lethal Hits", "+%d auto-wound(s)", critAutoWounds)
+            e.Stage, e.Value = StageWound, critAutoWounds
+            ev.add(e)
+        }
     }
     for i := 0; i < attempts; i++ {
-        roll := 1 + rng.Intn(6)
-        var passes bool
-        if roll >= woundTN && roll != 1 { passes = true }
-        if !passes && twinLinked {
-            // twin-linked: re-roll failed wound once
-            r2 := 1 + rng.Intn(6)
-            logs = append(logs, fmt.Sprintf("Twin-linked re-roll: %d -> %d (needs %d+)", roll, r2, woundTN))
-            roll = r2
-            if roll >= woundTN && roll != 1 { passes = true }
-        }
-        sp.Wounds.Rolls = append(sp.Wounds.Rolls, roll)
-        if passes {
+        roll := rng.Roll(6)
+        roll = rerollD6(StageWound, i+1, roll, canWound && !critWound.isCrit(roll) && !rollPasses(roll, woundMod, woundTN), &sp.Wounds.Rerolls)
+        // a critical wound always wounds, whatever the modifiers or the S vs T target,
+        // unless the ruleset's chart says S can't wound T at all
+        crit := canWound && critWound.isCrit(roll)
+        passes := crit || (canWound && rollPasses(roll, woundMod, woundTN))
+        if !ev.quiet { sp.Wounds.Rolls = append(sp.Wounds.Rolls, roll) }
+        outcome := OutcomeFail
+        if crit {
             wounds++
-            logs = append(logs, fmt.Sprintf("Wound roll %d: %d -> WOUND (needs %d+)", i+1, roll, woundTN))
-        } else {
-            logs = append(logs, fmt.Sprintf("Wound roll %d: %d -> FAIL (needs %d+)", i+1, roll, woundTN))
+            critWounds++
+            outcome = OutcomeCritical
+        } else if passes {
+            wounds++
+            outcome = OutcomeWound
         }
+        ev.add(Event{Kind: EventWoundRoll, Index: i + 1, Roll: roll, Modifier: woundMod, Target: woundTN, Outcome: outcome})
     }
     sp.Wounds.Success = wounds
-    logs = append(logs, fmt.Sprintf("Wounds total: %d", wounds))
+    sp.Wounds.Critical = critWounds
+    ev.add(Event{Kind: EventTotal, Stage: StageWound, Value: wounds, Critical: critWounds})
+    // Devastating Wounds: critical wounds skip the save step entirely
+    devWounds := 0
+    if devastating && critWounds > 0 {
+        devWounds = critWounds
+        if !ev.quiet {
+            e := ability("Devastating Wounds", "%d critical wound(s) skip saves and become mortal wounds", devWounds)
+            e.Stage, e.Value, e.Mortal = StageWound, devWounds, true
+            ev.add(e)
+        }
+    }
+    toSave := wounds - devWounds
+
+    // Feel No Pain: parse from defender abilities ("Feel No Pain X+" or "FNP X+") and roll once per damage to ignore
+    ur := unitRulesOf(def.Abilities)
+    fnpTN, fnpSrc := ur.fnp, ur.fnpSrc
+
+    // Damage: each unsaved attack is allocated to a single model; excess damage is lost
+    models := unitModels(def)
+    totalDmg := 0
+    slain := 0
+    // rollDamage rolls one attack's Damage characteristic, including the Melta bonus
+    dmgRolled := 0
+    rollDamage := func(mortal bool, n int) int {
+        dmgRolled++
+        dmg := damageDice.Roll(rng)
+        dmg = rerollExpr(StageDamage, dmgRolled, damageDice, dmg, &sp.Damage.Rerolls)
+        ev.add(Event{Kind: EventDamageRoll, Index: n, Expr: strings.TrimSpace(w.Damage), Value: dmg, Mortal: mortal})
+        if halfRange && ab.Melta != "" {
+            bonus := rollExpr(rng, ab.Melta)
+            dmg += bonus
+            if !ev.quiet {
+                e := ability("Melta "+ab.Melta, "+%d damage at half range -> %d", bonus, dmg).withAbility("Melta", ab.Melta)
+                e.Index, e.Value = n, bonus
+                ev.add(e)
+            }
+        }
+        return dmg
+    }
+    // applyFNP rolls Feel No Pain once per point of damage and returns what gets through
+    if fnpTN > 0 { sp.FNP.Target = fnpTN }
+    fnpRolled := 0
+    applyFNP := func(dmg int) int {
+        if fnpTN <= 0 || dmg <= 0 { return dmg }
+        var rolls []int
+        if !ev.quiet { rolls = make([]int, 0, dmg) }
+        ignored := 0
+        for j := 0; j < dmg; j++ {
+            fnpRolled++
+            r := rng.Roll(6)
+            r = rerollD6(StageFNP, fnpRolled, r, r < fnpTN || r == 1, &sp.FNP.Rerolls)
+            if !ev.quiet {
+                sp.FNP.Rolls = append(sp.FNP.Rolls, r)
+                rolls = append(rolls, r)
+            }
+            if r >= fnpTN && r != 1 { ignored++ }
+        }
+        sp.FNP.Ignored += ignored
+        ev.add(Event{Kind: EventFNPRoll, Target: fnpTN, Name: fnpSrc, Rolls: rolls, Value: ignored})
+        return dmg - ignored
+    }
+    // applyWound rolls the damage of the n-th unsaved attack and allocates it
+    applyWound := func(n int) {
+        dmg := rollDamage(false, n)
+        if !ev.quiet { sp.Damage.Rolls = append(sp.Damage.Rolls, dmg) }
+        dmg = applyFNP(dmg)
+        totalDmg += dmg
+        if dmg <= 0 { return }
+        applied, killed, e := allocateDamage(models, dmg, ab.Precision)
+        ev.add(e)
+        sp.Damage.Allocated += applied
+        sp.Damage.Wasted += dmg - applied
+        if killed { slain++ }
+    }
 
     // Saves
-    // Compute save threshold with explanation
-    effSave := def.Sv - w.AP
-    if effSave < 2 { effSave = 2 }
-    if effSave > 6 { effSave = 7 }
-    usedInv := false
-    saveTN := effSave
-    if def.InvSv > 0 && def.InvSv < effSave { saveTN = def.InvSv; usedInv = true }
-    sp.Saves.Target = saveTN
+    // A save modifier (e.g. cover) shifts the armour save; invulnerable saves are unaffected.
+    // The invulnerable save is the best one whose condition matches the attack and, when a
+    // condition names models, the model the attack is allocated to.
+    perModel := invulnPerModel(def)
+    logged, lastTN, lastInv := false, 0, (*InvulnSave)(nil)
+    // saveFor works out the save for the model at idx (-1 for the unit as a whole) and
+    // logs it whenever it changes
+    saveFor := func(idx int) int {
+        model := ""
+        if perModel && idx >= 0 { model = models[idx].Name }
+        inv, from := invulnFor(def, w, model)
+        d := def
+        d.InvSv = inv
+        effSave, saveTN, usedInv := rules.SaveTargets(d, w, saveMod)
+        if !usedInv { from = nil }
+        if logged && saveTN == lastTN && from == lastInv { return saveTN }
+        logged, lastTN, lastInv = true, saveTN, from
+        if !ev.quiet {
+            ev.add(Event{Kind: EventTarget, Stage: StageSave, Target: saveTN, Modifier: saveMod, Name: model,
+                AP: w.AP, BaseSave: def.Sv, Save: effSave, Invulnerable: usedInv})
+            if from != nil { ev.add(invulnNote(from, model)) }
+        }
+        return saveTN
+    }
+    sp.Saves.Target = saveFor(allocationTarget(models, ab.Precision))
+    sp.Saves.Modifier = saveMod
     saved := 0
     unsaved := 0
-    effSaveStr := ""
-    if effSave == 7 { effSaveStr = "no save" } else { effSaveStr = fmt.Sprintf("%d+", effSave) }
-    if usedInv {
-        logs = append(logs, fmt.Sprintf("Saves: AP %d modifies Sv to %s, Invulnerable %d+ is better -> using Invulnerable", w.AP, effSaveStr, def.InvSv))
-    } else {
-        logs = append(logs, fmt.Sprintf("Saves: AP %d modifies Sv to %s", w.AP, effSaveStr))
-    }
-    for i := 0; i < wounds; i++ {
-        roll := 1 + rng.Intn(6)
-        sp.Saves.Rolls = append(sp.Saves.Rolls, roll)
-        if roll >= saveTN && roll != 1 {
+    // rollSave rolls the i-th save against saveTN and reports whether it was passed
+    rollSave := func(i, saveTN int) bool {
+        roll := rng.Roll(6)
+        roll = rerollD6(StageSave, i, roll, roll < saveTN || roll == 1, &sp.Saves.Rerolls)
+        if !ev.quiet { sp.Saves.Rolls = append(sp.Saves.Rolls, roll) }
+        ok := roll >= saveTN && roll != 1
+        outcome := OutcomeFailed
+        if ok { outcome = OutcomeSaved }
+        ev.add(Event{Kind: EventSaveRoll, Index: i, Roll: roll, Target: saveTN, Outcome: outcome})
+        return ok
+    }
+    pending := 0 // unsaved attacks whose damage is still to be rolled
+    for i := 0; i < toSave; i++ {
+        saveTN := sp.Saves.Target
+        // when the save depends on the model, each attack is allocated before its save is
+        // made, and its damage applied before the next one
+        if perModel { saveTN = saveFor(allocationTarget(models, ab.Precision)) }
+        if rollSave(i+1, saveTN) {
             saved++
-            logs = append(logs, fmt.Sprintf("Save roll %d: %d -> SAVED (needs %d+)", i+1, roll, saveTN))
-        } else {
-            unsaved++
-            logs = append(logs, fmt.Sprintf("Save roll %d: %d -> FAILED (needs %d+)", i+1, roll, saveTN))
+            continue
         }
+        unsaved++
+        if perModel { applyWound(unsaved) } else { pending++ }
     }
     sp.Saves.Success = saved
     sp.Saves.Failed = unsaved
-    logs = append(logs, fmt.Sprintf("Saves total: %d, Unsaved total: %d (TN %d+)", saved, unsaved, saveTN))
-
-    // Damage
-    totalDmg := 0
-    for i := 0; i < unsaved; i++ {
-        var dmg int
-        if devastating && i < len(sp.Wounds.Rolls) && sp.Wounds.Rolls[i] == 6 {
-            // Model devastating wounds as max damage on crit wounds
-            // Try to infer max from dice expr (e.g., D6 -> 6, D3 -> 3). Fallback: roll.
-            expr := strings.TrimSpace(w.Damage)
-            if strings.HasPrefix(strings.ToUpper(expr), "D6") { dmg = 6 } else if strings.HasPrefix(strings.ToUpper(expr), "D3") { dmg = 3 }
-            if dmg == 0 { dmg = rollExpr(rng, w.Damage) }
-            logs = append(logs, fmt.Sprintf("Devastating Wounds: critical wound -> max damage from %s = %d", strings.TrimSpace(w.Damage), dmg))
-        } else {
-            dmg = rollExpr(rng, w.Damage)
-        }
-        sp.Damage.Rolls = append(sp.Damage.Rolls, dmg)
-        totalDmg += dmg
-        logs = append(logs, fmt.Sprintf("Damage roll %d: %s -> %d", i+1, strings.TrimSpace(w.Damage), dmg))
+    ev.add(Event{Kind: EventTotal, Stage: StageSave, Value: saved, Failed: unsaved, Target: sp.Saves.Target})
+    for i := 0; i < pending; i++ {
+        applyWound(i + 1)
     }
-    // Feel No Pain: parse from defender abilities ("Feel No Pain X+" or "FNP X+") and roll once per damage to ignore
-    fnpTN := 0
-    fnpSrc := ""
-    for _, a := range def.Abilities {
-        al := strings.ToLower(strings.TrimSpace(a))
-        if strings.HasPrefix(al, "feel no pain") || strings.HasPrefix(al, "fnp") {
-            // find an X+ token
-            fields := strings.Fields(al)
-            for _, f := range fields {
-                f = strings.TrimSpace(f)
-                if len(f) >= 2 && f[len(f)-1] == '+' {
-                    if n, err := strconv.Atoi(strings.Trim(f[:len(f)-1], "+ ")) ; err == nil {
-                        if n >= 2 && n <= 6 {
-                            if fnpTN == 0 || n < fnpTN { fnpTN = n; fnpSrc = a }
-                        }
-                    }
-                }
-            }
-        }
+    // Mortal wounds from Devastating Wounds are applied after normal damage and spill over between models
+    mortals := 0
+    for i := 0; i < devWounds; i++ {
+        mortals += rollDamage(true, i+1)
     }
-    // Apply FNP if present
-    if fnpTN > 0 && totalDmg > 0 {
-        rolls := make([]int, 0, totalDmg)
-        ignored := 0
-        for i := 0; i < totalDmg; i++ {
-            r := 1 + rng.Intn(6)
-            rolls = append(rolls, r)
-            if r >= fnpTN && r != 1 { ignored++ }
-        }
-        logs = append(logs, fmt.Sprintf("Feel No Pain %d+ (%s): rolls %v -> ignored %d damage", fnpTN, fnpSrc, rolls, ignored))
-        if ignored > 0 { totalDmg -= ignored }
-        if totalDmg < 0 { totalDmg = 0 }
+    if mortals > 0 {
+        sp.Damage.Mortal = mortals
+        mw := applyFNP(mortals)
+        totalDmg += mw
+        applied, killed, evs := allocateMortalWounds(models, mw, ab.Precision)
+        ev.add(evs...)
+        sp.Damage.Allocated += applied
+        sp.Damage.Wasted += mw - applied
+        slain += killed
     }
     sp.Damage.Total = totalDmg
-    remain := def.W - totalDmg
-    if remain < 0 { remain = 0 }
-    logs = append(logs, fmt.Sprintf("Total Damage: %d, Defender Wounds left: %d", totalDmg, remain))
+    after := def
+    after.Models = models
+    if e, ok := damagedEvent(def, after); ok { ev.add(e) }
+    remain := ModelsRemaining(models)
+    onModel := woundsOnDamagedModel(models)
+    summary := Event{Kind: EventSummary, Value: totalDmg, Left: remain}
+    if len(models) > 1 {
+        // Index marks a multi-model unit, whose summary also counts models
+        summary.Index, summary.Slain, summary.Models = len(models), slain, AliveCount(models)
+    }
+    ev.add(summary)
 
     return ShootingResult{
-        Logs:           logs,
-        Attacks:        attacks,
-        Hits:           hits,
-        Wounds:         wounds,
-        Saved:          saved,
-        Unsaved:        unsaved,
-        DamageTotal:    totalDmg,
-        DefenderWounds: remain,
-        Subphases:      sp,
-    }
+        Logs:              ev.logs(),
+        Events:            ev.events,
+        Attacks:           attacks,
+        Hits:              hits,
+        Wounds:            wounds,
+        Saved:             saved,
+        Unsaved:           unsaved,
+        DamageTotal:       totalDmg,
+        MortalWounds:      mortals,
+        DefenderWounds:    remain,
+        ModelsSlain:       slain,
+        WoundsLeftOnModel: onModel,
+        Models:            models,
+        Subphases:         sp,
+        Seed:              seed,
+        SingleRerolls:     rr.spent(),
+    }, nil
 }
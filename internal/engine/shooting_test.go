@@ -0,0 +1,143 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestShootingScriptedVolley(t *testing.T) {
+    w := WeaponSnapshot{Name: "Bolt rifle", Type: "ranged", Attacks: "3", Skill: 3, Strength: 4, Damage: "1"}
+    def := UnitSnapshot{Name: "Target", T: 4, Sv: 3, W: 10}
+    // hits: 4, 2, 3; wounds: 4, 4; saves: 3, 2
+    rng := NewScriptedRoller(4, 2, 3, 4, 4, 3, 2)
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: rng})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Attacks != 3 || res.Hits != 2 || res.Wounds != 2 || res.Saved != 1 || res.Unsaved != 1 || res.DamageTotal != 1 || res.DefenderWounds != 9 {
+        t.Errorf("got attacks %d hits %d wounds %d saved %d unsaved %d damage %d left %d, want 3 2 2 1 1 1 9",
+            res.Attacks, res.Hits, res.Wounds, res.Saved, res.Unsaved, res.DamageTotal, res.DefenderWounds)
+    }
+    if res.Seed != 0 {
+        t.Errorf("a scripted roller has no seed, got %d", res.Seed)
+    }
+}
+
+func TestShootingSeedReplays(t *testing.T) {
+    w := WeaponSnapshot{Name: "Heavy bolter", Type: "ranged", Attacks: "D6+1", Skill: 3, Strength: 5, AP: -1, Damage: "D3", Abilities: []string{"Sustained Hits 1"}}
+    def := UnitSnapshot{Name: "Squad", T: 4, Sv: 3, W: 12, Abilities: []string{"Feel No Pain 6+"}}
+    for seed := int64(1); seed <= 20; seed++ {
+        a, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewSeededRoller(seed)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        b, _ := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewSeededRoller(a.Seed)})
+        if a.Seed != seed || !reflect.DeepEqual(a, b) {
+            t.Fatalf("seed %d: replay differs", seed)
+        }
+    }
+}
+
+func TestShootingRange(t *testing.T) {
+    w := WeaponSnapshot{Name: "Meltagun", Type: "ranged", Range: 12, Attacks: "1", Skill: 2, Strength: 9, AP: -4, Damage: "D6", Abilities: []string{"Melta 2"}}
+    def := UnitSnapshot{Name: "Tank", T: 10, Sv: 3, W: 12}
+    if _, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(6), Distance: 13}); err == nil {
+        t.Error("a target beyond range was shot")
+    }
+    // hit 2, wound 6, save 1, damage 3; Melta adds 2 at half range only
+    for _, c := range []struct{ distance, want int }{{6, 5}, {7, 3}, {0, 3}} {
+        res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewScriptedRoller(2, 6, 1, 3), Distance: c.distance})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.DamageTotal != c.want {
+            t.Errorf("at %d\": damage %d, want %d", c.distance, res.DamageTotal, c.want)
+        }
+    }
+}
+
+func TestRapidFireAtHalfRange(t *testing.T) {
+    w := WeaponSnapshot{Name: "Bolt rifle", Type: "ranged", Range: 24, Attacks: "2", Skill: 3, Strength: 4, Damage: "1", Abilities: []string{"Rapid Fire 1"}}
+    for _, c := range []struct{ distance, want int }{{12, 3}, {13, 2}} {
+        res, err := ResolveShootingWith(UnitSnapshot{}, UnitSnapshot{T: 4, Sv: 3, W: 5}, w, ShootingOptions{Roller: NewScriptedRoller(1), Distance: c.distance})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if res.Attacks != c.want {
+            t.Errorf("at %d\": %d attacks, want %d", c.distance, res.Attacks, c.want)
+        }
+    }
+}
+
+func TestShootingDevastatingWoundsSpillAndFNP(t *testing.T) {
+    w := WeaponSnapshot{Name: "Lascannon", Type: "ranged", Attacks: "2", Skill: 2, Strength: 8, Damage: "3", Abilities: []string{"Devastating Wounds"}}
+    def := UnitSnapshot{Name: "Squad", T: 4, Sv: 2, Abilities: []string{"Feel No Pain 5+"}, Models: squad(3, 2)}
+    rng := NewScriptedRoller(
+        3, 3, // hits
+        6, 5, // wounds: one critical, one normal
+        1,       // save for the normal wound: failed
+        5, 1, 1, // FNP on its 3 damage: 1 ignored, 2 kill the first model and the rest is lost
+        1, 1, 1, // FNP on the 3 mortal wounds: none ignored, they spill onto the third model
+    )
+    res, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: rng})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Wounds != 2 || res.Subphases.Wounds.Critical != 1 || res.Unsaved != 1 || res.MortalWounds != 3 {
+        t.Errorf("got wounds %d (crit %d) unsaved %d mortal %d, want 2 (1) 1 3",
+            res.Wounds, res.Subphases.Wounds.Critical, res.Unsaved, res.MortalWounds)
+    }
+    if res.DamageTotal != 5 || res.ModelsSlain != 2 || res.DefenderWounds != 1 {
+        t.Errorf("got damage %d slain %d left %d, want 5 2 1", res.DamageTotal, res.ModelsSlain, res.DefenderWounds)
+    }
+    var left []int
+    for _, m := range res.Models { left = append(left, m.Wounds) }
+    if want := []int{0, 0, 1}; !reflect.DeepEqual(left, want) {
+        t.Errorf("models left with %v wounds, want %v", left, want)
+    }
+    if rng.Used() != 11 {
+        t.Errorf("rolled %d dice, want 11", rng.Used())
+    }
+}
+
+func TestQuietShootingMatchesLogged(t *testing.T) {
+    w := WeaponSnapshot{Name: "Heavy bolter", Type: "ranged", Attacks: "D6+1", Skill: 3, Strength: 5, AP: -1, Damage: "D3", Abilities: []string{"Sustained Hits 1", "Devastating Wounds"}}
+    def := UnitSnapshot{Name: "Squad", T: 4, Sv: 3, W: 2, Models: squad(5, 2), Abilities: []string{"Feel No Pain 6+"}}
+    for seed := int64(1); seed <= 20; seed++ {
+        logged, err := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewSeededRoller(seed)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        quiet, _ := ResolveShootingWith(UnitSnapshot{}, def, w, ShootingOptions{Roller: NewSeededRoller(seed), Quiet: true})
+        if len(quiet.Logs) != 0 || len(quiet.Events) != 0 {
+            t.Fatalf("seed %d: a quiet volley logged %d lines", seed, len(quiet.Logs))
+        }
+        // the quiet path skips the per-die subphase detail too; the totals must match
+        logged.Logs, logged.Events, logged.Subphases = nil, nil, nil
+        quiet.Logs, quiet.Events, quiet.Subphases = nil, nil, nil
+        if !reflect.DeepEqual(logged, quiet) {
+            t.Fatalf("seed %d: quiet %+v, logged %+v", seed, quiet, logged)
+        }
+    }
+}
+
+func TestShootingRejectsFailedRerollForDamage(t *testing.T) {
+    w := WeaponSnapshot{Name: "Gun", Type: "ranged", Attacks: "D6", Skill: 3, Strength: 4, Damage: "D3"}
+    for _, st := range []Stage{StageAttacks, StageDamage} {
+        opts := ShootingOptions{Roller: NewSeededRoller(1), Rerolls: Rerolls{st: RerollFailed}}
+        if _, err := ResolveShootingWith(UnitSnapshot{}, UnitSnapshot{T: 4, Sv: 3, W: 5}, w, opts); err == nil {
+            t.Errorf("%s: a failed re-roll was accepted", st)
+        }
+        opts.Rerolls = Rerolls{st: RerollOnes}
+        if _, err := ResolveShootingWith(UnitSnapshot{}, UnitSnapshot{T: 4, Sv: 3, W: 5}, w, opts); err != nil {
+            t.Errorf("%s: %v", st, err)
+        }
+    }
+}
+
+func TestResolveShootingRejectsInvalidWeapon(t *testing.T) {
+    w := WeaponSnapshot{Name: "Broken", Type: "ranged", Attacks: "D", Skill: 3, Strength: 4, Damage: "1"}
+    if _, err := ResolveShooting(UnitSnapshot{}, UnitSnapshot{Name: "Target", T: 4, Sv: 3, W: 10}, w); err == nil {
+        t.Error("a weapon with unparsable Attacks was resolved")
+    }
+}
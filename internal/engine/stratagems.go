@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StratagemEffect is a stratagem the engine knows how to resolve
+type StratagemEffect string
+
+const (
+    EffectCommandReroll StratagemEffect = "command_reroll" // re-roll one roll
+    EffectGoToGround    StratagemEffect = "go_to_ground"   // 6+ invulnerable save and Benefit of Cover
+    EffectEpicChallenge StratagemEffect = "epic_challenge" // melee weapons gain Precision
+    EffectFireOverwatch StratagemEffect = "fire_overwatch" // shoot at a charging unit, hitting on 6s
+)
+
+// coreStratagems maps the names of the generic stratagems the engine supports to their effect
+var coreStratagems = map[string]StratagemEffect{
+    "command re-roll": EffectCommandReroll,
+    "go to ground":    EffectGoToGround,
+    "epic challenge":  EffectEpicChallenge,
+    "fire overwatch":  EffectFireOverwatch,
+}
+
+// StratagemEffectFor returns the engine effect of a stratagem by name; false means the
+// engine can't resolve it yet
+func StratagemEffectFor(name string) (StratagemEffect, bool) {
+    e, ok := coreStratagems[strings.ToLower(strings.Join(strings.Fields(name), " "))]
+    return e, ok
+}
+
+// Whose turn a stratagem can be used in
+const (
+    TimingYourTurn     = "your"
+    TimingOpponentTurn = "opponent"
+    TimingEitherTurn   = "either"
+)
+
+// StratagemTiming is when a stratagem can be used: in whose turn and in which phases
+type StratagemTiming struct {
+    Turn   string  `json:"turn"`             // your, opponent or either
+    Phases []Phase `json:"phases,omitempty"` // empty with AnyPhase false means never in a turn (e.g. deployment)
+    AnyPhase bool  `json:"any_phase,omitempty"`
+}
+
+// ParseStratagemTiming reads the turn and phase columns of Stratagems.csv, e.g.
+// "Opponent’s turn" and "Movement or Charge phase"
+func ParseStratagemTiming(turn, phase string) StratagemTiming {
+    var t StratagemTiming
+    switch lt := strings.ToLower(turn); {
+    case strings.HasPrefix(lt, "your"):
+        t.Turn = TimingYourTurn
+    case strings.HasPrefix(lt, "opponent"):
+        t.Turn = TimingOpponentTurn
+    default:
+        t.Turn = TimingEitherTurn
+    }
+    lp := strings.ToLower(phase)
+    if strings.Contains(lp, "any phase") {
+        t.AnyPhase = true
+        return t
+    }
+    for _, p := range phaseOrder {
+        if strings.Contains(lp, string(p)) { t.Phases = append(t.Phases, p) }
+    }
+    return t
+}
+
+// allows reports whether the timing fits the current phase for the player at index idx
+func (st StratagemTiming) allows(t *TurnState, idx int) error {
+    switch st.Turn {
+    case TimingYourTurn:
+        if idx != t.Active { return fmt.Errorf("can only be used in your own turn") }
+    case TimingOpponentTurn:
+        if idx == t.Active { return fmt.Errorf("can only be used in your opponent's turn") }
+    }
+    if st.AnyPhase { return nil }
+    for _, p := range st.Phases {
+        if p == t.Phase { return nil }
+    }
+    return fmt.Errorf("can't be used in the %s phase", t.Phase)
+}
+
+// StratagemUse is a stratagem a player has used this phase
+type StratagemUse struct {
+    Player string          `json:"player"`
+    Name   string          `json:"name"`
+    Effect StratagemEffect `json:"effect"`
+    CP     int             `json:"cp"`
+    Stage  Stage           `json:"stage,omitempty"` // the roll a Command Re-roll applies to
+    Spent  bool            `json:"spent,omitempty"` // a one-off effect that has been applied
+}
+
+// CheckStratagemTarget reports whether a unit is an eligible target for a stratagem
+// effect: Go to Ground needs Infantry and Epic Challenge a Character
+func CheckStratagemTarget(e StratagemEffect, u UnitSnapshot) error {
+    switch e {
+    case EffectGoToGround:
+        if !hasUnitAbility(u.Keywords, "Infantry") { return fmt.Errorf("Go to Ground targets an Infantry unit") }
+    case EffectEpicChallenge:
+        if !hasUnitAbility(u.Keywords, "Character") { return fmt.Errorf("Epic Challenge targets a Character unit") }
+    }
+    return nil
+}
+
+// GoToGround applies Go to Ground to a unit being shot: a 6+ invulnerable save (unless
+// it has a better one) and the Benefit of Cover
+func GoToGround(u UnitSnapshot, opts ShootingOptions) (UnitSnapshot, ShootingOptions) {
+    if u.InvSv == 0 || u.InvSv > 6 { u.InvSv = 6 }
+    opts.Cover = true
+    return u, opts
+}
+
+// EpicChallenge gives melee weapons the Precision ability
+func EpicChallenge(ws []WeaponSnapshot) []WeaponSnapshot {
+    out := make([]WeaponSnapshot, len(ws))
+    for i, w := range ws {
+        out[i] = w
+        if w.IsMelee() && !ParseWeaponAbilities(w.Abilities...).Precision {
+            out[i].Abilities = append(append([]string(nil), w.Abilities...), "Precision")
+        }
+    }
+    return out
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseStratagemTiming(t *testing.T) {
+    got := ParseStratagemTiming("Opponent’s turn", "Movement or Charge phase")
+    want := StratagemTiming{Turn: TimingOpponentTurn, Phases: []Phase{PhaseMovement, PhaseCharge}}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+    if got := ParseStratagemTiming("Either player’s turn", "Any phase"); got.Turn != TimingEitherTurn || !got.AnyPhase {
+        t.Errorf("got %+v, want either turn, any phase", got)
+    }
+}
+
+func TestUseStratagemCPAndTiming(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    reroll := StratagemUse{Name: "Command Re-roll", Effect: EffectCommandReroll, CP: 1}
+    anyPhase := ParseStratagemTiming("Either player’s turn", "Any phase")
+    if err := ts.UseStratagem("alice", reroll, anyPhase); err != nil {
+        t.Fatal(err)
+    }
+    if ts.CP[0] != 0 || !ts.StratagemActive("alice", EffectCommandReroll) {
+        t.Fatalf("after using it: CP %v, stratagems %+v", ts.CP, ts.Stratagems)
+    }
+    if err := ts.UseStratagem("alice", reroll, anyPhase); err == nil {
+        t.Error("a stratagem was used twice in a phase")
+    }
+    if err := ts.UseStratagem("bob", StratagemUse{Name: "Expensive", CP: 2}, anyPhase); err == nil {
+        t.Error("a stratagem was used without enough CP")
+    }
+    overwatch := ParseStratagemTiming("Opponent’s turn", "Movement or Charge phase")
+    if err := ts.UseStratagem("bob", StratagemUse{Name: "Fire Overwatch", CP: 1}, overwatch); err == nil {
+        t.Error("Fire Overwatch was used in the Command phase")
+    }
+    if err := ts.AdvanceTo(PhaseMovement); err != nil {
+        t.Fatal(err)
+    }
+    if err := ts.UseStratagem("alice", StratagemUse{Name: "Fire Overwatch", CP: 0}, overwatch); err == nil {
+        t.Error("Fire Overwatch was used in the player's own turn")
+    }
+    if err := ts.UseStratagem("bob", StratagemUse{Name: "Fire Overwatch", CP: 1}, overwatch); err != nil {
+        t.Error(err)
+    }
+    if ts.StratagemActive("alice", EffectCommandReroll) {
+        t.Error("a stratagem's effect lasted past its phase")
+    }
+    ts.EndTurn()
+    if ts.CP != [2]int{1, 1} {
+        t.Errorf("CP %v after bob's Command phase began, want [1 1]", ts.CP)
+    }
+}
+
+func TestConsumeStratagem(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    use := StratagemUse{Name: "Command Re-roll", Effect: EffectCommandReroll, CP: 1, Stage: StageHit}
+    if err := ts.UseStratagem("alice", use, ParseStratagemTiming("Either", "Any phase")); err != nil {
+        t.Fatal(err)
+    }
+    if got, ok := ts.ConsumeStratagem("alice", EffectCommandReroll); !ok || got.Stage != StageHit {
+        t.Errorf("ConsumeStratagem = %+v, %v", got, ok)
+    }
+    if _, ok := ts.ConsumeStratagem("alice", EffectCommandReroll); ok {
+        t.Error("a Command Re-roll was consumed twice")
+    }
+}
+
+func TestBattleShockedUnitCantUseStratagems(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    ts.RecordBattleShock(true, false)
+    if err := ts.UseStratagem("alice", StratagemUse{Name: "Command Re-roll", CP: 1}, ParseStratagemTiming("Either", "Any phase")); err == nil {
+        t.Error("a Battle-shocked unit used a stratagem")
+    }
+}
+
+func TestStratagemEffects(t *testing.T) {
+    if e, ok := StratagemEffectFor("  GO TO  ground"); !ok || e != EffectGoToGround {
+        t.Errorf("StratagemEffectFor = %q, %v", e, ok)
+    }
+    if err := CheckStratagemTarget(EffectGoToGround, UnitSnapshot{Keywords: []string{"Vehicle"}}); err == nil {
+        t.Error("Go to Ground targeted a Vehicle")
+    }
+    u, opts := GoToGround(UnitSnapshot{InvSv: 4}, ShootingOptions{})
+    if u.InvSv != 4 || !opts.Cover {
+        t.Errorf("Go to Ground: invulnerable %d cover %v, want 4 and true", u.InvSv, opts.Cover)
+    }
+    ws := EpicChallenge([]WeaponSnapshot{{Name: "Sword", Type: "melee"}, {Name: "Gun", Type: "ranged"}})
+    if !reflect.DeepEqual(ws[0].Abilities, []string{"Precision"}) || len(ws[1].Abilities) != 0 {
+        t.Errorf("Epic Challenge: %+v", ws)
+    }
+}
+
+func TestCanUseStratagemSpendsNothing(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    use := StratagemUse{Name: "Command Re-roll", Effect: EffectCommandReroll, CP: 1}
+    anyPhase := ParseStratagemTiming("Either", "Any phase")
+    if err := ts.CanUseStratagem("alice", use, anyPhase); err != nil {
+        t.Fatal(err)
+    }
+    if ts.CP[0] != 1 || len(ts.Stratagems) != 0 {
+        t.Errorf("CanUseStratagem spent CP: %v, %+v", ts.CP, ts.Stratagems)
+    }
+    use.CP = 2
+    if err := ts.CanUseStratagem("alice", use, anyPhase); err == nil {
+        t.Error("a 2 CP stratagem was allowed with 1 CP")
+    }
+}
@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Phase is one phase of a player's turn
+type Phase string
+
+const (
+    PhaseCommand  Phase = "command"
+    PhaseMovement Phase = "movement"
+    PhaseShooting Phase = "shooting"
+    PhaseCharge   Phase = "charge"
+    PhaseFight    Phase = "fight"
+)
+
+// phaseOrder is the order phases are played in each turn
+var phaseOrder = []Phase{PhaseCommand, PhaseMovement, PhaseShooting, PhaseCharge, PhaseFight}
+
+// ActionType is something a player can do during their turn
+type ActionType string
+
+const (
+    ActionEndPhase         ActionType = "end_phase"
+    ActionMove             ActionType = "move"              // Normal move
+    ActionAdvance          ActionType = "advance"           // move further; only Assault weapons can shoot, no charge
+    ActionRemainStationary ActionType = "remain_stationary" // Heavy weapons get +1 to hit
+    ActionFallBack         ActionType = "fall_back"         // leave Engagement Range; no shooting or charging
+    ActionShoot            ActionType = "shoot"
+    ActionCharge           ActionType = "charge"
+    ActionFight            ActionType = "fight"
+)
+
+// DefaultBattleRounds is the length of a standard game
+const DefaultBattleRounds = 5
+
+// TurnFlags records what the active player's unit has done this turn
+type TurnFlags struct {
+    Moved        bool  `json:"moved"`
+    Advanced     bool  `json:"advanced"`
+    Stationary   bool  `json:"stationary"`
+    FellBack     bool  `json:"fell_back"`
+    Shot         []int `json:"shot,omitempty"` // indices of weapons already fired
+    Charged      bool  `json:"charged"`        // made a successful charge
+    ChargeFailed bool  `json:"charge_failed"`  // declared a charge and failed the roll
+    Fought       bool  `json:"fought"`
+    ShockTested  bool  `json:"shock_tested"` // the Command phase Battle-shock step is done
+}
+
+// TurnState is the battle-round state machine for a duel between two players' units.
+// Each battle round both players take a turn, in the same order; each turn runs
+// through the phases in order and only the actions legal in the current phase are allowed.
+type TurnState struct {
+    Players   [2]string `json:"players"`
+    Round     int       `json:"round"` // current battle round, from 1
+    MaxRounds int       `json:"max_rounds"`
+    Active    int       `json:"active"` // index into Players of the player whose turn it is
+    Phase     Phase     `json:"phase"`
+    Engaged   bool      `json:"engaged"` // the two units are within Engagement Range
+    // Battle-shocked per player, until the start of that player's next Command phase
+    BattleShocked [2]bool `json:"battle_shocked"`
+    CP            [2]int  `json:"cp"` // Command Points per player
+    // Stratagems used this phase; their effects last until the end of the phase
+    Stratagems []StratagemUse `json:"stratagems,omitempty"`
+    Turn      TurnFlags `json:"turn"`
+    Over      bool      `json:"over"` // the last battle round has ended
+}
+
+// CPPerCommandPhase is what both players gain at the start of every Command phase
+const CPPerCommandPhase = 1
+
+// NewTurnState starts battle round 1 with the first player's Command phase
+func NewTurnState(first, second string, rounds int) *TurnState {
+    if rounds <= 0 { rounds = DefaultBattleRounds }
+    return &TurnState{
+        Players: [2]string{first, second}, Round: 1, MaxRounds: rounds, Phase: PhaseCommand,
+        CP: [2]int{CPPerCommandPhase, CPPerCommandPhase},
+    }
+}
+
+// Clone returns a copy of the state that shares nothing with it, for trying out a
+// sequence of actions before committing to it
+func (t *TurnState) Clone() *TurnState {
+    c := *t
+    c.Stratagems = append([]StratagemUse(nil), t.Stratagems...)
+    c.Turn.Shot = append([]int(nil), t.Turn.Shot...)
+    return &c
+}
+
+// playerIndex returns a player's index into Players, or -1
+func (t *TurnState) playerIndex(player string) int {
+    for i, p := range t.Players {
+        if p == player { return i }
+    }
+    return -1
+}
+
+// IsBattleShocked reports whether a player's unit is Battle-shocked
+func (t *TurnState) IsBattleShocked(player string) bool {
+    i := t.playerIndex(player)
+    return i >= 0 && t.BattleShocked[i]
+}
+
+// UseStratagem spends CP on a stratagem for the player's unit. It must fit the timing,
+// the unit can't be Battle-shocked, and each stratagem can be used once per phase.
+func (t *TurnState) UseStratagem(player string, use StratagemUse, timing StratagemTiming) error {
+    if err := t.CanUseStratagem(player, use, timing); err != nil {
+        return err
+    }
+    i := t.playerIndex(player)
+    t.CP[i] -= use.CP
+    use.Player = player
+    t.Stratagems = append(t.Stratagems, use)
+    return nil
+}
+
+// CanUseStratagem reports whether UseStratagem would accept the stratagem, without
+// spending anything
+func (t *TurnState) CanUseStratagem(player string, use StratagemUse, timing StratagemTiming) error {
+    i := t.playerIndex(player)
+    if i < 0 {
+        return fmt.Errorf("invalid player")
+    }
+    if t.Over {
+        return fmt.Errorf("the game is over")
+    }
+    if t.BattleShocked[i] {
+        return fmt.Errorf("%s: a Battle-shocked unit can't be affected by Stratagems", use.Name)
+    }
+    if err := timing.allows(t, i); err != nil {
+        return fmt.Errorf("%s %v", use.Name, err)
+    }
+    for _, u := range t.Stratagems {
+        if u.Player == player && strings.EqualFold(u.Name, use.Name) {
+            return fmt.Errorf("%s has already been used this phase", use.Name)
+        }
+    }
+    if use.CP > t.CP[i] {
+        return fmt.Errorf("%s costs %d CP, you have %d", use.Name, use.CP, t.CP[i])
+    }
+    return nil
+}
+
+// StratagemActive reports whether a player has an unspent stratagem effect this phase
+func (t *TurnState) StratagemActive(player string, e StratagemEffect) bool {
+    for _, u := range t.Stratagems {
+        if u.Player == player && u.Effect == e && !u.Spent { return true }
+    }
+    return false
+}
+
+// ConsumeStratagem marks a player's one-off stratagem effect (a Command Re-roll) as
+// applied and returns it
+func (t *TurnState) ConsumeStratagem(player string, e StratagemEffect) (StratagemUse, bool) {
+    for i, u := range t.Stratagems {
+        if u.Player == player && u.Effect == e && !u.Spent {
+            t.Stratagems[i].Spent = true
+            return t.Stratagems[i], true
+        }
+    }
+    return StratagemUse{}, false
+}
+
+// ActivePlayer returns the name of the player whose turn it is
+func (t *TurnState) ActivePlayer() string { return t.Players[t.Active] }
+
+// LegalActions lists what the active player may do in the current phase
+func (t *TurnState) LegalActions() []ActionType {
+    if t.Over { return nil }
+    var out []ActionType
+    switch t.Phase {
+    case PhaseMovement:
+        if !t.Turn.Moved && !t.Turn.Stationary {
+            if t.Engaged {
+                out = append(out, ActionFallBack)
+            } else {
+                out = append(out, ActionMove, ActionAdvance)
+            }
+            out = append(out, ActionRemainStationary)
+        }
+    case PhaseShooting:
+        if !t.Turn.FellBack { out = append(out, ActionShoot) }
+    case PhaseCharge:
+        if !t.Engaged && !t.Turn.Advanced && !t.Turn.FellBack && !t.Turn.Charged && !t.Turn.ChargeFailed {
+            out = append(out, ActionCharge)
+        }
+    case PhaseFight:
+        if t.Engaged && !t.Turn.Fought { out = append(out, ActionFight) }
+    }
+    return append(out, ActionEndPhase)
+}
+
+// Check reports whether player may take action a now
+func (t *TurnState) Check(player string, a ActionType) error {
+    if t.Over {
+        return fmt.Errorf("the game is over")
+    }
+    if player != t.ActivePlayer() {
+        return fmt.Errorf("not your turn")
+    }
+    for _, la := range t.LegalActions() {
+        if la == a { return nil }
+    }
+    return fmt.Errorf("%s is not allowed in the %s phase", a, t.Phase)
+}
+
+// CheckShot reports whether the weapon at index idx may shoot now: it must be a ranged
+// weapon that hasn't fired this turn, Assault if the unit Advanced, Pistol if it's engaged
+func (t *TurnState) CheckShot(w WeaponSnapshot, idx int) error {
+    if w.IsMelee() {
+        return fmt.Errorf("%s is a melee weapon; it fights in the fight phase", w.Name)
+    }
+    for _, s := range t.Turn.Shot {
+        if s == idx { return fmt.Errorf("%s has already shot this turn", w.Name) }
+    }
+    ab := ParseWeaponAbilities(w.Abilities...)
+    if t.Turn.Advanced && !ab.Assault {
+        return fmt.Errorf("%s can't shoot after Advancing (not an Assault weapon)", w.Name)
+    }
+    if t.Engaged && !ab.Pistol {
+        return fmt.Errorf("%s can't shoot while in Engagement Range (not a Pistol)", w.Name)
+    }
+    return nil
+}
+
+// Record applies the effects of a checked action. Shots record the weapon index;
+// a charge recorded here succeeds (use RecordCharge for a rolled charge).
+func (t *TurnState) Record(a ActionType, weapon int) {
+    switch a {
+    case ActionEndPhase:
+        t.EndPhase()
+    case ActionMove:
+        t.Turn.Moved = true
+    case ActionAdvance:
+        t.Turn.Moved, t.Turn.Advanced = true, true
+    case ActionRemainStationary:
+        t.Turn.Stationary = true
+    case ActionFallBack:
+        t.Turn.Moved, t.Turn.FellBack = true, true
+        t.Engaged = false
+    case ActionShoot:
+        t.Turn.Shot = append(t.Turn.Shot, weapon)
+    case ActionCharge:
+        t.RecordCharge(true)
+    case ActionFight:
+        t.Turn.Fought = true
+    }
+}
+
+// RecordCharge applies a charge roll: success brings the units into Engagement Range,
+// failure uses up the unit's charge for this turn
+func (t *TurnState) RecordCharge(success bool) {
+    if success {
+        t.Turn.Charged = true
+        t.Engaged = true
+    } else {
+        t.Turn.ChargeFailed = true
+    }
+}
+
+// RecordBattleShock marks the active player's Battle-shock step as done; a failed
+// test (passed false) leaves the unit Battle-shocked
+func (t *TurnState) RecordBattleShock(tested, passed bool) {
+    t.Turn.ShockTested = true
+    if tested && !passed { t.BattleShocked[t.Active] = true }
+}
+
+// EndPhase moves on to the next phase. A unit that didn't move in its Movement phase
+// Remained Stationary. After the Fight phase the other player's turn begins, and once
+// both players have had their turn a new battle round starts.
+func (t *TurnState) EndPhase() {
+    if t.Over { return }
+    if t.Phase == PhaseMovement && !t.Turn.Moved { t.Turn.Stationary = true }
+    t.Stratagems = nil
+    for i, p := range phaseOrder {
+        if p == t.Phase && i+1 < len(phaseOrder) {
+            t.Phase = phaseOrder[i+1]
+            return
+        }
+    }
+    // end of turn
+    t.Turn = TurnFlags{}
+    t.Phase = PhaseCommand
+    t.Active = 1 - t.Active
+    t.BattleShocked[t.Active] = false // Battle-shock wears off at the start of the Command phase
+    for i := range t.CP { t.CP[i] += CPPerCommandPhase }
+    if t.Active == 0 {
+        t.Round++
+        if t.Round > t.MaxRounds {
+            t.Round = t.MaxRounds
+            t.Over = true
+        }
+    }
+}
+
+// AdvanceTo ends phases until the given phase of the current turn is reached.
+// It returns an error if that phase has already passed this turn.
+func (t *TurnState) AdvanceTo(p Phase) error {
+    want, cur := -1, -1
+    for i, ph := range phaseOrder {
+        if ph == p { want = i }
+        if ph == t.Phase { cur = i }
+    }
+    if want < 0 {
+        return fmt.Errorf("unknown phase %q", p)
+    }
+    if want < cur {
+        return fmt.Errorf("the %s phase has already ended this turn", p)
+    }
+    for t.Phase != p { t.EndPhase() }
+    return nil
+}
+
+// EndTurn ends every remaining phase of the current turn
+func (t *TurnState) EndTurn() {
+    active, round := t.Active, t.Round
+    for !t.Over && t.Active == active && t.Round == round { t.EndPhase() }
+}
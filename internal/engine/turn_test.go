@@ -0,0 +1,98 @@
+package engine
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTurnStatePhasesAndRounds(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 2)
+    if ts.ActivePlayer() != "alice" || ts.Phase != PhaseCommand || ts.Round != 1 {
+        t.Fatalf("start: %+v", ts)
+    }
+    for _, want := range []Phase{PhaseMovement, PhaseShooting, PhaseCharge, PhaseFight} {
+        ts.EndPhase()
+        if ts.Phase != want {
+            t.Fatalf("phase %s, want %s", ts.Phase, want)
+        }
+    }
+    ts.EndPhase()
+    if ts.ActivePlayer() != "bob" || ts.Phase != PhaseCommand || ts.Round != 1 {
+        t.Fatalf("after alice's turn: %+v", ts)
+    }
+    ts.EndTurn()
+    if ts.ActivePlayer() != "alice" || ts.Round != 2 || ts.Over {
+        t.Fatalf("after round 1: %+v", ts)
+    }
+    ts.EndTurn()
+    ts.EndTurn()
+    if !ts.Over || ts.Round != 2 {
+        t.Fatalf("after the last round: %+v", ts)
+    }
+    if err := ts.Check("alice", ActionEndPhase); err == nil {
+        t.Error("an action was allowed after the game ended")
+    }
+}
+
+func TestTurnStateLegalActions(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    if err := ts.Check("bob", ActionEndPhase); err == nil {
+        t.Error("bob acted on alice's turn")
+    }
+    if err := ts.Check("alice", ActionShoot); err == nil {
+        t.Error("shooting was allowed in the Command phase")
+    }
+    if err := ts.AdvanceTo(PhaseMovement); err != nil {
+        t.Fatal(err)
+    }
+    if want := []ActionType{ActionMove, ActionAdvance, ActionRemainStationary, ActionEndPhase}; !reflect.DeepEqual(ts.LegalActions(), want) {
+        t.Errorf("movement actions %v, want %v", ts.LegalActions(), want)
+    }
+    ts.Record(ActionAdvance, 0)
+    if err := ts.AdvanceTo(PhaseCharge); err != nil {
+        t.Fatal(err)
+    }
+    if err := ts.Check("alice", ActionCharge); err == nil {
+        t.Error("a unit that Advanced was allowed to charge")
+    }
+    if err := ts.AdvanceTo(PhaseShooting); err == nil {
+        t.Error("went back to a phase that had ended")
+    }
+}
+
+func TestTurnStateCheckShot(t *testing.T) {
+    rifle := WeaponSnapshot{Name: "Rifle", Type: "ranged"}
+    pistol := WeaponSnapshot{Name: "Pistol", Type: "ranged", Abilities: []string{"Pistol"}}
+    assault := WeaponSnapshot{Name: "Carbine", Type: "ranged", Abilities: []string{"Assault"}}
+    ts := NewTurnState("alice", "bob", 0)
+    ts.Record(ActionShoot, 0)
+    if err := ts.CheckShot(rifle, 0); err == nil {
+        t.Error("a weapon shot twice in a turn")
+    }
+    if err := ts.CheckShot(WeaponSnapshot{Name: "Sword", Type: "melee"}, 1); err == nil {
+        t.Error("a melee weapon was allowed to shoot")
+    }
+    ts.Turn.Advanced = true
+    if ts.CheckShot(rifle, 1) == nil || ts.CheckShot(assault, 2) != nil {
+        t.Error("after Advancing only Assault weapons may shoot")
+    }
+    ts.Turn.Advanced, ts.Engaged = false, true
+    if ts.CheckShot(rifle, 1) == nil || ts.CheckShot(pistol, 2) != nil {
+        t.Error("in Engagement Range only Pistols may shoot")
+    }
+}
+
+func TestTurnStateClone(t *testing.T) {
+    ts := NewTurnState("alice", "bob", 0)
+    if err := ts.AdvanceTo(PhaseShooting); err != nil {
+        t.Fatal(err)
+    }
+    ts.Record(ActionShoot, 0)
+    c := ts.Clone()
+    c.Record(ActionShoot, 1)
+    c.CP[0] = 0
+    c.EndPhase()
+    if ts.Phase != PhaseShooting || len(ts.Turn.Shot) != 1 || ts.CP[0] != 1 {
+        t.Errorf("changing the clone changed the original: %+v", ts)
+    }
+}
@@ -1,21 +1,33 @@
 package engine
 
+import (
+	"fmt"
+	"strings"
+)
+
 // UnitSnapshot captures the minimal stats needed for resolution
 type UnitSnapshot struct {
     ID    string
     Name  string
     T     int // toughness
-    W     int // total wounds
+    W     int // total wounds (used as a single model when Models is empty)
     Sv    int // armor save (2-6; 7 means none)
     InvSv int // invulnerable save (2-6; 0 if none)
+    InvSaves []InvulnSave // invulnerable saves that only apply to some attacks or models
+    Ld    int // leadership: Battle-shock tests pass on 2D6 >= Ld (0 if unknown)
+    OC    int // objective control
     Keywords []string // unit keywords (e.g., Infantry, Vehicle)
     Abilities []string // unit abilities (e.g., Feel No Pain 5+)
+    Models []ModelState // per-model wounds; damage is allocated model by model
+    Damaged  *DamagedProfile // degraded bracket for vehicles and monsters; nil if none
+    Degraded bool            // has dropped into its damaged bracket (it stays there)
 }
 
 // WeaponSnapshot for a single weapon profile
 type WeaponSnapshot struct {
     Name       string
     Type       string // "melee" or "ranged"
+    Range      int    // range in inches; 0 for melee or unknown
     Attacks    string // dice expr or int
     Skill      int    // hit threshold (2-6)
     Strength   int
@@ -24,16 +36,43 @@ type WeaponSnapshot struct {
     Abilities  []string // normalized ability tokens from weapon profile
 }
 
+// IsMelee reports whether the profile is a melee weapon
+func (w WeaponSnapshot) IsMelee() bool {
+    // compare in place rather than lower-casing: this runs for every volley
+    for i := 0; i+len("melee") <= len(w.Type); i++ {
+        if strings.EqualFold(w.Type[i:i+len("melee")], "melee") { return true }
+    }
+    return false
+}
+
+// Validate checks that the weapon's Attacks and Damage are dice expressions the engine can roll
+func (w WeaponSnapshot) Validate() error {
+    if _, err := ParseDice(w.Attacks); err != nil { return fmt.Errorf("%s attacks: %v", w.Name, err) }
+    if _, err := ParseDice(w.Damage); err != nil { return fmt.Errorf("%s damage: %v", w.Name, err) }
+    return nil
+}
+
 // ShootingResult captures outcome and logs
 type ShootingResult struct {
-    Logs           []string `json:"logs"`
+    Logs           []string `json:"logs"` // Events rendered as text
+    Events         []Event  `json:"events"`
     Attacks        int      `json:"attacks"`
     Hits           int      `json:"hits"`
     Wounds         int      `json:"wounds"`
     Saved          int      `json:"saved"`
     Unsaved        int      `json:"unsaved"`
     DamageTotal    int      `json:"damage_total"`
+    MortalWounds   int      `json:"mortal_wounds"` // before Feel No Pain
     DefenderWounds int      `json:"defender_wounds"`
+    ModelsSlain    int      `json:"models_slain"`
+    // Wounds left on the model that is damaged but still alive (0 if none)
+    WoundsLeftOnModel int   `json:"wounds_left_on_model"`
+    // Defender's models after the volley
+    Models         []ModelState `json:"models,omitempty"`
+    // Seed of the roller used, when it was seedable; pass it back to replay the volley
+    Seed           int64    `json:"seed"`
+    // Stages whose single (Command) re-roll was used; one that wasn't needed isn't listed
+    SingleRerolls  []Stage  `json:"single_rerolls,omitempty"`
     // Optional structured breakdown into sub-phases for UI/analysis
     Subphases      *ShootingSubphases `json:"subphases,omitempty"`
 }
@@ -41,26 +80,47 @@ type ShootingResult struct {
 // ShootingSubphases describes phase-by-phase rolls & targets
 type ShootingSubphases struct {
     Attacks struct {
-        Count int `json:"count"`
+        Count   int      `json:"count"`
+        Rerolls []Reroll `json:"rerolls,omitempty"`
     } `json:"attacks"`
     Hits struct {
-        Target  int   `json:"target"`
-        Rolls   []int `json:"rolls"`
-        Success int   `json:"success"`
+        Target   int   `json:"target"`
+        Modifier int   `json:"modifier"` // net, after caps
+        Rolls    []int `json:"rolls"` // final values, after any re-roll
+        Success  int   `json:"success"`
+        Critical int   `json:"critical"` // unmodified rolls at or above the critical hit threshold
+        CritTarget int `json:"crit_target"` // critical on this unmodified roll or higher
+        Rerolls  []Reroll `json:"rerolls,omitempty"`
     } `json:"hits"`
     Wounds struct {
-        Target  int   `json:"target"`
-        Rolls   []int `json:"rolls"`
-        Success int   `json:"success"`
+        Target   int   `json:"target"`
+        Modifier int   `json:"modifier"` // net, after caps
+        Rolls    []int `json:"rolls"`
+        Success  int   `json:"success"`
+        Critical int   `json:"critical"` // unmodified rolls at or above the critical wound threshold
+        CritTarget int `json:"crit_target"` // critical on this unmodified roll or higher (Anti-X lowers it)
+        Rerolls  []Reroll `json:"rerolls,omitempty"`
     } `json:"wounds"`
     Saves struct {
-        Target  int   `json:"target"`
-        Rolls   []int `json:"rolls"`
-        Success int   `json:"success"`
-        Failed  int   `json:"failed"`
+        Target   int   `json:"target"`
+        Modifier int   `json:"modifier"` // net armour save modifier, already folded into Target
+        Rolls    []int `json:"rolls"`
+        Success  int   `json:"success"`
+        Failed   int   `json:"failed"`
+        Rerolls  []Reroll `json:"rerolls,omitempty"`
     } `json:"saves"`
     Damage struct {
-        Rolls []int `json:"rolls"`
-        Total int   `json:"total"`
+        Rolls     []int `json:"rolls"`
+        Total     int   `json:"total"`     // damage after Feel No Pain
+        Allocated int   `json:"allocated"` // wounds actually removed from models
+        Wasted    int   `json:"wasted"`    // excess damage lost to allocation
+        Mortal    int   `json:"mortal"`    // mortal wounds from Devastating Wounds, before Feel No Pain
+        Rerolls   []Reroll `json:"rerolls,omitempty"`
     } `json:"damage"`
+    FNP struct {
+        Target  int      `json:"target,omitempty"` // 0 when the defender has no Feel No Pain
+        Rolls   []int    `json:"rolls,omitempty"`
+        Ignored int      `json:"ignored"`
+        Rerolls []Reroll `json:"rerolls,omitempty"`
+    } `json:"fnp"`
 }
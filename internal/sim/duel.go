@@ -0,0 +1,160 @@
+package sim
+
+import (
+	"fmt"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+// maxSteps caps the activations in one duel, in case neither side can finish the other
+const maxSteps = 1000
+
+// Side is one unit in a simulated duel
+type Side struct {
+    // Unit carries the ID, name and characteristics; its Models (or W when there are
+    // none) are the starting state of every trial
+    Unit    game.UnitSnapshot
+    Weapons []game.WeaponSnapshot
+}
+
+// duel is one worker's reusable state for playing trials. Model buffers are reset from
+// the sides at the start of each trial so a batch doesn't allocate fresh ones.
+type duel struct {
+    cfg    *Config
+    sides  [2]Side
+    start  [2][]game.ModelState
+    models [2][]game.ModelState
+    // fight loadouts and Overwatch weapons don't change between trials
+    loadouts  [2][][]game.WeaponSnapshot // by chosen weapon index
+    mainMelee [2]int
+    overwatch [2]int
+}
+
+// outcome is the tally of one trial
+type outcome struct {
+    winner      int // 0 (A), 1 (B), or -1 when the step cap ran out
+    rounds      int
+    charges     int
+    chargesMade int
+}
+
+func newDuel(cfg *Config) *duel {
+    d := &duel{cfg: cfg, sides: [2]Side{cfg.A, cfg.B}}
+    for i, s := range d.sides {
+        if len(s.Unit.Models) > 0 {
+            d.start[i] = s.Unit.Models
+        } else {
+            d.start[i] = []game.ModelState{{Name: s.Unit.Name, W: s.Unit.W, Wounds: s.Unit.W}}
+        }
+        d.models[i] = make([]game.ModelState, len(d.start[i]))
+        d.loadouts[i] = make([][]game.WeaponSnapshot, len(s.Weapons))
+        for j := range s.Weapons {
+            d.loadouts[i][j] = game.FightLoadout(s.Weapons, j)
+        }
+        d.mainMelee[i], d.overwatch[i] = -1, -1
+        for j, w := range s.Weapons {
+            if d.mainMelee[i] < 0 && w.IsMelee() && !game.ParseWeaponAbilities(w.Abilities...).ExtraAttacks {
+                d.mainMelee[i] = j
+            }
+            if d.overwatch[i] < 0 && !w.IsMelee() {
+                d.overwatch[i] = j
+            }
+        }
+    }
+    return d
+}
+
+// loadout returns the weapons side i fights with when it picked weapon idx
+func (d *duel) loadout(i, idx int) []game.WeaponSnapshot {
+    if idx < 0 || idx >= len(d.loadouts[i]) { return nil }
+    return d.loadouts[i][idx]
+}
+
+// play runs one duel to the end. Ranged loadouts trade volleys; melee loadouts have to
+// charge (facing Overwatch if asked for) before the units fight. An error means the
+// engine refused a volley, charge or fight, e.g. a weapon out of range.
+func (d *duel) play(rng game.Roller) (outcome, error) {
+    cfg := d.cfg
+    hp := [2]int{}
+    for i := range d.models {
+        d.models[i] = append(d.models[i][:0], d.start[i]...)
+        hp[i] = game.ModelsRemaining(d.models[i])
+    }
+    models := d.models
+    degraded := [2]bool{}
+    engaged := false
+    turn := 0 // 0 -> A, 1 -> B
+    round := 1
+    out := outcome{winner: -1}
+    for step := 0; step < maxSteps; step++ {
+        foe := 1 - turn
+        weapons := d.sides[turn].Weapons
+        if len(weapons) == 0 {
+            out.winner = foe
+            return out, nil
+        }
+        idx := 0
+        if cfg.Rotate {
+            idx = (round - 1) % len(weapons)
+        }
+        att, def := d.sides[turn].Unit, d.sides[foe].Unit
+        att.W, att.Models, att.Degraded = hp[turn], models[turn], degraded[turn]
+        def.W, def.Models, def.Degraded = hp[foe], models[foe], degraded[foe]
+        wep := weapons[idx]
+        if !wep.IsMelee() {
+            res, err := game.ResolveShootingWith(att, def, wep, game.ShootingOptions{Roller: rng, Distance: cfg.Distance, Quiet: true, Ruleset: cfg.Ruleset})
+            if err != nil {
+                return out, fmt.Errorf("%s shooting %s: %v", att.Name, wep.Name, err)
+            }
+            hp[foe], models[foe] = res.DefenderWounds, res.Models
+        } else {
+            charged := false
+            if !engaged {
+                co := game.ChargeOptions{Roller: rng, Distance: cfg.ChargeDistance, Quiet: true, Ruleset: cfg.Ruleset}
+                if cfg.Overwatch && d.overwatch[foe] >= 0 {
+                    co.Overwatch = &game.OverwatchFire{Unit: def, Weapon: d.sides[foe].Weapons[d.overwatch[foe]]}
+                }
+                ch, err := game.ResolveCharge(att, co)
+                if err != nil {
+                    return out, fmt.Errorf("%s charging: %v", att.Name, err)
+                }
+                out.charges++
+                hp[turn], models[turn] = ch.Wounds, ch.Models
+                att.W, att.Models = ch.Wounds, ch.Models
+                engaged, charged = ch.Success, ch.Success
+                if ch.Success {
+                    out.chargesMade++
+                }
+            }
+            if engaged {
+                fr, err := game.ResolveFight(
+                    game.Fighter{Unit: att, Weapons: d.loadout(turn, idx), Charged: charged},
+                    game.Fighter{Unit: def, Weapons: d.loadout(foe, d.mainMelee[foe])},
+                    game.FightOptions{Roller: rng, Quiet: true, Ruleset: cfg.Ruleset},
+                )
+                if err != nil {
+                    return out, fmt.Errorf("%s fighting %s: %v", att.Name, def.Name, err)
+                }
+                hp[turn], models[turn] = fr.Sides[0].Wounds, fr.Sides[0].Models
+                hp[foe], models[foe] = fr.Sides[1].Wounds, fr.Sides[1].Models
+            }
+        }
+        // A unit that dropped into its damaged bracket stays degraded for the rest of the trial
+        for i := range degraded {
+            degraded[i] = degraded[i] || game.IsDamaged(game.UnitSnapshot{Damaged: d.sides[i].Unit.Damaged, Models: models[i]})
+        }
+        if hp[foe] <= 0 || hp[turn] <= 0 {
+            out.winner = turn
+            if hp[turn] <= 0 {
+                out.winner = foe
+            }
+            out.rounds = round
+            return out, nil
+        }
+        if turn == 1 {
+            round++
+        }
+        turn = foe
+    }
+    return out, nil
+}
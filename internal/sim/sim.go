@@ -0,0 +1,209 @@
+// Package sim runs Monte Carlo duels between two units on a worker pool, using the
+// engine's quiet (log-free) resolution path.
+package sim
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+const (
+    DefaultTrials         = 400
+    MaxTrials             = 1000000
+    DefaultChargeDistance = 7 // inches
+    // batchSize is how many trials a worker plays per roller and between precision checks
+    batchSize = 500
+    // minTrialsForStop keeps early stopping from trusting the first few batches
+    minTrialsForStop = 2000
+    // z95 is the normal quantile for a 95% confidence interval
+    z95 = 1.959964
+)
+
+// Config describes a simulation between A and B
+type Config struct {
+    A, B   Side
+    Trials int  // maximum trials; 0 means DefaultTrials
+    Rotate bool // cycle through each side's weapons by battle round instead of using the first
+    // Distance between the units in inches; 0 ignores range
+    Distance int
+    // Declared charge distance for melee loadouts, and whether the target fires Overwatch
+    // with its first ranged weapon. 0 means DefaultChargeDistance.
+    ChargeDistance int
+    Overwatch      bool
+    // Precision stops the run early once both win rates' 95% confidence intervals are
+    // within ±Precision (e.g. 0.01); 0 plays every trial
+    Precision float64
+    Workers   int   // 0 means GOMAXPROCS
+    Seed      int64 // 0 means a fresh seed; batch i rolls with Seed+i
+    // Ruleset every trial is played under; nil means game.DefaultRuleset
+    Ruleset game.Ruleset
+}
+
+// Interval is a confidence interval for a rate
+type Interval struct {
+    Low  float64 `json:"low"`
+    High float64 `json:"high"`
+}
+
+// Result summarizes a simulation
+type Result struct {
+    Trials   int      `json:"trials"` // trials actually played
+    AWinRate float64  `json:"a_win_rate"`
+    BWinRate float64  `json:"b_win_rate"`
+    ACI      Interval `json:"a_win_ci"` // 95% Wilson score interval
+    BCI      Interval `json:"b_win_ci"`
+    // Average battle round in which a duel was decided
+    AvgRounds float64 `json:"avg_rounds"`
+    // Share of charges that succeeded; only set when a melee loadout charged
+    ChargeSuccessRate *float64 `json:"charge_success_rate,omitempty"`
+    StoppedEarly      bool     `json:"stopped_early,omitempty"`
+    Seed              int64    `json:"seed"`
+    Ruleset           string   `json:"ruleset"`
+}
+
+// tally accumulates trial outcomes
+type tally struct {
+    trials, rounds, charges, chargesMade int
+    wins                                 [2]int
+}
+
+func (t *tally) add(o outcome) {
+    t.trials++
+    t.charges += o.charges
+    t.chargesMade += o.chargesMade
+    if o.winner >= 0 {
+        t.wins[o.winner]++
+        t.rounds += o.rounds
+    }
+}
+
+func (t *tally) merge(o tally) {
+    t.trials += o.trials
+    t.rounds += o.rounds
+    t.charges += o.charges
+    t.chargesMade += o.chargesMade
+    t.wins[0] += o.wins[0]
+    t.wins[1] += o.wins[1]
+}
+
+// precise reports whether both win rates are known to within ±p
+func (t tally) precise(p float64) bool {
+    if p <= 0 || t.trials < minTrialsForStop { return false }
+    for _, w := range t.wins {
+        ci := Wilson(w, t.trials)
+        if (ci.High-ci.Low)/2 > p { return false }
+    }
+    return true
+}
+
+// Wilson returns the 95% Wilson score interval for k successes in n trials
+func Wilson(k, n int) Interval {
+    if n <= 0 { return Interval{0, 1} }
+    p := float64(k) / float64(n)
+    nf := float64(n)
+    z2 := z95 * z95
+    den := 1 + z2/nf
+    mid := (p + z2/(2*nf)) / den
+    half := z95 * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf)) / den
+    return Interval{Low: math.Max(0, mid-half), High: math.Min(1, mid+half)}
+}
+
+// validate checks the config and fills in defaults
+func (c *Config) validate() error {
+    if c.Trials <= 0 { c.Trials = DefaultTrials }
+    if c.Trials > MaxTrials {
+        return fmt.Errorf("trials %d out of range (want 1-%d)", c.Trials, MaxTrials)
+    }
+    if c.Precision < 0 || c.Precision >= 0.5 {
+        return fmt.Errorf("precision %.4f out of range (want 0 to 0.5)", c.Precision)
+    }
+    if c.ChargeDistance == 0 { c.ChargeDistance = DefaultChargeDistance }
+    if c.ChargeDistance < 0 || c.ChargeDistance > game.MaxChargeDistance {
+        return fmt.Errorf("charge distance %d\" out of range (want 1-%d\")", c.ChargeDistance, game.MaxChargeDistance)
+    }
+    if c.Workers <= 0 { c.Workers = runtime.GOMAXPROCS(0) }
+    if c.Seed == 0 { c.Seed = game.NewSeed() }
+    if c.Ruleset == nil { c.Ruleset = game.DefaultRuleset }
+    return nil
+}
+
+// Run plays up to cfg.Trials duels between A and B across a worker pool. Workers claim
+// batches of trials, each rolled with its own seeded roller, and merge their tallies;
+// with a Precision the run stops at the first batch boundary where the intervals are
+// tight enough. Without one, the same Seed gives the same result. If the engine refuses
+// any trial's volley, charge or fight, the run stops and returns that error.
+func Run(cfg Config) (Result, error) {
+    if err := cfg.validate(); err != nil {
+        return Result{}, err
+    }
+    batches := (cfg.Trials + batchSize - 1) / batchSize
+    workers := cfg.Workers
+    if workers > batches { workers = batches }
+
+    var (
+        next   atomic.Int64 // next batch to claim
+        stop   atomic.Bool
+        mu     sync.Mutex
+        total  tally
+        runErr error // the first error any trial hit
+        wg     sync.WaitGroup
+    )
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            d := newDuel(&cfg)
+            for !stop.Load() {
+                b := int(next.Add(1) - 1)
+                if b >= batches { return }
+                n := batchSize
+                if rest := cfg.Trials - b*batchSize; rest < n { n = rest }
+                rng := game.NewSeededRoller(cfg.Seed + int64(b))
+                var t tally
+                for i := 0; i < n; i++ {
+                    o, err := d.play(rng)
+                    if err != nil {
+                        mu.Lock()
+                        if runErr == nil { runErr = err }
+                        mu.Unlock()
+                        stop.Store(true)
+                        return
+                    }
+                    t.add(o)
+                }
+                mu.Lock()
+                total.merge(t)
+                if total.precise(cfg.Precision) { stop.Store(true) }
+                mu.Unlock()
+            }
+        }()
+    }
+    wg.Wait()
+    if runErr != nil {
+        return Result{}, runErr
+    }
+
+    res := Result{
+        Trials:       total.trials,
+        AWinRate:     float64(total.wins[0]) / float64(total.trials),
+        BWinRate:     float64(total.wins[1]) / float64(total.trials),
+        ACI:          Wilson(total.wins[0], total.trials),
+        BCI:          Wilson(total.wins[1], total.trials),
+        StoppedEarly: total.trials < cfg.Trials,
+        Seed:         cfg.Seed,
+        Ruleset:      cfg.Ruleset.Name(),
+    }
+    if decided := total.wins[0] + total.wins[1]; decided > 0 {
+        res.AvgRounds = float64(total.rounds) / float64(decided)
+    }
+    if total.charges > 0 {
+        rate := float64(total.chargesMade) / float64(total.charges)
+        res.ChargeSuccessRate = &rate
+    }
+    return res, nil
+}
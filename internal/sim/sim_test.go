@@ -0,0 +1,130 @@
+package sim
+
+import (
+    "math"
+    "testing"
+
+    game "github.com/pefman/w40k-duel/internal/engine"
+)
+
+func marines() Side {
+    return Side{
+        Unit:    game.UnitSnapshot{Name: "Marines", T: 4, Sv: 3, W: 2, Models: []game.ModelState{{Name: "Marine", W: 2, Wounds: 2}, {Name: "Marine", W: 2, Wounds: 2}}},
+        Weapons: []game.WeaponSnapshot{{Name: "Bolt rifle", Type: "ranged", Attacks: "2", Skill: 3, Strength: 4, AP: -1, Damage: "1"}},
+    }
+}
+
+func boyz() Side {
+    return Side{
+        Unit:    game.UnitSnapshot{Name: "Boyz", T: 5, Sv: 5, W: 1, Models: []game.ModelState{{Name: "Boy", W: 1, Wounds: 1}, {Name: "Boy", W: 1, Wounds: 1}, {Name: "Boy", W: 1, Wounds: 1}}},
+        Weapons: []game.WeaponSnapshot{{Name: "Choppa", Type: "melee", Attacks: "3", Skill: 3, Strength: 4, AP: -1, Damage: "1"}},
+    }
+}
+
+func TestWilson(t *testing.T) {
+    ci := Wilson(50, 100)
+    if math.Abs(ci.Low-0.4038) > 1e-3 || math.Abs(ci.High-0.5962) > 1e-3 {
+        t.Errorf("Wilson(50, 100) = %+v, want about 0.404-0.596", ci)
+    }
+    if ci := Wilson(0, 10); ci.Low != 0 || ci.High <= 0 {
+        t.Errorf("Wilson(0, 10) = %+v", ci)
+    }
+    if ci := Wilson(0, 0); ci != (Interval{0, 1}) {
+        t.Errorf("Wilson(0, 0) = %+v, want 0-1", ci)
+    }
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+    cfg := Config{A: marines(), B: boyz(), Trials: 3000, Overwatch: true, Seed: 42}
+    a, err := Run(cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The result depends only on the seed, not on how batches are spread over workers
+    for _, workers := range []int{1, 3} {
+        c := cfg
+        c.Workers = workers
+        b, _ := Run(c)
+        if a.AWinRate != b.AWinRate || a.BWinRate != b.BWinRate || a.AvgRounds != b.AvgRounds || a.Trials != b.Trials {
+            t.Errorf("%d workers: %+v, want %+v", workers, b, a)
+        }
+    }
+    if a.Trials != 3000 || a.Seed != 42 || a.StoppedEarly {
+        t.Errorf("got %+v", a)
+    }
+    for _, c := range []struct {
+        rate float64
+        ci   Interval
+    }{{a.AWinRate, a.ACI}, {a.BWinRate, a.BCI}} {
+        if c.rate < c.ci.Low || c.rate > c.ci.High {
+            t.Errorf("win rate %.3f outside its interval %+v", c.rate, c.ci)
+        }
+    }
+    if a.ChargeSuccessRate == nil {
+        t.Error("the Boyz charged but no charge success rate was reported")
+    }
+}
+
+func TestRunStopsAtPrecision(t *testing.T) {
+    res, err := Run(Config{A: marines(), B: boyz(), Trials: 100000, Precision: 0.02, Seed: 7})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !res.StoppedEarly || res.Trials >= 100000 {
+        t.Fatalf("ran %d trials, want an early stop", res.Trials)
+    }
+    for _, ci := range []Interval{res.ACI, res.BCI} {
+        if (ci.High-ci.Low)/2 > 0.02 {
+            t.Errorf("interval %+v is wider than ±0.02", ci)
+        }
+    }
+}
+
+func TestRunValidates(t *testing.T) {
+    for _, cfg := range []Config{
+        {A: marines(), B: boyz(), Trials: MaxTrials + 1},
+        {A: marines(), B: boyz(), Precision: 0.5},
+        {A: marines(), B: boyz(), ChargeDistance: game.MaxChargeDistance + 1},
+    } {
+        if _, err := Run(cfg); err == nil {
+            t.Errorf("%+v was accepted", cfg)
+        }
+    }
+}
+
+func TestDuelScripted(t *testing.T) {
+    // Marines shoot first: hits 3, 3; wounds 5, 5; saves 1, 1 kill two Boyz.
+    // The last Boy charges: 5 + 1 falls short of 7". In round 2 the Marines hit with 3 and
+    // miss with 1, wound on 5 and the failed save of 1 kills the last Boy.
+    cfg := Config{A: marines(), B: boyz(), ChargeDistance: 7}
+    rng := game.NewScriptedRoller(3, 3, 5, 5, 1, 1, 5, 1, 3, 1, 5, 1)
+    out, err := newDuel(&cfg).play(rng)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if out.winner != 0 || out.rounds != 2 || out.charges != 1 || out.chargesMade != 0 {
+        t.Errorf("got %+v, want A winning in round 2 after one failed charge", out)
+    }
+    if rng.Used() != 12 {
+        t.Errorf("used %d dice, want 12", rng.Used())
+    }
+}
+
+func TestRunReportsRuleset(t *testing.T) {
+    res, err := Run(Config{A: marines(), B: boyz(), Trials: 10, Seed: 1})
+    if err != nil || res.Ruleset != "10th" {
+        t.Errorf("default run: ruleset %q, %v", res.Ruleset, err)
+    }
+    res, err = Run(Config{A: marines(), B: boyz(), Trials: 10, Seed: 1, Ruleset: game.ClassicWoundChart{}})
+    if err != nil || res.Ruleset != "classic-wound-chart" {
+        t.Errorf("classic run: ruleset %q, %v", res.Ruleset, err)
+    }
+}
+
+func TestRunReturnsEngineErrors(t *testing.T) {
+    a := marines()
+    a.Weapons[0].Range = 24
+    if _, err := Run(Config{A: a, B: boyz(), Trials: 10, Distance: 30, Seed: 1}); err == nil {
+        t.Error("a run with the target out of range succeeded")
+    }
+}